@@ -2,7 +2,12 @@
 package veracity
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/forestrie/go-merklelog-azure/blobs"
 	"github.com/urfave/cli/v2"
@@ -26,6 +31,11 @@ func NewApp(version string, ikwid bool) *cli.App {
 				Name: "data-url", Aliases: []string{"u"},
 				Usage: "url to download merkle log data from. mutually exclusive with data-local; if neither option is supplied, DataTrails' live log data will be used",
 			},
+			&cli.StringFlag{
+				Name:  "remote-provider",
+				Usage: "how data-url is read. azure for azure blob storage, or http for any http server or CDN serving the /verifiabledata/merklelogs layout. serve-replica urls are read as http unless this is set",
+				Value: remoteProviderAzure,
+			},
 			&cli.StringFlag{
 				Name: "data-local", Aliases: []string{"l"},
 				Usage: "filesystem location to load merkle log data from. can be a directory of massifs or a single file. mutually exclusive with data-url",
@@ -43,9 +53,28 @@ func NewApp(version string, ikwid bool) *cli.App {
 				Name: "tenant", Aliases: []string{"t"},
 				Usage: "tenant or list of tenants as a `,` separated list. commands which operate on a single tenant take the first tenant in the list",
 			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "cancel the command if it has not completed after this long, eg 5m. by default there is no limit",
+			},
 		},
 	}
 
+	// Every command runs with a context that is cancelled on ctrl-c (SIGINT),
+	// SIGTERM or when --timeout expires. The cancellation propagates to all
+	// in flight storage requests.
+	var cancel context.CancelFunc
+	app.Before = func(cCtx *cli.Context) error {
+		cCtx.Context, cancel = newCommandContext(cCtx.Context, cCtx.Duration("timeout"))
+		return nil
+	}
+	app.After = func(cCtx *cli.Context) error {
+		if cancel != nil {
+			cancel()
+		}
+		return nil
+	}
+
 	if ikwid {
 		app.Flags = append(app.Flags, &cli.BoolFlag{
 			Name: "envauth", Usage: "set to enable authorization from the environment (not all commands support this)",
@@ -64,12 +93,45 @@ func NewApp(version string, ikwid bool) *cli.App {
 	return app
 }
 
+// newCommandContext returns a context which is cancelled by SIGINT or
+// SIGTERM, and by the timeout if it is not zero. Once the context is done,
+// the signal handling is restored, so that a second ctrl-c terminates the
+// process even if a command does not respond to the cancellation.
+func newCommandContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, stop := signal.NotifyContext(parent, os.Interrupt, syscall.SIGTERM)
+	cancelTimeout := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+	}
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, func() {
+		cancelTimeout()
+		stop()
+	}
+}
+
 func AddCommands(app *cli.App, ikwid bool) *cli.App {
 	app.Commands = append(app.Commands, NewVerifyIncludedCmd())
 	app.Commands = append(app.Commands, NewNodeCmd())
 	app.Commands = append(app.Commands, NewLogWatcherCmd())
 	app.Commands = append(app.Commands, NewReplicateLogsCmd())
 	app.Commands = append(app.Commands, NewReceiptCmd())
+	app.Commands = append(app.Commands, NewProveCmd())
+	app.Commands = append(app.Commands, NewVerifyReceiptCmd())
+	app.Commands = append(app.Commands, NewAuditReplicaCmd())
+	app.Commands = append(app.Commands, NewCheckpointsCmd())
+	app.Commands = append(app.Commands, NewCompareViewsCmd())
+	app.Commands = append(app.Commands, NewWitnessCmd())
+	app.Commands = append(app.Commands, NewPruneCmd())
+	app.Commands = append(app.Commands, NewServeReplicaCmd())
+	app.Commands = append(app.Commands, NewSCITTServeCmd())
+	app.Commands = append(app.Commands, NewInitLogCmd())
 
 	if ikwid {
 		app.Commands = append(app.Commands, NewMassifsCmd())
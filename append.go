@@ -2,16 +2,17 @@ package veracity
 
 import (
 	"bytes"
-	"context"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
+	"cmp"
+	"crypto"
+	"crypto/ed25519"
 	"crypto/sha256"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -21,7 +22,6 @@ import (
 	"github.com/forestrie/go-merklelog/massifs"
 	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
 	commoncose "github.com/forestrie/go-merklelog/massifs/cose"
-	"github.com/forestrie/go-merklelog/massifs/storage"
 	"github.com/forestrie/go-merklelog/mmr"
 	"github.com/datatrails/veracity/keyio"
 	"github.com/datatrails/veracity/scitt"
@@ -31,7 +31,8 @@ import (
 // coseSigner implements IdentifiableCoseSigner
 type identifiableCoseSigner struct {
 	innerSigner cose.Signer
-	publicKey   ecdsa.PublicKey
+	publicKey   crypto.PublicKey
+	identity    sealerIdentity
 }
 
 func (s *identifiableCoseSigner) Algorithm() cose.Algorithm {
@@ -42,21 +43,194 @@ func (s *identifiableCoseSigner) Sign(rand io.Reader, content []byte) ([]byte, e
 	return s.innerSigner.Sign(rand, content)
 }
 
-func (s *identifiableCoseSigner) LatestPublicKey() (*ecdsa.PublicKey, error) {
-	return &s.publicKey, nil
-}
-
-func (s *identifiableCoseSigner) PublicKey(ctx context.Context, kid string) (*ecdsa.PublicKey, error) {
-	return &s.publicKey, nil
+// Public returns the public key of the signer
+func (s *identifiableCoseSigner) Public() crypto.PublicKey {
+	return s.publicKey
 }
 
 func (s *identifiableCoseSigner) KeyLocation() string {
-	return "robinbryce.me"
+	return s.identity.KeyLocation
 }
 
 func (s *identifiableCoseSigner) KeyIdentifier() string {
-	// the returned kid needs to match the kid format of the keyvault key
-	return "location:robinbryce/version1"
+	return s.identity.KeyID
+}
+
+// JWK returns the public key of the signer, identified by its kid
+func (s *identifiableCoseSigner) JWK() (keyio.JWK, error) {
+	return keyio.PublicJWK(s.publicKey, s.Algorithm(), s.identity.KeyID)
+}
+
+// newIdentifiableCoseSigner creates the signer for sealing checkpoints. If
+// the identity has no issuer, the default is used, and if it has no kid, the
+// RFC 7638 thumbprint of the key is used.
+func newIdentifiableCoseSigner(sealingKey crypto.Signer, identity sealerIdentity) (*identifiableCoseSigner, error) {
+	alg, err := keyio.AlgForPublic(sealingKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	coseSigner, err := cose.NewSigner(alg, sealingKey)
+	if err != nil {
+		return nil, err
+	}
+	if identity.Issuer == "" {
+		identity.Issuer = defaultSealerIssuer
+	}
+	if identity.KeyID == "" {
+		jwk, err := keyio.PublicJWK(sealingKey.Public(), alg, "")
+		if err != nil {
+			return nil, err
+		}
+		identity.KeyID = jwk.Kid
+	}
+	return &identifiableCoseSigner{
+		innerSigner: coseSigner,
+		publicKey:   sealingKey.Public(),
+		identity:    identity,
+	}, nil
+}
+
+// readSealerKey reads the key set by --sealer-key or --sealer-key-pem. If
+// both are set, the pem key is used. If neither is set, the key is nil.
+func readSealerKey(cCtx *cli.Context) (crypto.Signer, error) {
+	var decodedKey keyio.DecodedPrivate
+	var err error
+
+	switch {
+	case cCtx.String("sealer-key-pem") != "":
+		if cCtx.IsSet("sealer-key") {
+			fmt.Printf("verifying with sealer-key-pem %s (in preference to sealer-key)", cCtx.String("sealer-key-pem"))
+		}
+		sealerKeyFile := cCtx.String("sealer-key-pem")
+		decodedKey, err = keyio.ReadPrivatePEM(sealerKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load sealer key from file %s: %w", sealerKeyFile, err)
+		}
+	case cCtx.String("sealer-key") != "":
+		sealerKeyFile := cCtx.String("sealer-key")
+		decodedKey, err = keyio.ReadPrivateCOSE(sealerKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load sealer key from file %s: %w", sealerKeyFile, err)
+		}
+	}
+	return decodedKey.Private, nil
+}
+
+// sealMassif signs a checkpoint for the current size of the verified massif.
+//
+// To create the checkpoint, we first check that the current state contains
+// the previously verified state. This necessarily produces and verifies the
+// new accumulator which we can then include with the new checkpoint.
+func sealMassif(
+	codec commoncbor.CBORCodec, signer *identifiableCoseSigner,
+	verified *massifs.VerifiedContext, subject string,
+) ([]byte, error) {
+
+	mmrSizeCurrent := verified.RangeCount()
+	peaksB, err := sealedPeaks(verified, mmrSizeCurrent)
+	if err != nil {
+		return nil, err
+	}
+	lastIDTimestamp := verified.GetLastIDTimestamp()
+
+	state := massifs.MMRState{
+		Version:         int(massifs.MMRStateVersionCurrent),
+		MMRSize:         mmrSizeCurrent,
+		Peaks:           peaksB,
+		Timestamp:       time.Now().UnixMilli(),
+		CommitmentEpoch: verified.MMRState.CommitmentEpoch,
+		IDTimestamp:     lastIDTimestamp,
+	}
+
+	return sealSign1(codec, signer, subject, state)
+}
+
+// sealedPeaks returns the accumulator for the new size, after checking it is
+// consistent with the verified state. A new log, whose verified state is
+// empty, has no earlier state to be consistent with, and an empty log has no
+// peaks.
+func sealedPeaks(verified *massifs.VerifiedContext, mmrSizeCurrent uint64) ([][]byte, error) {
+	if mmrSizeCurrent == 0 {
+		return nil, nil
+	}
+	if verified.MMRState.MMRSize == 0 {
+		return mmr.PeakHashes(&verified.MassifContext, mmrSizeCurrent-1)
+	}
+
+	cp, err := mmr.IndexConsistencyProof(&verified.MassifContext, verified.MMRState.MMRSize-1, mmrSizeCurrent-1)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, peaksB, err := mmr.CheckConsistency(
+		verified, sha256.New(),
+		cp.MMRSizeA, cp.MMRSizeB, verified.MMRState.Peaks)
+	if !ok {
+		return nil, fmt.Errorf("consistency check failed: verify failed")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return peaksB, nil
+}
+
+// AppendManifestEntry describes a statement registered by append
+type AppendManifestEntry struct {
+	StatementFile string `json:"statement_file"`
+	StatementHash string `json:"statement_hash"`
+	MMRIndex      uint64 `json:"mmrindex"`
+	IDTimestamp   string `json:"idtimestamp"`
+	LeafHash      string `json:"leaf_hash"`
+	ReceiptFile   string `json:"receipt_file"`
+}
+
+// AppendManifest records the statements registered by a single append, and
+// the size of the ledger after they were sealed.
+type AppendManifest struct {
+	MMRSize    uint64                `json:"mmrsize"`
+	Statements []AppendManifestEntry `json:"statements"`
+}
+
+// appendedStatement is a statement added to the ledger, and the file it was read from
+type appendedStatement struct {
+	FileName string
+	scitt.MMRStatement
+}
+
+// appendVerifiers returns the verifiers for the head checkpoint of the
+// ledger. The sealer key is first, followed by any key for the checkpoint the
+// ledger was forked from, and then any trusted sealer key.
+func appendVerifiers(cmd *CmdCtx, cCtx *cli.Context, sealingKey crypto.Signer) ([]cose.Verifier, error) {
+	alg, err := keyio.AlgForPublic(sealingKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := cose.NewVerifier(alg, sealingKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	verifiers := []cose.Verifier{verifier}
+
+	if len(cmd.CheckpointKeys.Keys) != 0 {
+		verifier, err = checkpointVerifier(cmd)
+		if err != nil {
+			return nil, err
+		}
+		verifiers = append(verifiers, verifier)
+	}
+
+	if cCtx.String("trusted-sealer-key-pem") != "" {
+		trusted, err := keyio.ReadPublicPEM(cCtx.String("trusted-sealer-key-pem"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trusted sealer key: %w", err)
+		}
+		verifier, err = cose.NewVerifier(trusted.Alg, trusted.Public)
+		if err != nil {
+			return nil, err
+		}
+		verifiers = append(verifiers, verifier)
+	}
+	return verifiers, nil
 }
 
 // NewAppendCmd appends an entry to a local ledger, optionally sealing it with a provided private key.
@@ -64,7 +238,7 @@ func NewAppendCmd() *cli.Command {
 	return &cli.Command{
 		Name:  "append",
 		Usage: "add an entry to a local ledger, optionally sealing it with a provided private key",
-		Flags: []cli.Flag{
+		Flags: slices.Concat([]cli.Flag{
 			&cli.Uint64Flag{
 				Name: "mmrindex", Aliases: []string{"i"},
 			},
@@ -75,17 +249,21 @@ func NewAppendCmd() *cli.Command {
 			},
 			&cli.StringFlag{
 				Name:  "sealer-key",
-				Usage: "the sealer key to use for signing the entry, in cose .cbor. Only P-256, ES256 is supported. If --generate-sealer-key is set, this generated key will be written to this file.",
+				Usage: "the sealer key to use for signing the entry, in cose .cbor. P-256, P-384, P-521 and Ed25519 keys are supported. If --generate-sealer-key is set, this generated key will be written to this file.",
 			},
 			&cli.StringFlag{
 				Name:  "sealer-key-pem",
-				Usage: "the sealer key to use for signing the entry, in PEM format. Only P-256, ES256 is supported. If --generate-sealer-key is set, this generated key will be written to this file.",
+				Usage: "the sealer key to use for signing the entry, in PEM format. P-256, P-384, P-521 and Ed25519 keys are supported. If --generate-sealer-key is set, this generated key will be written to this file.",
 			},
 			&cli.StringFlag{
 				Name:  "sealer-public-key-pem",
 				Usage: "If set, and if the sealer key is generated, the public key in PEM format is saved to this file.",
 			},
 
+			&cli.StringFlag{
+				Name:  "logid",
+				Usage: "the log to append to, --tenant may be used instead",
+			},
 			&cli.StringFlag{
 				Name:  "trusted-sealer-key-pem",
 				Usage: "verify the current seal using this pem file based public key",
@@ -93,7 +271,17 @@ func NewAppendCmd() *cli.Command {
 
 			&cli.StringFlag{
 				Name:  "receipt-file",
-				Usage: "file name to write the receipt to, defaults to 'receipt-{mmrIndex}.cbor'",
+				Usage: "file name to write the receipt to, when a single statement is registered. defaults to 'receipt-{mmrIndex}.cbor' in --receipts-dir",
+			},
+			&cli.StringFlag{
+				Name:  "receipts-dir",
+				Usage: "the directory to write a receipt for each registered statement to, as 'receipt-{mmrIndex}.cbor'",
+				Value: ".",
+			},
+			&cli.StringFlag{
+				Name:  "manifest",
+				Usage: "file name to write the json manifest of the registered statements to",
+				Value: "append-manifest.json",
 			},
 
 			&cli.StringFlag{
@@ -107,7 +295,12 @@ func NewAppendCmd() *cli.Command {
 
 			&cli.BoolFlag{
 				Name:  "generate-sealer-key",
-				Usage: "generate an ephemeral sealer key and write it to the sealer-key file. If the sealer-key file already exists, it will be overwritten. the default file name is 'ecdsa-key-private.cbor'.",
+				Usage: "generate an ephemeral sealer key and write it to the sealer-key file. If the sealer-key file already exists, it will be overwritten. the default file name is 'ecdsa-key-private.cbor', or 'ed25519-key-private.cbor' for Ed25519 keys.",
+			},
+			&cli.StringFlag{
+				Name:  "sealer-key-type",
+				Usage: "the type of key to generate for --generate-sealer-key, one of P-256, P-384, P-521 or Ed25519",
+				Value: keyio.KeyTypeP256,
 			},
 			&cli.StringFlag{
 				Name:  "massifs-dir",
@@ -117,11 +310,11 @@ func NewAppendCmd() *cli.Command {
 				Name:  "seals-dir",
 				Usage: "the directory to read the massif seals from.",
 			},
-		},
+		}, checkpointKeyFlags(), sealerIdentityFlags()),
 		Action: func(cCtx *cli.Context) error {
 			var err error
-			var reader readerSelector
 			cmd := &CmdCtx{}
+			ctx := cCtx.Context
 
 			if !cCtx.IsSet("data-local") {
 				return errors.New("this command supports local replicas only, and requires --data-local")
@@ -130,329 +323,210 @@ func NewAppendCmd() *cli.Command {
 			if err != nil {
 				return fmt.Errorf("failed to configure logging: %w", err)
 			}
-
-			if reader, err = cfgMassifReader(cmd, cCtx); err != nil {
+			if err = cfgMassifFmt(cmd, cCtx); err != nil {
 				return err
 			}
-
-			//
-			// Read or generate a key to seal the forked log
-			//
-			var sealingKey *ecdsa.PrivateKey
-			var decodedKey keyio.DecodedPrivate
-			if cCtx.IsSet("sealer-key") && !cCtx.Bool("generate-sealer-key") {
-				sealerKeyFile := cCtx.String("sealer-key")
-				if sealerKeyFile == "" {
-					return errors.New("sealer-key file is required")
-				}
-				decodedKey, err = keyio.ReadECDSAPrivateCOSE(sealerKeyFile)
-				if err != nil {
-					return fmt.Errorf("failed to load sealer key from file %s: %w", sealerKeyFile, err)
-				}
-				sealingKey = decodedKey.Private
-			}
-			if cCtx.IsSet("sealer-key-pem") && !cCtx.Bool("generate-sealer-key") {
-				if cCtx.IsSet("sealer-key") {
-					fmt.Printf("verifying with sealer-key-pem %s (in preference to sealer-key)", cCtx.String("sealer-key-pem"))
-				}
-				sealerKeyFile := cCtx.String("sealer-key-pem")
-				if sealerKeyFile == "" {
-					return errors.New("sealer-key file is required")
-				}
-				decodedKey, err = keyio.ReadECDSAPrivatePEM(sealerKeyFile)
-				if err != nil {
-					return fmt.Errorf("failed to load sealer key from file %s: %w", sealerKeyFile, err)
-				}
-				sealingKey = decodedKey.Private
-			}
-
-			if cCtx.Bool("generate-sealer-key") {
-				sealingKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-				if err != nil {
-					return err
-				}
+			// The key for the checkpoint the ledger was forked from
+			if err = CfgKeys(cmd, cCtx); err != nil {
+				return err
 			}
-			var verifier cose.Verifier
 
-			if cmd.CheckpointPublic.Public == nil {
-				return errors.New("checkpoint public key is required")
+			logID := CtxGetOneLogOption(cCtx)
+			if logID == nil {
+				return fmt.Errorf("%w: a tenant or logid is required for this command", ErrRequiredOption)
 			}
-			verifier, err = cose.NewVerifier(cmd.CheckpointPublic.Alg, cmd.CheckpointPublic.Public)
+			store, err := newMassifStore(cmd, cCtx)
 			if err != nil {
 				return err
 			}
-
-			headIndex, err := reader.HeadIndex(context.Background(), storage.ObjectCheckpoint)
-			if err != nil {
-				return fmt.Errorf("failed to get head index: %w", err)
-			}
-
-			verified, err := massifs.GetContextVerified(
-				context.Background(), reader, &cmd.CBORCodec, verifier, headIndex)
-			if err != nil {
-				return fmt.Errorf("failed to read verified head massif: %w", err)
+			if err = store.SelectLog(ctx, logID); err != nil {
+				return err
 			}
 
-			mmrSizeOrig := verified.RangeCount()
-			fmt.Printf("%8d verified-size\n", mmrSizeOrig)
-			// verified.Tags = map[string]string{}
-
 			//
-			// Add a batch of statements
+			// Read or generate a key to seal the forked log
 			//
-			statements, err := addStatements(cmd, cCtx, &verified.MassifContext)
-			if err != nil {
-				return err
+			var sealingKey crypto.Signer
+			if cCtx.Bool("generate-sealer-key") {
+				sealingKey, err = keyio.GenerateKey(cCtx.String("sealer-key-type"))
+			} else {
+				sealingKey, err = readSealerKey(cCtx)
 			}
-			fmt.Printf("%d statements registered\n", len(statements))
-			mmrSizeNew := verified.RangeCount()
-			peakHashesNew, err := mmr.PeakHashes(&verified.MassifContext, mmrSizeNew-1)
 			if err != nil {
 				return err
 			}
-			for i, peak := range peakHashesNew {
-				fmt.Printf("peak[%d]: %x\n", i, peak)
+			if sealingKey == nil {
+				return errors.New("a sealer key is required, use --sealer-key, --sealer-key-pem or --generate-sealer-key")
 			}
 
-			alg, err := commoncose.CoseAlgForEC(sealingKey.PublicKey)
+			//
+			// The head checkpoint is sealed by the sealer key if the ledger
+			// has been appended to before, otherwise it is sealed by the key
+			// of the log it was forked from.
+			//
+			verifiers, err := appendVerifiers(cmd, cCtx, sealingKey)
 			if err != nil {
 				return err
 			}
 
-			coseSigner, err := cose.NewSigner(alg, sealingKey)
+			verified, started, err := ledgerAppendHead(ctx, store, &cmd.CBORCodec, verifiers)
 			if err != nil {
 				return err
 			}
-			identifiableSigner := &identifiableCoseSigner{
-				innerSigner: coseSigner,
-				publicKey:   sealingKey.PublicKey,
-			}
 
-			//
-			// Seal  a checkpoint for the locally forked ledger with a made up sealing key
-			// Receipts are rooted at a checkpoint accumulator state.
-			//
-			rootSigner := massifs.NewRootSigner("https://github.com/forestrie/veracity", cmd.CBORCodec)
+			mmrSizeOrig := verified.RangeCount()
+			fmt.Printf("%8d verified-size\n", mmrSizeOrig)
+			// verified.Tags = map[string]string{}
 
-			// TODO: account for filling a massif
-			mmrSizeCurrent := verified.RangeCount()
-			cp, err := mmr.IndexConsistencyProof(&verified.MassifContext, verified.MMRState.MMRSize-1, mmrSizeCurrent-1)
+			identifiableSigner, err := newIdentifiableCoseSigner(sealingKey, readSealerIdentity(cCtx))
 			if err != nil {
 				return err
 			}
-
-			// To create the checkpoint, we first check that the current state
-			// contains the previously verified state. This necessarily produces
-			// and verifies the new accumulator which we can then include with
-			// the new checkpoint.
-			ok, peaksB, err := mmr.CheckConsistency(
-				verified, sha256.New(),
-				cp.MMRSizeA, cp.MMRSizeB, verified.MMRState.Peaks)
-			if !ok {
-				return fmt.Errorf("consistency check failed: verify failed")
-			}
-			if err != nil {
+			if err = writeSealerJWKS(cCtx, identifiableSigner); err != nil {
 				return err
 			}
-			lastIDTimestamp := verified.GetLastIDTimestamp()
-
-			state := massifs.MMRState{
-				Version:         int(massifs.MMRStateVersionCurrent),
-				MMRSize:         mmrSizeCurrent,
-				Peaks:           peaksB,
-				Timestamp:       time.Now().UnixMilli(),
-				CommitmentEpoch: verified.MMRState.CommitmentEpoch,
-				IDTimestamp:     lastIDTimestamp,
-			}
 
 			//
-			// Read and decode the checkpoint
-			//
-			// Given a signed checkpoint, receipts can be self served for any
-			// element included in the MMR before that checkpoint.  Leaves from
-			// the massif corresponding to the massif need no other data.
-			// Leaves from earlier massifs *may* need the earlier massif, but
-			// often don't  (its deterministic and computable when and which
-			// earlier massifs are needed for an arbitrary mmrIndex)
-			//
-			// It is never necessary to have more than two massifs in order to
-			// produce a receipt against the latest checkpoint.
-			//
-			// There is no particular reason to re-fresh, or even save, receipts
-			// if you have a trustworthy store of checkpoints.
+			// Add a batch of statements, sealing each massif that is filled
+			// and starting the next.
 			//
-			mmrStatement := statements[0]
 			// A more appropriate subject would be the identity of the log ...
-			subject := fmt.Sprintf("fork-%d-%d.bin", verified.MMRState.MMRSize-1, mmrSizeCurrent)
-			publicKey, err := identifiableSigner.LatestPublicKey()
-			if err != nil {
-				return fmt.Errorf("unable to get public key for signing key %w", err)
-			}
-
-			keyIdentifier := identifiableSigner.KeyIdentifier()
-			data, err := rootSigner.Sign1(coseSigner, keyIdentifier, publicKey, subject, state, nil)
-			if err != nil {
-				return err
-			}
-
-			// note that state is not verified here, but we just signed it so it is our droid
-			msg, state, err := massifs.DecodeSignedRoot(cmd.CBORCodec, data)
+			subject := fmt.Sprintf("fork-%d", verified.MMRState.MMRSize)
+			appender := newLedgerAppender(cmd.CBORCodec, identifiableSigner, subject, verified)
+			statements, err := addStatements(cmd, cCtx, appender)
 			if err != nil {
 				return err
 			}
+			fmt.Printf("%d statements registered\n", len(statements))
 
 			//
-			// Generate the inclusion proof, note that we don't actually need
-			// the leaf hash to do this.  So *anyone* can obtain a receipt for
-			// *any* leaf at any time, given only the specific massif (tile)
-			// that leaf was registered in.  and its associated checkpoint.
+			// Seal  a checkpoint for the locally forked ledger with a made up sealing key
+			// Receipts are rooted at a checkpoint accumulator state.
 			//
-			proof, err := mmr.InclusionProof(&verified.MassifContext, state.MMRSize-1, mmrStatement.MMRIndexLeaf)
+			sealed, err := appender.Seal()
 			if err != nil {
-				return fmt.Errorf(
-					"failed to generating inclusion proof: %d in MMR(%d), %v",
-					mmrStatement.MMRIndexLeaf, verified.MMRState.MMRSize, err)
+				return err
+			}
+			head := sealed[len(sealed)-1]
+			for i, peak := range head.State.Peaks {
+				fmt.Printf("peak[%d]: %x\n", i, peak)
 			}
 
 			//
-			// Locate the pre-signed receipt for the accumulator peak containing the leaf.
+			// Make a receipt for each registered statement, and a manifest
+			// which relates each statement file to its leaf and receipt.
 			//
-			peakIndex := mmr.PeakIndex(mmr.LeafCount(state.MMRSize), len(proof))
-			// NOTE: The old-accumulator compatibility property, from
-			// https://eprint.iacr.org/2015/718.pdf, along with the COSE protected &
-			// unprotected buckets, is why we can just pre sign the receipts.
-			// As long as the receipt consumer is convinced of the logs consistency (not split view),
-			// it does not matter which accumulator state the receipt is signed against.
-
-			var peaksHeader massifs.MMRStateReceipts
-			err = cbor.Unmarshal(msg.Headers.RawUnprotected, &peaksHeader)
-			if err != nil {
-				return fmt.Errorf(
-					"%w: failed decoding peaks header", err)
-			}
-			if peakIndex >= len(peaksHeader.PeakReceipts) {
+			receiptFileName := cCtx.String("receipt-file")
+			if receiptFileName != "" && len(statements) > 1 {
 				return fmt.Errorf(
-					"%w: peaks header contains to few peak receipts", err)
-			}
+					"%w: --receipt-file can only be used when a single statement is registered, use --receipts-dir",
+					ErrRequiredOption)
+			}
+			manifest := AppendManifest{MMRSize: head.State.MMRSize}
+			receipts := make([][]byte, 0, len(statements))
+			for _, statement := range statements {
+				leafMassif, ok := appender.Sealed(statement.MMRIndexLeaf)
+				if !ok {
+					return fmt.Errorf("no massif was sealed for leaf %d", statement.MMRIndexLeaf)
+				}
+				receiptCbor, err := statementReceipt(cmd.CBORCodec, leafMassif, &statement.MMRStatement)
+				if err != nil {
+					return err
+				}
+				receipts = append(receipts, receiptCbor)
 
-			// This is an array of marshaled COSE_Sign1's
-			receiptMsg := peaksHeader.PeakReceipts[peakIndex]
-			signed, err := commoncose.NewCoseSign1MessageFromCBOR(
-				receiptMsg, commoncose.WithDecOptions(commoncbor.DecOptions))
-			if err != nil {
-				return fmt.Errorf(
-					"%w: failed to decode pre-signed receipt for MMR(%d)",
-					err, state.MMRSize)
+				fileName := receiptFileName
+				if fileName == "" {
+					fileName = filepath.Join(
+						cCtx.String("receipts-dir"), fmt.Sprintf("receipt-%d.cbor", statement.MMRIndexLeaf))
+				}
+				manifest.Statements = append(manifest.Statements, AppendManifestEntry{
+					StatementFile: statement.FileName,
+					StatementHash: fmt.Sprintf("%x", statement.Hash),
+					MMRIndex:      statement.MMRIndexLeaf,
+					IDTimestamp:   massifs.IDTimestampToHex(statement.IDTimestamp, uint8(leafMassif.State.CommitmentEpoch)),
+					LeafHash:      fmt.Sprintf("%x", statement.LeafHash),
+					ReceiptFile:   fileName,
+				})
 			}
 
-			// To avoid creating invalid receipts due to bugs in this demo code, check the root matches the appropriate peak.
-			root := mmr.IncludedRoot(sha256.New(), mmrStatement.MMRIndexLeaf, mmrStatement.LeafHash, proof)
-
-			if !bytes.Equal(root, peaksB[peakIndex]) {
-				return fmt.Errorf(
-					"%w: root %x of leaf %d in MMR(%d) does not match peak %d %x",
-					ErrVerifyInclusionFailed, root, mmrStatement.MMRIndexLeaf, state.MMRSize, peakIndex, state.Peaks[peakIndex])
+			manifestData, err := json.MarshalIndent(manifest, "", "  ")
+			if err != nil {
+				return err
 			}
 
 			//
-			// Make the MMR draft receipt by attaching the inclusion proof to the Unprotected header
+			// Write the updated massifs and their checkpoints back to the
+			// ledger. The receipts and manifest are only written once the
+			// ledger is committed, so they never refer to leaves which were
+			// not registered.
 			//
-			signed.Headers.RawUnprotected = nil
-
-			verifiableProofs := massifs.MMRiverVerifiableProofs{
-				InclusionProofs: []massifs.MMRiverInclusionProof{{
-					Index:         mmrStatement.MMRIndexLeaf,
-					InclusionPath: proof,
-				}},
+			if err = commitSealed(ctx, store, sealed, started); err != nil {
+				return err
 			}
-
-			tagOriginSubject := int64(-257)
-			tagOriginIssuer := tagOriginSubject - 1
-			tagLeafHash := tagOriginSubject - 2
-			tagIDTimestamp := tagOriginSubject - 3
-			tagExtraBytes := tagOriginSubject - 4
-
-			signed.Headers.Unprotected[massifs.VDSCoseReceiptProofsTag] = verifiableProofs
-			// these values would usually be provided by the application, or obtained directly from any replica.
-			// the unprotected headers are not signed, and are intended for this sort of convenience.
-			signed.Headers.Unprotected[tagOriginIssuer] = mmrStatement.Claims.Issuer
-			signed.Headers.Unprotected[tagOriginSubject] = mmrStatement.Claims.Subject
-			signed.Headers.Unprotected[tagIDTimestamp] = mmrStatement.IDTimestamp
-			signed.Headers.Unprotected[tagExtraBytes] = mmrStatement.ExtraBytes
-			signed.Headers.Unprotected[tagLeafHash] = mmrStatement.LeafHash
-			//
-			// Save the receipt to a file
-			//
-			receiptCbor, err := signed.MarshalCBOR()
-			if err != nil {
-				return fmt.Errorf("failed to marshal receipt: %w", err)
+			for _, s := range sealed {
+				fmt.Printf("wrote massif %d and checkpoint for MMR(%d)\n", s.Massif.Start.MassifIndex, s.State.MMRSize)
 			}
 
-			receiptFileName := cCtx.String("receipt-file")
-			if receiptFileName == "" {
-				receiptFileName = fmt.Sprintf("receipt-%d.cbor", mmrStatement.MMRIndexLeaf)
+			for i, entry := range manifest.Statements {
+				if err := os.WriteFile(entry.ReceiptFile, receipts[i], os.FileMode(0644)); err != nil {
+					return fmt.Errorf("failed to write receipt file %s: %w", entry.ReceiptFile, err)
+				}
+				fmt.Printf("wrote receipt file %s\n", entry.ReceiptFile)
 			}
-			if err := os.WriteFile(receiptFileName, receiptCbor, os.FileMode(0644)); err != nil {
-				return fmt.Errorf("failed to write receipt file %s: %w", receiptFileName, err)
+			manifestFileName := cCtx.String("manifest")
+			if err := os.WriteFile(manifestFileName, append(manifestData, '\n'), os.FileMode(0644)); err != nil {
+				return fmt.Errorf("failed to write manifest file %s: %w", manifestFileName, err)
 			}
-			fmt.Printf("wrote receipt file %s\n", receiptFileName)
+			fmt.Printf("wrote manifest file %s\n", manifestFileName)
 
-			//
-			// A bunch of persistence conveniences for the sake of the demo
-			//
-
-			forkFileName := filepath.Join(".", fmt.Sprintf("fork-%d-%d.bin", verified.MMRState.MMRSize-1, mmrSizeCurrent))
-			if err := os.WriteFile(forkFileName, data, os.FileMode(0644)); err != nil {
-				return fmt.Errorf("failed to write log fork file %s: %w", forkFileName, err)
-			}
-			fmt.Printf("wrote forked log massif file %s\n", forkFileName)
-
-			checkpointFileName := filepath.Join(".", fmt.Sprintf("checkpoint-%d.cbor", mmrSizeCurrent))
-			if err := os.WriteFile(checkpointFileName, data, os.FileMode(0644)); err != nil {
-				return fmt.Errorf("failed to write checkpoint file %s: %w", checkpointFileName, err)
-			}
-			fmt.Printf("wrote checkpoint file %s\n", checkpointFileName)
 			if cCtx.Bool("generate-sealer-key") {
-				// write the sealer key to the sealer-key file
-				sealerKeyFile := cCtx.String("sealer-key")
-				if sealerKeyFile == "" {
-					sealerKeyFile = keyio.ECDSAPrivateDefaultFileName
-				}
-				if _, err := keyio.WriteECDSAPrivateCOSE(sealerKeyFile, sealingKey); err != nil {
-					return fmt.Errorf("failed to write sealer key to file %s: %w", sealerKeyFile, err)
-				}
-				fmt.Printf("wrote sealer key to file %s\n", sealerKeyFile)
-				sealerKeyFile = cCtx.String("sealer-key-pem")
-				if sealerKeyFile == "" {
-					sealerKeyFile = keyio.ECDSAPrivateDefaultPEMFileName
-				}
-				if err := keyio.WriteECDSAPrivatePEM(sealerKeyFile, sealingKey); err != nil {
-					return fmt.Errorf("failed to write sealer key to file %s: %w", sealerKeyFile, err)
-				}
-				fmt.Printf("wrote sealer key to file %s\n", sealerKeyFile)
-
-				sealerKeyFile = cCtx.String("sealer-public-key-pem")
-				if sealerKeyFile == "" {
-					sealerKeyFile = keyio.ECDSAPublicDefaultPEMFileName
-				}
-				if _, err := keyio.WriteCoseECDSAPublicKey(sealerKeyFile, &sealingKey.PublicKey); err != nil {
-					return fmt.Errorf("failed to write sealer key to file %s: %w", sealerKeyFile, err)
+				if err = writeGeneratedSealerKey(cCtx, sealingKey); err != nil {
+					return err
 				}
-				fmt.Printf("wrote sealer public key to file %s\n", sealerKeyFile)
 			}
 			return nil
 		},
 	}
 }
 
-// addStatements adds the signed statements to the massif and returns the leaf
-// indices of the added statements.
+// writeGeneratedSealerKey writes the private key in COSE and PEM formats,
+// and the public key in PEM format. The default file names depend on the key
+// type.
+func writeGeneratedSealerKey(cCtx *cli.Context, sealingKey crypto.Signer) error {
+	privateFile, privatePEMFile, publicPEMFile := keyio.ECDSAPrivateDefaultFileName, keyio.ECDSAPrivateDefaultPEMFileName, keyio.ECDSAPublicDefaultPEMFileName
+	if _, ok := sealingKey.(ed25519.PrivateKey); ok {
+		privateFile, privatePEMFile, publicPEMFile = keyio.Ed25519PrivateDefaultFileName, keyio.Ed25519PrivateDefaultPEMFileName, keyio.Ed25519PublicDefaultPEMFileName
+	}
+
+	sealerKeyFile := cmp.Or(cCtx.String("sealer-key"), privateFile)
+	if err := keyio.WritePrivateCOSE(sealerKeyFile, sealingKey); err != nil {
+		return fmt.Errorf("failed to write sealer key to file %s: %w", sealerKeyFile, err)
+	}
+	fmt.Printf("wrote sealer key to file %s\n", sealerKeyFile)
+
+	sealerKeyFile = cmp.Or(cCtx.String("sealer-key-pem"), privatePEMFile)
+	if err := keyio.WritePrivatePEM(sealerKeyFile, sealingKey); err != nil {
+		return fmt.Errorf("failed to write sealer key to file %s: %w", sealerKeyFile, err)
+	}
+	fmt.Printf("wrote sealer key to file %s\n", sealerKeyFile)
+
+	sealerKeyFile = cmp.Or(cCtx.String("sealer-public-key-pem"), publicPEMFile)
+	if err := keyio.WritePublicPEM(sealerKeyFile, sealingKey.Public()); err != nil {
+		return fmt.Errorf("failed to write sealer key to file %s: %w", sealerKeyFile, err)
+	}
+	fmt.Printf("wrote sealer public key to file %s\n", sealerKeyFile)
+	return nil
+}
+
+// addStatements adds the signed statements to the ledger and returns the
+// added statements, with their leaf indices and the files they were read from.
 // If a specific statement is specified via --signed-statement, then it is
 // added first. THose discovered from --statement-dir are added in lexical
 // filename order.
-func addStatements(cmd *CmdCtx, cCtx *cli.Context, massif *massifs.MassifContext) ([]scitt.MMRStatement, error) {
+func addStatements(cmd *CmdCtx, cCtx *cli.Context, appender *ledgerAppender) ([]appendedStatement, error) {
 	var fileNames []string
-	var statements []scitt.MMRStatement
+	var statements []appendedStatement
 
 	if cCtx.String("signed-statement") != "" {
 		fileNames = append(fileNames, cCtx.String("signed-statement"))
@@ -472,26 +546,15 @@ func addStatements(cmd *CmdCtx, cCtx *cli.Context, massif *massifs.MassifContext
 	for _, fileName := range fileNames {
 		mmrStatement, err := readStatementFromFile(fileName, cmd)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read signed statement from file %s: %w", cCtx.String("signed-statement"), err)
+			return nil, fmt.Errorf("failed to read signed statement from file %s: %w", fileName, err)
 		}
 
-		// the *next* index to be added is the current *count*
-		mmrStatement.MMRIndexLeaf = massif.RangeCount()
-
-		_, err = massif.AddHashedLeaf(
-			sha256.New(),
-			mmrStatement.IDTimestamp,
-			mmrStatement.ExtraBytes,
-			// use the issuer as the origin log id, which isn't quite right, but is close enough for this demo
-			[]byte(mmrStatement.Claims.Issuer),
-			[]byte("scitt"),
-			mmrStatement.LeafHash,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to add hashed leaf: %w", err)
+		if err = appender.Add(mmrStatement); err != nil {
+			return nil, err
 		}
+		massif := appender.head
 
-		statements = append(statements, *mmrStatement)
+		statements = append(statements, appendedStatement{FileName: fileName, MMRStatement: *mmrStatement})
 
 		fmt.Printf("index             : %d\n", mmrStatement.MMRIndexLeaf)
 		fmt.Printf(" issuer           : %s\n", mmrStatement.Claims.Issuer)
@@ -500,37 +563,176 @@ func addStatements(cmd *CmdCtx, cCtx *cli.Context, massif *massifs.MassifContext
 		fmt.Printf(" leaf-hash        : %x\n", mmrStatement.LeafHash)
 		fmt.Printf(" statement-hash   : %x\n", mmrStatement.Hash)
 		fmt.Printf(" node count       : %d\n", (len(massif.Data)-int(massif.LogStart()))/32)
-
-		value, err := massif.Get(mmrStatement.MMRIndexLeaf)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get leaf value for index %d: %w", mmrStatement.MMRIndexLeaf, err)
-		}
-		if !bytes.Equal(value, mmrStatement.LeafHash) {
-			// this will mean a bug in the hacked up code if it catches
-			return nil, fmt.Errorf("leaf hash %x does not match expected value %x for index %d",
-				value, mmrStatement.LeafHash, mmrStatement.MMRIndexLeaf)
-		}
 	}
 	return statements, nil
 }
 
+// addStatement adds the leaf for the statement to the massif, and sets the
+// leaf index on the statement.
+func addStatement(massif *massifs.MassifContext, mmrStatement *scitt.MMRStatement) error {
+
+	// the *next* index to be added is the current *count*
+	mmrStatement.MMRIndexLeaf = massif.RangeCount()
+
+	_, err := massif.AddHashedLeaf(
+		sha256.New(),
+		mmrStatement.IDTimestamp,
+		mmrStatement.ExtraBytes,
+		// use the issuer as the origin log id, which isn't quite right, but is close enough for this demo
+		[]byte(mmrStatement.Claims.Issuer),
+		[]byte("scitt"),
+		mmrStatement.LeafHash,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add hashed leaf: %w", err)
+	}
+
+	value, err := massif.Get(mmrStatement.MMRIndexLeaf)
+	if err != nil {
+		return fmt.Errorf("failed to get leaf value for index %d: %w", mmrStatement.MMRIndexLeaf, err)
+	}
+	if !bytes.Equal(value, mmrStatement.LeafHash) {
+		// this will mean a bug in the hacked up code if it catches
+		return fmt.Errorf("leaf hash %x does not match expected value %x for index %d",
+			value, mmrStatement.LeafHash, mmrStatement.MMRIndexLeaf)
+	}
+	return nil
+}
+
+// statementReceipt makes the receipt for a registered statement, against
+// the checkpoint of the massif the statement leaf was added to.
+//
+// Given a signed checkpoint, receipts can be self served for any element
+// included in the MMR before that checkpoint.  Leaves from the massif
+// corresponding to the checkpoint need no other data. Leaves from earlier
+// massifs *may* need the earlier massif, but often don't  (its deterministic
+// and computable when and which earlier massifs are needed for an arbitrary
+// mmrIndex)
+//
+// It is never necessary to have more than two massifs in order to produce a
+// receipt against the latest checkpoint.
+//
+// There is no particular reason to re-fresh, or even save, receipts if you
+// have a trustworthy store of checkpoints.
+func statementReceipt(
+	codec commoncbor.CBORCodec, leafMassif sealedMassif, mmrStatement *scitt.MMRStatement,
+) ([]byte, error) {
+
+	msg, state, err := massifs.DecodeSignedRoot(codec, leafMassif.Checkpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	//
+	// Generate the inclusion proof, note that we don't actually need the leaf
+	// hash to do this.  So *anyone* can obtain a receipt for *any* leaf at any
+	// time, given only the specific massif (tile) that leaf was registered in.
+	// and its associated checkpoint.
+	//
+	proof, err := mmr.InclusionProof(&leafMassif.Massif, state.MMRSize-1, mmrStatement.MMRIndexLeaf)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to generating inclusion proof: %d in MMR(%d), %v",
+			mmrStatement.MMRIndexLeaf, state.MMRSize, err)
+	}
+
+	//
+	// Locate the pre-signed receipt for the accumulator peak containing the leaf.
+	//
+	peakIndex := mmr.PeakIndex(mmr.LeafCount(state.MMRSize), len(proof))
+	// NOTE: The old-accumulator compatibility property, from
+	// https://eprint.iacr.org/2015/718.pdf, along with the COSE protected &
+	// unprotected buckets, is why we can just pre sign the receipts.
+	// As long as the receipt consumer is convinced of the logs consistency (not split view),
+	// it does not matter which accumulator state the receipt is signed against.
+
+	var peaksHeader massifs.MMRStateReceipts
+	err = cbor.Unmarshal(msg.Headers.RawUnprotected, &peaksHeader)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"%w: failed decoding peaks header", err)
+	}
+	if peakIndex >= len(peaksHeader.PeakReceipts) {
+		return nil, fmt.Errorf(
+			"%w: peaks header contains to few peak receipts", err)
+	}
+
+	// This is an array of marshaled COSE_Sign1's
+	receiptMsg := peaksHeader.PeakReceipts[peakIndex]
+	signed, err := commoncose.NewCoseSign1MessageFromCBOR(
+		receiptMsg, commoncose.WithDecOptions(commoncbor.DecOptions))
+	if err != nil {
+		return nil, fmt.Errorf(
+			"%w: failed to decode pre-signed receipt for MMR(%d)",
+			err, state.MMRSize)
+	}
+
+	// To avoid creating invalid receipts due to bugs in this demo code, check the root matches the appropriate peak.
+	root := mmr.IncludedRoot(sha256.New(), mmrStatement.MMRIndexLeaf, mmrStatement.LeafHash, proof)
+
+	if !bytes.Equal(root, leafMassif.State.Peaks[peakIndex]) {
+		return nil, fmt.Errorf(
+			"%w: root %x of leaf %d in MMR(%d) does not match peak %d %x",
+			ErrVerifyInclusionFailed, root, mmrStatement.MMRIndexLeaf, state.MMRSize, peakIndex, leafMassif.State.Peaks[peakIndex])
+	}
+
+	//
+	// Make the MMR draft receipt by attaching the inclusion proof to the Unprotected header
+	//
+	signed.Headers.RawUnprotected = nil
+
+	verifiableProofs := massifs.MMRiverVerifiableProofs{
+		InclusionProofs: []massifs.MMRiverInclusionProof{{
+			Index:         mmrStatement.MMRIndexLeaf,
+			InclusionPath: proof,
+		}},
+	}
+
+	signed.Headers.Unprotected[massifs.VDSCoseReceiptProofsTag] = verifiableProofs
+	// these values would usually be provided by the application, or obtained directly from any replica.
+	// the unprotected headers are not signed, and are intended for this sort of convenience.
+	signed.Headers.Unprotected[receiptTagOriginIssuer] = mmrStatement.Claims.Issuer
+	signed.Headers.Unprotected[receiptTagOriginSubject] = mmrStatement.Claims.Subject
+	signed.Headers.Unprotected[receiptTagIDTimestamp] = mmrStatement.IDTimestamp
+	signed.Headers.Unprotected[receiptTagExtraBytes] = mmrStatement.ExtraBytes
+	signed.Headers.Unprotected[receiptTagLeafHash] = mmrStatement.LeafHash
+
+	receiptCbor, err := signed.MarshalCBOR()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal receipt: %w", err)
+	}
+	return receiptCbor, nil
+}
+
 func readStatementFromFile(fileName string, cmd *CmdCtx) (*scitt.MMRStatement, error) {
-	mmrStatement, cpd, err := scitt.NewMMRStatementFromFile(fileName, cmd, scitt.RegistrationPolicyVerified())
+	content, err := os.ReadFile(fileName)
 	if err != nil {
-		if cpd != nil && cpd.Instance != scitt.ProblemInstanceConfirmationMissing {
-			return nil, fmt.Errorf("%w: failed reading and checking signed statement: %s", err, cpd.Detail)
-		}
-		// for demo purposes, because we do not support x509
-		mmrStatement, cpd, err = scitt.NewMMRStatementFromFile(fileName, cmd, scitt.RegistrationPolicyUnverified())
-		if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", fileName, err)
+	}
+	mmrStatement, cpd, err := newMMRStatement(content, cmd)
+	if err != nil {
+		if cpd != nil {
 			return nil, fmt.Errorf("%w: failed reading and checking signed statement: %s", err, cpd.Detail)
 		}
-		err = nil
-		cpd = nil
+		return nil, err
 	}
 	return mmrStatement, nil
 }
 
+// newMMRStatement checks the signed statement against the verified
+// registration policy. For demo purposes, because we do not support x509,
+// statements without a confirmation key are accepted unverified.
+func newMMRStatement(content []byte, cmd *CmdCtx) (*scitt.MMRStatement, *scitt.ConciseProblemDetails, error) {
+	mmrStatement, cpd, err := scitt.NewMMRStatement(content, cmd, scitt.RegistrationPolicyVerified())
+	if err == nil {
+		return mmrStatement, nil, nil
+	}
+	if cpd == nil || cpd.Instance != scitt.ProblemInstanceConfirmationMissing {
+		return nil, cpd, err
+	}
+	return scitt.NewMMRStatement(content, cmd, scitt.RegistrationPolicyUnverified())
+}
+
 func listFilesWithSuffix(dir, suffix string) ([]string, error) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
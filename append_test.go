@@ -0,0 +1,181 @@
+package veracity
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/datatrails/veracity/keyio"
+	"github.com/datatrails/veracity/scitt"
+	"github.com/forestrie/go-merklelog/massifs"
+	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	commoncose "github.com/forestrie/go-merklelog/massifs/cose"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func TestStatementReceipt(t *testing.T) {
+	ctx := context.Background()
+	store, codec, signer, verifier := newTestLog(t, newTestKey(t), 2)
+	verified, err := massifs.GetContextVerified(ctx, store, &codec, verifier, 0)
+	require.NoError(t, err)
+
+	// A batch which spans two massifs gets a receipt for every statement
+	appender := newLedgerAppender(codec, signer, "test", verified)
+	var statements []*scitt.MMRStatement
+	for i := range 3 {
+		statement := testStatement(i)
+		require.NoError(t, appender.Add(statement))
+		statements = append(statements, statement)
+	}
+	_, err = appender.Seal()
+	require.NoError(t, err)
+
+	for _, statement := range statements {
+		leafMassif, ok := appender.Sealed(statement.MMRIndexLeaf)
+		require.True(t, ok)
+		data, err := statementReceipt(codec, leafMassif, statement)
+		require.NoError(t, err)
+
+		decoded, err := commoncose.NewCoseSign1MessageFromCBOR(data, commoncose.WithDecOptions(commoncbor.DecOptions))
+		require.NoError(t, err)
+		ok, _, err = massifs.VerifySignedInclusionReceipt(ctx, decoded, statement.LeafHash)
+		require.NoError(t, err)
+		assert.True(t, ok, "leaf %d", statement.MMRIndexLeaf)
+	}
+}
+
+func TestSealerIdentity(t *testing.T) {
+	ctx := context.Background()
+	codec, err := massifs.NewCBORCodec()
+	require.NoError(t, err)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	identity := sealerIdentity{Issuer: "https://ledger.example", KeyLocation: "https://ledger.example/jwks.json"}
+	signer, err := newIdentifiableCoseSigner(key, identity)
+	require.NoError(t, err)
+
+	// The kid defaults to the RFC 7638 thumbprint of the key
+	jwk, err := signer.JWK()
+	require.NoError(t, err)
+	thumbprint, err := keyio.JWKThumbprint(jwk)
+	require.NoError(t, err)
+	assert.Equal(t, thumbprint, jwk.Kid)
+	assert.Equal(t, thumbprint, signer.KeyIdentifier())
+	assert.Equal(t, identity.KeyLocation, signer.KeyLocation())
+
+	store := newMemoryReader()
+	_, err = initLog(ctx, store, codec, signer, MassifFormatOptions{MassifHeight: 2, CommitmentEpoch: 1}, "test")
+	require.NoError(t, err)
+
+	// The exported key set verifies the checkpoint
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, keyio.WriteJWKS(jwksFile, jwk))
+	pub, err := keyio.ReadECDSAPublicJOSE(jwksFile)
+	require.NoError(t, err)
+	verifier, err := cose.NewVerifier(pub.Alg, pub.Public)
+	require.NoError(t, err)
+	verified, err := massifs.GetContextVerified(ctx, store, &codec, verifier, 0)
+	require.NoError(t, err)
+
+	appender := newLedgerAppender(codec, signer, "test", verified)
+	statement := testStatement(0)
+	require.NoError(t, appender.Add(statement))
+	_, err = appender.Seal()
+	require.NoError(t, err)
+	leafMassif, ok := appender.Sealed(statement.MMRIndexLeaf)
+	require.True(t, ok)
+
+	// The issuer and kid are in the checkpoint and the receipts
+	for _, data := range [][]byte{leafMassif.Checkpoint, mustStatementReceipt(t, codec, leafMassif, statement)} {
+		msg, err := commoncose.NewCoseSign1MessageFromCBOR(data, commoncose.WithDecOptions(commoncbor.DecOptions))
+		require.NoError(t, err)
+		claims, err := msg.CWTClaimsFromProtectedHeader()
+		require.NoError(t, err)
+		assert.Equal(t, identity.Issuer, claims.Issuer)
+		assert.Equal(t, thumbprint, string(claims.ConfirmationMethod.KeyID()))
+	}
+}
+
+func TestSealerKeyTypes(t *testing.T) {
+	ctx := context.Background()
+	codec, err := massifs.NewCBORCodec()
+	require.NoError(t, err)
+
+	for _, keyType := range []string{keyio.KeyTypeP384, keyio.KeyTypeP521, keyio.KeyTypeEd25519} {
+		t.Run(keyType, func(t *testing.T) {
+			key, err := keyio.GenerateKey(keyType)
+			require.NoError(t, err)
+
+			// The key survives a round trip through the COSE and PEM formats
+			dir := t.TempDir()
+			require.NoError(t, keyio.WritePrivateCOSE(filepath.Join(dir, "key.cbor"), key))
+			require.NoError(t, keyio.WritePrivatePEM(filepath.Join(dir, "key.pem"), key))
+			require.NoError(t, keyio.WritePublicPEM(filepath.Join(dir, "key-public.pem"), key.Public()))
+			fromCOSE, err := keyio.ReadPrivateCOSE(filepath.Join(dir, "key.cbor"))
+			require.NoError(t, err)
+			fromPEM, err := keyio.ReadPrivatePEM(filepath.Join(dir, "key.pem"))
+			require.NoError(t, err)
+			publicFromPEM, err := keyio.ReadPublicPEM(filepath.Join(dir, "key-public.pem"))
+			require.NoError(t, err)
+			assert.True(t, fromCOSE.Private.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(key.Public()))
+			assert.True(t, fromPEM.Private.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(key.Public()))
+			assert.Equal(t, fromCOSE.Alg, publicFromPEM.Alg)
+
+			signer, err := newIdentifiableCoseSigner(fromCOSE.Private, sealerIdentity{})
+			require.NoError(t, err)
+
+			// The exported key set verifies the checkpoints and the receipts
+			jwk, err := signer.JWK()
+			require.NoError(t, err)
+			jwksFile := filepath.Join(dir, "jwks.json")
+			require.NoError(t, keyio.WriteJWKS(jwksFile, jwk))
+			pub, err := keyio.ReadPublicJOSE(jwksFile)
+			require.NoError(t, err)
+			verifier, err := cose.NewVerifier(pub.Alg, pub.Public)
+			require.NoError(t, err)
+
+			store := newMemoryReader()
+			_, err = initLog(ctx, store, codec, signer, MassifFormatOptions{MassifHeight: 2, CommitmentEpoch: 1}, "test")
+			require.NoError(t, err)
+			verified, err := massifs.GetContextVerified(ctx, store, &codec, verifier, 0)
+			require.NoError(t, err)
+
+			appender := newLedgerAppender(codec, signer, "test", verified)
+			var statements []*scitt.MMRStatement
+			for i := range 3 {
+				statement := testStatement(i)
+				require.NoError(t, appender.Add(statement))
+				statements = append(statements, statement)
+			}
+			sealed, err := appender.Seal()
+			require.NoError(t, err)
+			require.NoError(t, commitSealed(ctx, store, sealed, false))
+
+			head, _, err := ledgerHead(ctx, store)
+			require.NoError(t, err)
+			_, err = massifs.GetContextVerified(ctx, store, &codec, verifier, head)
+			require.NoError(t, err)
+
+			for _, statement := range statements {
+				leafMassif, ok := appender.Sealed(statement.MMRIndexLeaf)
+				require.True(t, ok)
+				receipt, header, err := decodeReceipt(mustStatementReceipt(t, codec, leafMassif, statement))
+				require.NoError(t, err)
+				_, err = verifyReceipt(receipt, header, statement.LeafHash, verifier)
+				assert.NoError(t, err, "leaf %d", statement.MMRIndexLeaf)
+			}
+		})
+	}
+}
+
+func mustStatementReceipt(t *testing.T, codec commoncbor.CBORCodec, leafMassif sealedMassif, statement *scitt.MMRStatement) []byte {
+	data, err := statementReceipt(codec, leafMassif, statement)
+	require.NoError(t, err)
+	return data
+}
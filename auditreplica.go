@@ -0,0 +1,283 @@
+package veracity
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/massifs"
+	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/urfave/cli/v2"
+	"github.com/veraison/go-cose"
+)
+
+var (
+	ErrAuditFailed = errors.New("the replica failed the audit")
+)
+
+// ReplicaAudit totals what an audit of a replica checked
+type ReplicaAudit struct {
+	Massifs     uint32
+	Nodes       uint64
+	Checkpoints uint32
+	MMRSize     uint64
+}
+
+// NewAuditReplicaCmd re-verifies a local replica from massif 0
+func NewAuditReplicaCmd() *cli.Command {
+	return &cli.Command{
+		Name: "audit-replica",
+		Usage: `re-verify a local replica of a log, from the first massif to the last.
+
+Every interior node is recomputed from its children, the ancestor peaks carried by each massif are checked against the massif that precedes it,
+each checkpoint signature is verified and the data it seals is checked. Each checkpoint is also checked for consistency with the checkpoint before it.
+The first bad massif, node or checkpoint is reported. Massifs removed by prune are not expected to be present.`,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:    "replicadir",
+				Usage:   `the root directory for all tenant log replicas, as used with replicate-logs`,
+				Aliases: []string{"d"},
+				Value:   ".",
+			},
+		}, checkpointKeyFlags()...),
+		Action: func(cCtx *cli.Context) error {
+			var err error
+			cmd := &CmdCtx{}
+			ctx := cCtx.Context
+
+			if err = cfgLogging(cmd, cCtx); err != nil {
+				return err
+			}
+			if err = CfgKeys(cmd, cCtx); err != nil {
+				return err
+			}
+			if len(cmd.CheckpointKeys.Keys) == 0 {
+				return errors.New("checkpoint public key is required")
+			}
+			verifier, err := checkpointVerifier(cmd)
+			if err != nil {
+				return err
+			}
+			if err = cfgMassifFmt(cmd, cCtx); err != nil {
+				return err
+			}
+
+			logID := CtxGetOneLogOption(cCtx)
+			if logID == nil {
+				return fmt.Errorf("a tenant or logid is required for this command")
+			}
+
+			reader, err := NewCmdStorageProviderFS(ctx, cCtx, cmd, cCtx.String("replicadir"), false)
+			if err != nil {
+				return err
+			}
+			if err = reader.SelectLog(ctx, logID); err != nil {
+				return fmt.Errorf("failed to select local log %s: %w", logID, err)
+			}
+
+			// Massifs removed by prune are not expected to be present
+			manifest, err := readPruneManifest(cCtx.String("replicadir"), logID)
+			if err != nil {
+				return err
+			}
+			if manifest.FirstMassif > 0 {
+				fmt.Printf("massifs before %d were pruned, auditing from massif %d\n", manifest.FirstMassif, manifest.FirstMassif)
+			}
+
+			audit, err := auditReplica(ctx, reader, &cmd.CBORCodec, verifier, manifest.FirstMassif)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("OK|%d massifs|%d checkpoints|%d nodes|mmrsize %d\n",
+				audit.Massifs, audit.Checkpoints, audit.Nodes, audit.MMRSize)
+			return nil
+		},
+	}
+}
+
+// auditReplica checks every massif and checkpoint of the selected log from
+// firstMassif, stopping at the first problem found. The ancestor peaks of
+// firstMassif can not be checked, there is no preceding massif.
+func auditReplica(
+	ctx context.Context, reader massifs.ObjectReader,
+	codec *commoncbor.CBORCodec, verifier cose.Verifier, firstMassif uint32,
+) (ReplicaAudit, error) {
+
+	var audit ReplicaAudit
+
+	headIndex, err := reader.HeadIndex(ctx, storage.ObjectMassifData)
+	if err != nil {
+		return audit, fmt.Errorf("failed to get head massif index: %w", err)
+	}
+
+	var prev *massifs.MassifContext
+	var prevState *massifs.MMRState
+
+	for massifIndex := firstMassif; massifIndex <= headIndex; massifIndex++ {
+		if err = ctx.Err(); err != nil {
+			return audit, err
+		}
+
+		mc, err := massifs.GetMassifContext(ctx, reader, massifIndex)
+		if err != nil {
+			return audit, fmt.Errorf("%w: massif %d: %v", ErrAuditFailed, massifIndex, err)
+		}
+
+		if err = auditAncestorPeaks(prev, &mc); err != nil {
+			return audit, fmt.Errorf("%w: massif %d: %v", ErrAuditFailed, massifIndex, err)
+		}
+
+		nodes, err := auditInteriorNodes(&mc)
+		if err != nil {
+			return audit, fmt.Errorf("%w: massif %d: %v", ErrAuditFailed, massifIndex, err)
+		}
+		audit.Nodes += nodes
+
+		// The checkpoint signature is verified, and the massif data is
+		// checked against the state it seals.
+		verified, err := auditCheckpoint(ctx, reader, codec, verifier, massifIndex, &mc)
+		if err != nil {
+			return audit, fmt.Errorf("%w: checkpoint %d: %v", ErrAuditFailed, massifIndex, err)
+		}
+		audit.Checkpoints++
+
+		if prevState != nil {
+			if err = auditCheckpointConsistency(prev, &mc, *prevState, verified.MMRState); err != nil {
+				return audit, fmt.Errorf("%w: checkpoint %d: %v", ErrAuditFailed, massifIndex, err)
+			}
+		}
+
+		state := verified.MMRState
+		prevState = &state
+		prev = &mc
+		audit.Massifs++
+		audit.MMRSize = mc.RangeCount()
+	}
+	return audit, nil
+}
+
+// auditCheckpoint verifies the checkpoint for the massif, and checks the
+// massif data in mc, which has already been read, against the state it seals.
+func auditCheckpoint(
+	ctx context.Context, reader massifs.ObjectReader,
+	codec *commoncbor.CBORCodec, verifier cose.Verifier, massifIndex uint32, mc *massifs.MassifContext,
+) (*massifs.VerifiedContext, error) {
+	verifier, check, err := checkpointVerifierFor(ctx, reader, codec, verifier, massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	return mc.VerifyContext(ctx, massifs.VerifyOptions{
+		Check:        check,
+		CBORCodec:    codec,
+		COSEVerifier: verifier,
+	})
+}
+
+// auditAncestorPeaks checks the ancestor peaks carried forward in the peak
+// stack of mc match the nodes of the preceding massif. The preceding massif
+// has already been audited, including its own peak stack, so it can provide
+// every ancestor peak.
+func auditAncestorPeaks(prev *massifs.MassifContext, mc *massifs.MassifContext) error {
+	if prev == nil {
+		return nil
+	}
+	for i := range mc.PeakStackMap {
+		want, err := prev.Get(i)
+		if err != nil {
+			return fmt.Errorf("ancestor peak %d: %v", i, err)
+		}
+		got, err := mc.Get(i)
+		if err != nil {
+			return fmt.Errorf("ancestor peak %d: %v", i, err)
+		}
+		if !bytes.Equal(want, got) {
+			return fmt.Errorf("ancestor peak %d does not match the preceding massif", i)
+		}
+	}
+	return nil
+}
+
+// auditInteriorNodes recomputes every interior node in the massif from its
+// children and returns the number of nodes checked. Leaf values can not be
+// recomputed without the application data, and are checked only by the
+// nodes that commit to them.
+func auditInteriorNodes(mc *massifs.MassifContext) (uint64, error) {
+	hasher := sha256.New()
+	var count uint64
+	for i := mc.Start.FirstIndex; i < mc.RangeCount(); i++ {
+		count++
+		height := mmr.IndexHeight(i)
+		if height == 0 {
+			continue
+		}
+		left, err := mc.Get(i - (uint64(1) << height))
+		if err != nil {
+			return count, fmt.Errorf("node %d: %v", i, err)
+		}
+		right, err := mc.Get(i - 1)
+		if err != nil {
+			return count, fmt.Errorf("node %d: %v", i, err)
+		}
+		value, err := mc.Get(i)
+		if err != nil {
+			return count, fmt.Errorf("node %d: %v", i, err)
+		}
+		if !bytes.Equal(value, mmr.HashPosPair64(hasher, i+1, left, right)) {
+			return count, fmt.Errorf("node %d is not the hash of its children", i)
+		}
+	}
+	return count, nil
+}
+
+// auditCheckpointConsistency checks the state sealed for massif mc is
+// consistent with the state sealed for the preceding massif.
+func auditCheckpointConsistency(
+	prev *massifs.MassifContext, mc *massifs.MassifContext,
+	prevState massifs.MMRState, state massifs.MMRState,
+) error {
+	if prevState.Version == int(massifs.MMRStateVersion0) || state.Version == int(massifs.MMRStateVersion0) {
+		// Version 0 checkpoints seal a bagged root, the massif data check
+		// made by GetContextVerified is the only check available.
+		return nil
+	}
+	if state.MMRSize < prevState.MMRSize {
+		return fmt.Errorf("the sealed size %d is smaller than the preceding sealed size %d", state.MMRSize, prevState.MMRSize)
+	}
+
+	store := &massifPairStore{prev: prev, cur: mc}
+	ok, peaks, err := mmr.CheckConsistency(store, sha256.New(), prevState.MMRSize, state.MMRSize, prevState.Peaks)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("the sealed state %d is not consistent with the preceding sealed state %d", state.MMRSize, prevState.MMRSize)
+	}
+	if len(peaks) != len(state.Peaks) {
+		return fmt.Errorf("the sealed peaks do not match the log for size %d", state.MMRSize)
+	}
+	for i := range peaks {
+		if !bytes.Equal(peaks[i], state.Peaks[i]) {
+			return fmt.Errorf("the sealed peak %d does not match the log for size %d", i, state.MMRSize)
+		}
+	}
+	return nil
+}
+
+// massifPairStore provides the nodes of a massif and the massif that
+// precedes it. Between them, they hold every node needed to prove the sealed
+// state of one is consistent with the sealed state of the other.
+type massifPairStore struct {
+	prev *massifs.MassifContext
+	cur  *massifs.MassifContext
+}
+
+func (s *massifPairStore) Get(i uint64) ([]byte, error) {
+	if i >= s.cur.Start.FirstIndex || s.prev == nil {
+		return s.cur.Get(i)
+	}
+	return s.prev.Get(i)
+}
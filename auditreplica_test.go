@@ -0,0 +1,75 @@
+package veracity
+
+import (
+	"context"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditReplica(t *testing.T) {
+	ctx := context.Background()
+
+	// Height 3 massifs have 4 leaves. Massif 1 ends with node 14, which is
+	// the ancestor peak carried by massif 2.
+	massifContext := func(t *testing.T, store *memoryReader, massifIndex uint32) massifs.MassifContext {
+		mc, err := massifs.GetMassifContext(ctx, store, massifIndex)
+		require.NoError(t, err)
+		return mc
+	}
+
+	t.Run("good replica", func(t *testing.T) {
+		store, codec, verifier, _ := newTestLedger(t, 3, 12)
+		audit, err := auditReplica(ctx, store, &codec, verifier, 0)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(3), audit.Massifs)
+		assert.Equal(t, uint32(3), audit.Checkpoints)
+		assert.Equal(t, uint64(22), audit.MMRSize)
+		assert.Equal(t, uint64(22), audit.Nodes)
+	})
+
+	// Node 13 commits to node 9, so also fails, but node 9 is the first bad
+	// node
+	t.Run("interior node", func(t *testing.T) {
+		store, codec, verifier, _ := newTestLedger(t, 3, 12)
+		mc := massifContext(t, store, 1)
+		store.massifs[1][mc.LogStart()+(9-mc.Start.FirstIndex)*massifs.ValueBytes] ^= 1
+
+		_, err := auditReplica(ctx, store, &codec, verifier, 0)
+		assert.ErrorIs(t, err, ErrAuditFailed)
+		assert.ErrorContains(t, err, "massif 1: node 9 is not the hash of its children")
+	})
+
+	t.Run("ancestor peak", func(t *testing.T) {
+		store, codec, verifier, _ := newTestLedger(t, 3, 12)
+		mc := massifContext(t, store, 2)
+		require.Contains(t, mc.PeakStackMap, uint64(14))
+		store.massifs[2][mc.PeakStackStart()] ^= 1
+
+		_, err := auditReplica(ctx, store, &codec, verifier, 0)
+		assert.ErrorIs(t, err, ErrAuditFailed)
+		assert.ErrorContains(t, err, "massif 2: ancestor peak 14 does not match the preceding massif")
+	})
+
+	t.Run("checkpoint", func(t *testing.T) {
+		store, codec, verifier, _ := newTestLedger(t, 3, 12)
+		checkpoint := store.checkpoints[1]
+		checkpoint[len(checkpoint)-1] ^= 1
+
+		_, err := auditReplica(ctx, store, &codec, verifier, 0)
+		assert.ErrorIs(t, err, ErrAuditFailed)
+		assert.ErrorContains(t, err, "checkpoint 1:")
+	})
+
+	t.Run("pruned", func(t *testing.T) {
+		store, codec, verifier, _ := newTestLedger(t, 3, 12)
+		delete(store.massifs, 0)
+		delete(store.checkpoints, 0)
+
+		audit, err := auditReplica(ctx, store, &codec, verifier, 1)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(2), audit.Massifs)
+	})
+}
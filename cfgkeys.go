@@ -2,12 +2,46 @@ package veracity
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/forestrie/go-merklelog/massifs"
 	"github.com/datatrails/veracity/keyio"
 	"github.com/urfave/cli/v2"
+	"github.com/veraison/go-cose"
 )
 
+// checkpointKeyFlags returns the options for providing the checkpoint verification keys read by CfgKeys
+func checkpointKeyFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "checkpoint-public",
+			Usage:   `A COSE Key format file, containing the key to use to verify checkpoint signatures, EC2 or OKP (Ed25519).`,
+			Aliases: []string{"pub"},
+		},
+		&cli.StringFlag{
+			Name:  "checkpoint-public-pem",
+			Usage: `A PEM format file, containing the key to use to verify checkpoint signatures, EC or Ed25519.`,
+		},
+		&cli.StringFlag{
+			Name: "checkpoint-jwks",
+			Usage: `A JWKS format file, containing the keys to use to verify checkpoint signatures, EC or OKP (Ed25519).
+The key is selected by the alg and kid of the checkpoint. The optional nbf and exp members of a key limit the checkpoints it verifies to those signed in that window.`,
+			Aliases: []string{"jwks"},
+		},
+		&cli.StringFlag{
+			Name:  "checkpoint-keyset",
+			Usage: `A COSE_KeySet format file, containing the keys to use to verify checkpoint signatures. The key is selected by the alg and kid of the checkpoint.`,
+		},
+		&cli.StringFlag{
+			Name:  "checkpoint-keys-dir",
+			Usage: `A directory of PEM format public key files, with the .pem extension, to use to verify checkpoint signatures. Each key is identified by its RFC 7638 thumbprint.`,
+		},
+	}
+}
+
+// CfgKeys reads the checkpoint verification keys. Only one of the options
+// may be set. A single key, from --checkpoint-public or
+// --checkpoint-public-pem, is read as a key set of one.
 func CfgKeys(cmd *CmdCtx, cCtx *cli.Context) error {
 
 	var err error
@@ -17,35 +51,50 @@ func CfgKeys(cmd *CmdCtx, cCtx *cli.Context) error {
 		return fmt.Errorf("failed to create CBOR codec: %w", err)
 	}
 
-	if cCtx.IsSet("checkpoint-public") && cCtx.IsSet("checkpoint-public-pem") {
-		return fmt.Errorf("cannot set both checkpoint-public and checkpoint-public-pem, use only one")
-	}
-
-	if cCtx.IsSet("checkpoint-public") {
-		pub, err := keyio.ReadECDSAPublicCOSE(cCtx.String("checkpoint-public"))
-		if err != nil {
-			return fmt.Errorf("failed to read checkpoint public key: %w", err)
+	var set []string
+	for _, name := range []string{"checkpoint-public", "checkpoint-public-pem", "checkpoint-jwks", "checkpoint-keyset", "checkpoint-keys-dir"} {
+		if cCtx.IsSet(name) {
+			set = append(set, name)
 		}
-		cmd.CheckpointPublic = pub
-		return nil
 	}
-	if cCtx.IsSet("checkpoint-public-pem") {
-		pub, err := keyio.ReadECDSAPublicPEM(cCtx.String("checkpoint-public-pem"))
-		if err != nil {
-			return fmt.Errorf("failed to read checkpoint public key: %w", err)
-		}
-		cmd.CheckpointPublic = pub
+	if len(set) > 1 {
+		return fmt.Errorf("cannot set more than one of %s, use only one", strings.Join(set, ", "))
+	}
+	if len(set) == 0 {
 		return nil
 	}
 
-	if cCtx.IsSet("checkpoint-jwks") {
-		pub, err := keyio.ReadECDSAPublicJOSE(cCtx.String("checkpoint-jwks"))
-		if err != nil {
-			return fmt.Errorf("failed to read checkpoint public key: %w", err)
+	var keys keyio.KeySet
+	switch fileName := cCtx.String(set[0]); set[0] {
+	case "checkpoint-public":
+		var pub keyio.DecodedPublic
+		if pub, err = keyio.ReadPublicCOSE(fileName); err == nil {
+			keys, err = keyio.NewKeySet(keyio.KeySetKey{DecodedPublic: pub})
 		}
-		cmd.CheckpointPublic = pub
-		return nil
+	case "checkpoint-public-pem":
+		var pub keyio.DecodedPublic
+		if pub, err = keyio.ReadPublicPEM(fileName); err == nil {
+			keys, err = keyio.NewKeySet(keyio.KeySetKey{DecodedPublic: pub})
+		}
+	case "checkpoint-jwks":
+		keys, err = keyio.ReadKeySetJOSE(fileName)
+	case "checkpoint-keyset":
+		keys, err = keyio.ReadKeySetCOSE(fileName)
+	case "checkpoint-keys-dir":
+		keys, err = keyio.ReadKeySetPEMDir(fileName)
 	}
-
+	if err != nil {
+		return fmt.Errorf("failed to read checkpoint public keys: %w", err)
+	}
+	cmd.CheckpointKeys = keys
 	return nil
 }
+
+// checkpointVerifier returns the verifier for the checkpoint keys read by
+// CfgKeys, or nil if none were provided.
+func checkpointVerifier(cmd *CmdCtx) (cose.Verifier, error) {
+	if len(cmd.CheckpointKeys.Keys) == 0 {
+		return nil, nil
+	}
+	return newKeySetVerifier(cmd.CheckpointKeys)
+}
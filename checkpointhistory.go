@@ -0,0 +1,223 @@
+package veracity
+
+// Retention of every verified checkpoint in an append only history under the replica directory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs"
+	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+const (
+	// checkpointHistoryDirName is the directory, in the root of the replica
+	// directory, which holds the retained checkpoints for each log.
+	checkpointHistoryDirName = "checkpoint-history"
+	checkpointHistoryExt     = ".cbor"
+)
+
+var (
+	ErrCheckpointHistoryEmpty = errors.New("there are no retained checkpoints for the log")
+)
+
+// checkpointRecord is a retained checkpoint. The published checkpoint does
+// not include the accumulator peaks, they are recovered from the verified log
+// when the checkpoint is retained. This makes the record verifiable without
+// the log.
+type checkpointRecord struct {
+	MassifIndex uint32   `cbor:"1,keyasint"`
+	Retained    int64    `cbor:"2,keyasint"` // unix milliseconds
+	Checkpoint  []byte   `cbor:"3,keyasint"`
+	Peaks       [][]byte `cbor:"4,keyasint"`
+}
+
+// checkpointHistory is the append only store of retained checkpoints for a single log
+type checkpointHistory struct {
+	dir string
+}
+
+func newCheckpointHistory(replicaDir string, logID storage.LogID) *checkpointHistory {
+	return &checkpointHistory{dir: filepath.Join(replicaDir, checkpointHistoryDirName, logIDString(logID))}
+}
+
+// recordName names records so that they list in the order they were retained
+func recordName(retained time.Time, massifIndex uint32, mmrSize uint64) string {
+	return fmt.Sprintf("%016d-%08d-%016d%s", retained.UnixMilli(), massifIndex, mmrSize, checkpointHistoryExt)
+}
+
+// recordMassifIndex returns the massif index encoded in a record name
+func recordMassifIndex(name string) (uint32, bool) {
+	fields := strings.Split(strings.TrimSuffix(name, checkpointHistoryExt), "-")
+	if len(fields) != 3 {
+		return 0, false
+	}
+	massifIndex, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(massifIndex), true
+}
+
+// Add retains the checkpoint. Existing records are never replaced. If the
+// checkpoint is the same as the most recently retained checkpoint for the
+// massif, nothing is added and the name returned is empty.
+func (h *checkpointHistory) Add(
+	codec commoncbor.CBORCodec, massifIndex uint32, checkpoint []byte, peaks [][]byte, retained time.Time,
+) (string, error) {
+
+	_, state, err := massifs.DecodeSignedRoot(codec, checkpoint)
+	if err != nil {
+		return "", err
+	}
+
+	names, err := h.List()
+	if err != nil {
+		return "", err
+	}
+	// Only the most recently retained record for the massif is read, the
+	// massif index of the others is known from their names
+	for i := len(names) - 1; i >= 0; i-- {
+		if recordIndex, ok := recordMassifIndex(names[i]); !ok || recordIndex != massifIndex {
+			continue
+		}
+		rec, err := h.Read(names[i])
+		if err != nil {
+			return "", err
+		}
+		if bytes.Equal(rec.Checkpoint, checkpoint) {
+			return "", nil
+		}
+		break
+	}
+
+	data, err := cbor.Marshal(checkpointRecord{
+		MassifIndex: massifIndex,
+		Retained:    retained.UnixMilli(),
+		Checkpoint:  checkpoint,
+		Peaks:       peaks,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err = os.MkdirAll(h.dir, os.FileMode(0755)); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrFailedToCreateReplicaDir, err)
+	}
+	name := recordName(retained, massifIndex, state.MMRSize)
+	f, err := os.OpenFile(filepath.Join(h.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.FileMode(0444))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err = f.Write(data); err != nil {
+		return "", err
+	}
+	return name, f.Sync()
+}
+
+// List returns the names of the retained checkpoints, oldest first
+func (h *checkpointHistory) List() ([]string, error) {
+	entries, err := os.ReadDir(h.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), checkpointHistoryExt) {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Read reads a retained checkpoint by name
+func (h *checkpointHistory) Read(name string) (checkpointRecord, error) {
+	data, err := os.ReadFile(filepath.Join(h.dir, filepath.Base(name)))
+	if err != nil {
+		return checkpointRecord{}, err
+	}
+	var rec checkpointRecord
+	if err = cbor.Unmarshal(data, &rec); err != nil {
+		return checkpointRecord{}, fmt.Errorf("failed to decode retained checkpoint %s: %w", name, err)
+	}
+	return rec, nil
+}
+
+// verifyCheckpointRecord checks the signature of the retained checkpoint
+// using the retained peaks, and returns the verified state.
+func verifyCheckpointRecord(
+	codec commoncbor.CBORCodec, verifier cose.Verifier, rec checkpointRecord,
+) (massifs.MMRState, error) {
+	msg, state, err := massifs.DecodeSignedRoot(codec, rec.Checkpoint)
+	if err != nil {
+		return massifs.MMRState{}, err
+	}
+	if state.Version != int(massifs.MMRStateVersion0) {
+		// Version 0 checkpoints seal a bagged root rather than the peaks
+		state.Peaks = rec.Peaks
+	}
+	msg.Payload, err = codec.MarshalCBOR(state)
+	if err != nil {
+		return massifs.MMRState{}, err
+	}
+	if verifier, err = messageVerifier(verifier, msg.Sign1Message); err != nil {
+		return massifs.MMRState{}, fmt.Errorf("%w: %v", ErrSealVerifyFailed, err)
+	}
+	if err = msg.Verify(nil, verifier); err != nil {
+		return massifs.MMRState{}, fmt.Errorf("%w: %v", ErrSealVerifyFailed, err)
+	}
+	return state, nil
+}
+
+// checkpointHistoryWriter retains every checkpoint written to the replica.
+// The replicator only writes checkpoints which it has verified, and it writes
+// the massif data before the checkpoint that seals it.
+type checkpointHistoryWriter struct {
+	massifs.ObjectReaderWriter
+	codec   commoncbor.CBORCodec
+	history *checkpointHistory
+}
+
+func (w *checkpointHistoryWriter) Put(
+	ctx context.Context, massifIndex uint32, ty storage.ObjectType, data []byte, failIfExists bool,
+) error {
+	if err := w.ObjectReaderWriter.Put(ctx, massifIndex, ty, data, failIfExists); err != nil {
+		return err
+	}
+	if ty != storage.ObjectCheckpoint {
+		return nil
+	}
+
+	_, state, err := massifs.DecodeSignedRoot(w.codec, data)
+	if err != nil {
+		return err
+	}
+	mc, err := massifs.GetMassifContext(ctx, w.ObjectReaderWriter, massifIndex)
+	if err != nil {
+		return err
+	}
+	peaks, err := mmr.PeakHashes(&mc, state.MMRSize-1)
+	if err != nil {
+		return err
+	}
+	_, err = w.history.Add(w.codec, massifIndex, data, peaks, time.Now())
+	return err
+}
@@ -0,0 +1,266 @@
+package veracity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/datatrails/veracity/keyio"
+	"github.com/forestrie/go-merklelog/massifs"
+	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	commoncose "github.com/forestrie/go-merklelog/massifs/cose"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+var (
+	ErrCheckpointKeyNone    = errors.New("no key in the checkpoint key set is valid for the signature")
+	ErrCheckpointKeyUnknown = errors.New("the kid of the signature is not in the checkpoint key set")
+)
+
+// keySetVerifier verifies checkpoints and receipts signed by any key of a key
+// set. The key is selected by the alg and kid of the signed message. The kid
+// is read from the kid header or, for checkpoints, the cnf claim. A kid which
+// is not in the set is an error, each key of the message's alg is only tried
+// in turn when the message has no kid. Checkpoints are only verified by keys
+// which were valid when the checkpoint was signed. Receipts carry no signing
+// time, so the validity of the keys is not checked for them.
+//
+// go-cose requires the Algorithm of the verifier to be the alg of the message
+// before Verify is called, and the keys may use different algorithms. Use
+// messageVerifier to get the verifier for a message, getContextVerified to
+// verify a massif against its checkpoint, and replicateKeySet to replicate.
+type keySetVerifier struct {
+	keys keyio.KeySet
+}
+
+func newKeySetVerifier(keys keyio.KeySet) (*keySetVerifier, error) {
+	if len(keys.Keys) == 0 {
+		return nil, keyio.ErrKeySetEmpty
+	}
+	return &keySetVerifier{keys: keys}, nil
+}
+
+// Algorithm returns the algorithm of the first key. It is only the alg of
+// every message if all the keys use the same algorithm.
+func (v *keySetVerifier) Algorithm() cose.Algorithm {
+	return v.keys.Keys[0].Alg
+}
+
+// Verify verifies the signature of the Sig_structure content with the key
+// selected by its protected alg and kid.
+func (v *keySetVerifier) Verify(content []byte, signature []byte) error {
+	verifier, err := v.selectKey(sigStructureKeyInfo(content))
+	if err != nil {
+		return err
+	}
+	return verifier.Verify(content, signature)
+}
+
+// forMessage returns the verifier for the key selected by the protected alg
+// and kid of msg
+func (v *keySetVerifier) forMessage(msg *cose.Sign1Message) (cose.Verifier, error) {
+	// The protected header is encoded as a bstr
+	encoded, err := msg.Headers.MarshalProtected()
+	if err != nil {
+		return nil, err
+	}
+	var protected []byte
+	if err = cbor.Unmarshal(encoded, &protected); err != nil {
+		return nil, err
+	}
+	info := protectedKeyInfo(protected)
+	info.signedAt = payloadSignedAt(msg.Payload)
+	return v.selectKey(info)
+}
+
+func (v *keySetVerifier) selectKey(info signedKeyInfo) (cose.Verifier, error) {
+	if info.kid != "" {
+		k, ok := v.keys.Lookup(info.kid)
+		if !ok {
+			return nil, fmt.Errorf("%w: kid %s", ErrCheckpointKeyUnknown, info.kid)
+		}
+		if info.alg != 0 && k.Alg != info.alg {
+			return nil, fmt.Errorf("%w: kid %s uses %v, not %v", ErrCheckpointKeyNone, info.kid, k.Alg, info.alg)
+		}
+		if !info.signedAt.IsZero() && !k.ValidAt(info.signedAt) {
+			return nil, fmt.Errorf("%w: kid %s is not valid at %s",
+				ErrCheckpointKeyNone, info.kid, info.signedAt.UTC().Format(time.RFC3339))
+		}
+		return cose.NewVerifier(k.Alg, k.Public)
+	}
+
+	candidates := &keyCandidates{alg: info.alg}
+	for _, k := range v.keys.Keys {
+		if info.alg != 0 && k.Alg != info.alg {
+			continue
+		}
+		if !info.signedAt.IsZero() && !k.ValidAt(info.signedAt) {
+			continue
+		}
+		verifier, err := cose.NewVerifier(k.Alg, k.Public)
+		if err != nil {
+			return nil, err
+		}
+		candidates.verifiers = append(candidates.verifiers, verifier)
+	}
+	if len(candidates.verifiers) == 0 {
+		return nil, ErrCheckpointKeyNone
+	}
+	if candidates.alg == 0 {
+		candidates.alg = candidates.verifiers[0].Algorithm()
+	}
+	return candidates, nil
+}
+
+// keyCandidates tries each key of the message's alg in turn, for messages
+// without a kid
+type keyCandidates struct {
+	alg       cose.Algorithm
+	verifiers []cose.Verifier
+}
+
+func (c *keyCandidates) Algorithm() cose.Algorithm {
+	return c.alg
+}
+
+func (c *keyCandidates) Verify(content []byte, signature []byte) error {
+	err := ErrCheckpointKeyNone
+	for _, verifier := range c.verifiers {
+		if err = verifier.Verify(content, signature); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// messageVerifier returns the verifier for the key which signed msg, when
+// verifier is a key set. Any other verifier is returned unchanged.
+func messageVerifier(verifier cose.Verifier, msg *cose.Sign1Message) (cose.Verifier, error) {
+	keys, ok := verifier.(*keySetVerifier)
+	if !ok {
+		return verifier, nil
+	}
+	return keys.forMessage(msg)
+}
+
+// checkpointVerifierFor reads the checkpoint of the massif, and returns the
+// verifier for the key which signed it
+func checkpointVerifierFor(
+	ctx context.Context, reader massifs.ObjectReader, codec *commoncbor.CBORCodec,
+	verifier cose.Verifier, massifIndex uint32,
+) (cose.Verifier, *massifs.Checkpoint, error) {
+	check, err := massifs.GetCheckpoint(ctx, reader, *codec, massifIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+	verifier, err = messageVerifier(verifier, check.Sign1Message.Sign1Message)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: checkpoint for massif %d: %w", massifs.ErrSealVerifyFailed, massifIndex, err)
+	}
+	return verifier, &check, nil
+}
+
+// getContextVerified is massifs.GetContextVerified, with the checkpoint
+// verified by the key which signed it when verifier is a key set
+func getContextVerified(
+	ctx context.Context, reader massifs.ObjectReader, codec *commoncbor.CBORCodec,
+	verifier cose.Verifier, massifIndex uint32, opts ...massifs.Option,
+) (*massifs.VerifiedContext, error) {
+	if _, ok := verifier.(*keySetVerifier); !ok {
+		return massifs.GetContextVerified(ctx, reader, codec, verifier, massifIndex, opts...)
+	}
+	verifier, check, err := checkpointVerifierFor(ctx, reader, codec, verifier, massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, massifs.WithVerifyCheckpoint(check))
+	return massifs.GetContextVerified(ctx, reader, codec, verifier, massifIndex, opts...)
+}
+
+// signedKeyInfo identifies the key which signed a message
+type signedKeyInfo struct {
+	alg      cose.Algorithm
+	kid      string
+	signedAt time.Time
+}
+
+// sigStructureKeyInfo reads the alg, kid and, for checkpoints, the signing
+// time from the Sig_structure of a COSE_Sign1 message. Those which can't be
+// read are empty, and the verifier considers every key for them.
+func sigStructureKeyInfo(content []byte) signedKeyInfo {
+	// Sig_structure = ["Signature1", body_protected, external_aad, payload]
+	var sigStructure []cbor.RawMessage
+	if err := cbor.Unmarshal(content, &sigStructure); err != nil || len(sigStructure) != 4 {
+		return signedKeyInfo{}
+	}
+
+	var protected, payload []byte
+	var info signedKeyInfo
+	if cbor.Unmarshal(sigStructure[1], &protected) == nil {
+		info = protectedKeyInfo(protected)
+	}
+	if cbor.Unmarshal(sigStructure[3], &payload) == nil {
+		info.signedAt = payloadSignedAt(payload)
+	}
+	return info
+}
+
+// protectedKeyInfo reads the alg and kid from an encoded protected header
+func protectedKeyInfo(protected []byte) signedKeyInfo {
+	var info signedKeyInfo
+	var headers map[int64]cbor.RawMessage
+	if cbor.Unmarshal(protected, &headers) != nil {
+		return info
+	}
+	if raw, ok := headers[cose.HeaderLabelAlgorithm]; ok {
+		var alg int64
+		if cbor.Unmarshal(raw, &alg) == nil {
+			info.alg = cose.Algorithm(alg)
+		}
+	}
+	if kid, ok := decodeKid(headers[cose.HeaderLabelKeyID]); ok {
+		info.kid = kid
+		return info
+	}
+
+	// The checkpoints identify the key in the cnf claim
+	claims := headers[commoncose.HeaderLabelCWTClaims]
+	for _, label := range []int64{commoncose.CNFLabel, commoncose.CoseKeyLabel, commoncose.KeyIDLabel} {
+		var m map[int64]cbor.RawMessage
+		if claims == nil || cbor.Unmarshal(claims, &m) != nil {
+			return info
+		}
+		claims = m[label]
+	}
+	info.kid, _ = decodeKid(claims)
+	return info
+}
+
+// payloadSignedAt returns the signing time of a checkpoint payload, or the
+// zero time for any other payload
+func payloadSignedAt(payload []byte) time.Time {
+	var state massifs.MMRState
+	if payload == nil || cbor.Unmarshal(payload, &state) != nil || state.Timestamp == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(state.Timestamp)
+}
+
+func decodeKid(raw cbor.RawMessage) (string, bool) {
+	if raw == nil {
+		return "", false
+	}
+	var kid any
+	if err := cbor.Unmarshal(raw, &kid); err != nil {
+		return "", false
+	}
+	switch kid := kid.(type) {
+	case []byte:
+		return string(kid), true
+	case string:
+		return kid, true
+	}
+	return "", false
+}
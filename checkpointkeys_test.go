@@ -0,0 +1,239 @@
+package veracity
+
+import (
+	"context"
+	"crypto/rand"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/datatrails/veracity/keyio"
+	"github.com/datatrails/veracity/scitt"
+	"github.com/forestrie/go-merklelog/massifs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func TestKeySetVerifierRotation(t *testing.T) {
+	ctx := context.Background()
+	codec, err := massifs.NewCBORCodec()
+	require.NoError(t, err)
+
+	oldKey, err := keyio.GenerateKey(keyio.KeyTypeP256)
+	require.NoError(t, err)
+	newKey, err := keyio.GenerateKey(keyio.KeyTypeP256)
+	require.NoError(t, err)
+	oldSigner, err := newIdentifiableCoseSigner(oldKey, sealerIdentity{})
+	require.NoError(t, err)
+	newSigner, err := newIdentifiableCoseSigner(newKey, sealerIdentity{KeyID: "sealer-2"})
+	require.NoError(t, err)
+
+	// The log is created with the old key, and the first append is sealed
+	// with the new key
+	store := newMemoryReader()
+	_, err = initLog(ctx, store, codec, oldSigner, MassifFormatOptions{MassifHeight: 8, CommitmentEpoch: 1}, "test")
+	require.NoError(t, err)
+
+	oldJWK, err := oldSigner.JWK()
+	require.NoError(t, err)
+	newJWK, err := newSigner.JWK()
+	require.NoError(t, err)
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, keyio.WriteJWKS(jwksFile, oldJWK, newJWK))
+	keys, err := keyio.ReadKeySetJOSE(jwksFile)
+	require.NoError(t, err)
+	require.Len(t, keys.Keys, 2)
+	verifier, err := newKeySetVerifier(keys)
+	require.NoError(t, err)
+
+	verified, err := massifs.GetContextVerified(ctx, store, &codec, verifier, 0)
+	require.NoError(t, err)
+
+	appender := newLedgerAppender(codec, newSigner, "test", verified)
+	statement := testStatement(0)
+	require.NoError(t, appender.Add(statement))
+	sealed, err := appender.Seal()
+	require.NoError(t, err)
+	require.NoError(t, commitSealed(ctx, store, sealed, false))
+
+	// Both keys are in the set, the kid of each checkpoint selects its key
+	_, err = massifs.GetContextVerified(ctx, store, &codec, verifier, 0)
+	require.NoError(t, err)
+	leafMassif, ok := appender.Sealed(statement.MMRIndexLeaf)
+	require.True(t, ok)
+	receipt, header, err := decodeReceipt(mustStatementReceipt(t, codec, leafMassif, statement))
+	require.NoError(t, err)
+	_, err = verifyReceipt(receipt, header, statement.LeafHash, verifier)
+	require.NoError(t, err)
+
+	// The old key alone does not verify the rotated checkpoint, its kid is
+	// not in the set
+	oldOnly, err := keyio.NewKeySet(keys.Keys[0])
+	require.NoError(t, err)
+	oldVerifier, err := newKeySetVerifier(oldOnly)
+	require.NoError(t, err)
+	_, err = getContextVerified(ctx, store, &codec, oldVerifier, 0)
+	assert.ErrorIs(t, err, ErrCheckpointKeyUnknown)
+	_, err = massifs.GetContextVerified(ctx, store, &codec, oldVerifier, 0)
+	assert.ErrorIs(t, err, massifs.ErrSealVerifyFailed)
+
+	// A key which expired before the checkpoint was signed does not verify it
+	expired := keys.Keys[1]
+	expired.NotAfter = time.Now().Add(-time.Hour)
+	expiredKeys, err := keyio.NewKeySet(keys.Keys[0], expired)
+	require.NoError(t, err)
+	expiredVerifier, err := newKeySetVerifier(expiredKeys)
+	require.NoError(t, err)
+	_, err = getContextVerified(ctx, store, &codec, expiredVerifier, 0)
+	assert.ErrorIs(t, err, massifs.ErrSealVerifyFailed)
+	assert.ErrorIs(t, err, ErrCheckpointKeyNone)
+
+	// A directory of PEM files identifies each key by its thumbprint, which
+	// is the default kid of the sealer
+	dir := t.TempDir()
+	require.NoError(t, keyio.WritePublicPEM(filepath.Join(dir, "old.pem"), oldKey.Public()))
+	require.NoError(t, keyio.WritePublicPEM(filepath.Join(dir, "new.pem"), newKey.Public()))
+	pemKeys, err := keyio.ReadKeySetPEMDir(dir)
+	require.NoError(t, err)
+	_, ok = pemKeys.Lookup(oldSigner.KeyIdentifier())
+	assert.True(t, ok)
+	pemVerifier, err := newKeySetVerifier(pemKeys)
+	require.NoError(t, err)
+	genesisStore := newMemoryReader()
+	_, err = initLog(ctx, genesisStore, codec, oldSigner, MassifFormatOptions{MassifHeight: 8, CommitmentEpoch: 1}, "test")
+	require.NoError(t, err)
+	_, err = massifs.GetContextVerified(ctx, genesisStore, &codec, pemVerifier, 0)
+	require.NoError(t, err)
+}
+
+func TestKeySetVerifierAlgorithms(t *testing.T) {
+	ctx := context.Background()
+	codec, err := massifs.NewCBORCodec()
+	require.NoError(t, err)
+
+	p256, err := keyio.GenerateKey(keyio.KeyTypeP256)
+	require.NoError(t, err)
+	ed25519Key, err := keyio.GenerateKey(keyio.KeyTypeEd25519)
+	require.NoError(t, err)
+	oldSigner, err := newIdentifiableCoseSigner(p256, sealerIdentity{})
+	require.NoError(t, err)
+	newSigner, err := newIdentifiableCoseSigner(ed25519Key, sealerIdentity{})
+	require.NoError(t, err)
+	oldJWK, err := oldSigner.JWK()
+	require.NoError(t, err)
+	newJWK, err := newSigner.JWK()
+	require.NoError(t, err)
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, keyio.WriteJWKS(jwksFile, oldJWK, newJWK))
+	keys, err := keyio.ReadKeySetJOSE(jwksFile)
+	require.NoError(t, err)
+	verifier, err := newKeySetVerifier(keys)
+	require.NoError(t, err)
+
+	// Height 2 massifs have 2 leaves. Massif 0 is sealed with the P-256 key,
+	// and the key is rotated to Ed25519 for massif 1.
+	store := newMemoryReader()
+	_, err = initLog(ctx, store, codec, oldSigner, MassifFormatOptions{MassifHeight: 2, CommitmentEpoch: 1}, "test")
+	require.NoError(t, err)
+	var statements []*scitt.MMRStatement
+	var receipts [][]byte
+	for i, signer := range []*identifiableCoseSigner{oldSigner, newSigner} {
+		head, _, err := ledgerHead(ctx, store)
+		require.NoError(t, err)
+		verified, err := getContextVerified(ctx, store, &codec, verifier, head)
+		require.NoError(t, err)
+		appender := newLedgerAppender(codec, signer, "test", verified)
+		for j := range 2 {
+			statement := testStatement(2*i + j)
+			require.NoError(t, appender.Add(statement))
+			statements = append(statements, statement)
+		}
+		sealed, err := appender.Seal()
+		require.NoError(t, err)
+		require.NoError(t, commitSealed(ctx, store, sealed, false))
+		for _, statement := range statements[2*i:] {
+			leafMassif, ok := appender.Sealed(statement.MMRIndexLeaf)
+			require.True(t, ok)
+			receipts = append(receipts, mustStatementReceipt(t, codec, leafMassif, statement))
+		}
+	}
+
+	// The checkpoint and receipts of each massif are verified by its own key
+	for massifIndex := range uint32(2) {
+		_, err = getContextVerified(ctx, store, &codec, verifier, massifIndex)
+		require.NoError(t, err, "massif %d", massifIndex)
+	}
+	for i, statement := range statements {
+		receipt, header, err := decodeReceipt(receipts[i])
+		require.NoError(t, err)
+		_, err = verifyReceipt(receipt, header, statement.LeafHash, verifier)
+		assert.NoError(t, err, "leaf %d", statement.MMRIndexLeaf)
+	}
+
+	// A replica of massif 0 is brought up to date, verifying the checkpoints
+	// of both keys. A new replica is verified from massif 0.
+	head, _, err := ledgerHead(ctx, store)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), head)
+	seeded := newMemoryReader()
+	seeded.massifs[0] = store.massifs[0]
+	seeded.checkpoints[0] = store.checkpoints[0]
+	for _, replica := range []*memoryReader{seeded, newMemoryReader()} {
+		replicator := &VerifiedReplica{
+			VerifyingReplicator: massifs.VerifyingReplicator{
+				CBORCodec: codec, COSEVerifier: verifier, Source: store, Sink: replica,
+			},
+			keys: verifier,
+		}
+		require.NoError(t, replicator.ReplicateVerifiedUpdates(ctx, 0, head))
+		assert.Equal(t, store.massifs, replica.massifs)
+		assert.Len(t, replica.checkpoints, 2)
+		require.NoError(t, replicator.ReplicateVerifiedUpdates(ctx, 0, head))
+	}
+
+	// A source checkpoint signed by a key outside the set is refused
+	otherKey, err := keyio.GenerateKey(keyio.KeyTypeEd25519)
+	require.NoError(t, err)
+	otherSigner, err := newIdentifiableCoseSigner(otherKey, sealerIdentity{KeyID: "other"})
+	require.NoError(t, err)
+	forged := newMemoryReader()
+	for i := range store.massifs {
+		forged.massifs[i] = store.massifs[i]
+		forged.checkpoints[i] = store.checkpoints[i]
+	}
+	verified, err := getContextVerified(ctx, store, &codec, verifier, 1)
+	require.NoError(t, err)
+	forged.checkpoints[1], err = sealMassif(codec, otherSigner, verified, "test")
+	require.NoError(t, err)
+	replicator := &VerifiedReplica{
+		VerifyingReplicator: massifs.VerifyingReplicator{
+			CBORCodec: codec, COSEVerifier: verifier, Source: forged, Sink: newMemoryReader(),
+		},
+		keys: verifier,
+	}
+	assert.ErrorIs(t, replicator.ReplicateVerifiedUpdates(ctx, 0, head), ErrCheckpointKeyUnknown)
+
+	// A message without a kid is verified by the keys of its alg, and a kid
+	// which is not in the set is refused rather than trying each key
+	signer, err := cose.NewSigner(cose.AlgorithmEdDSA, ed25519Key)
+	require.NoError(t, err)
+	signMessage := func(kid []byte) *cose.Sign1Message {
+		msg := cose.NewSign1Message()
+		msg.Headers.Protected.SetAlgorithm(cose.AlgorithmEdDSA)
+		if kid != nil {
+			msg.Headers.Protected[cose.HeaderLabelKeyID] = kid
+		}
+		msg.Payload = []byte("payload")
+		require.NoError(t, msg.Sign(rand.Reader, nil, signer))
+		return msg
+	}
+	msg := signMessage(nil)
+	msgVerifier, err := messageVerifier(verifier, msg)
+	require.NoError(t, err)
+	assert.Equal(t, cose.AlgorithmEdDSA, msgVerifier.Algorithm())
+	assert.NoError(t, msg.Verify(nil, msgVerifier))
+
+	_, err = messageVerifier(verifier, signMessage([]byte("unknown")))
+	assert.ErrorIs(t, err, ErrCheckpointKeyUnknown)
+}
@@ -0,0 +1,284 @@
+package veracity
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs"
+	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/urfave/cli/v2"
+	"github.com/veraison/go-cose"
+)
+
+var (
+	ErrCheckpointChainBroken = errors.New("a retained checkpoint is not consistent with its successor")
+	ErrCheckpointUnprovable  = errors.New("version 0 checkpoints have no signed peaks, consistency can not be proven")
+)
+
+// retainedCheckpoint is the json presentation of a retained checkpoint
+type retainedCheckpoint struct {
+	File            string   `json:"file"`
+	MassifIndex     uint32   `json:"massifindex"`
+	Retained        string   `json:"retained"`
+	Version         int      `json:"version"`
+	MMRSize         uint64   `json:"mmrsize"`
+	Timestamp       int64    `json:"timestamp"`
+	IDTimestamp     string   `json:"idtimestamp"`
+	CommitmentEpoch uint32   `json:"commitment_epoch"`
+	Peaks           []string `json:"peaks"`
+}
+
+// NewCheckpointsCmd works with the checkpoint history retained by replicate-logs
+func NewCheckpointsCmd() *cli.Command {
+	replicaDirFlag := &cli.StringFlag{
+		Name:    "replicadir",
+		Usage:   `the root directory for all tenant log replicas, as used with replicate-logs`,
+		Aliases: []string{"d"},
+		Value:   ".",
+	}
+
+	return &cli.Command{
+		Name: "checkpoints",
+		Usage: `list, show and verify the checkpoints retained by replicate-logs.
+
+Every verified checkpoint is kept, in the order it was replicated, so that a log which is later shown to have presented different views can be challenged with the signed evidence.`,
+		Subcommands: []*cli.Command{
+			{
+				Name:  "list",
+				Usage: "list the retained checkpoints for the log, oldest first",
+				Flags: []cli.Flag{replicaDirFlag},
+				Action: func(cCtx *cli.Context) error {
+					history, err := cfgCheckpointHistory(cCtx)
+					if err != nil {
+						return err
+					}
+					codec, err := massifs.NewCBORCodec()
+					if err != nil {
+						return err
+					}
+					names, err := history.List()
+					if err != nil {
+						return err
+					}
+					for _, name := range names {
+						rec, err := history.Read(name)
+						if err != nil {
+							return err
+						}
+						view, err := newRetainedCheckpoint(codec, name, rec)
+						if err != nil {
+							return err
+						}
+						fmt.Printf("%s massif %d mmrsize %d retained %s\n", view.File, view.MassifIndex, view.MMRSize, view.Retained)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "show",
+				Usage:     "show a retained checkpoint as json, by default the most recently retained",
+				ArgsUsage: "[file]",
+				Flags:     []cli.Flag{replicaDirFlag},
+				Action: func(cCtx *cli.Context) error {
+					history, err := cfgCheckpointHistory(cCtx)
+					if err != nil {
+						return err
+					}
+					codec, err := massifs.NewCBORCodec()
+					if err != nil {
+						return err
+					}
+					name := cCtx.Args().First()
+					if name == "" {
+						names, err := history.List()
+						if err != nil {
+							return err
+						}
+						if len(names) == 0 {
+							return ErrCheckpointHistoryEmpty
+						}
+						name = names[len(names)-1]
+					}
+					rec, err := history.Read(name)
+					if err != nil {
+						return err
+					}
+					view, err := newRetainedCheckpoint(codec, name, rec)
+					if err != nil {
+						return err
+					}
+					data, err := json.MarshalIndent(view, "", "  ")
+					if err != nil {
+						return err
+					}
+					fmt.Println(string(data))
+					return nil
+				},
+			},
+			{
+				Name: "verify-chain",
+				Usage: `verify the signature of every retained checkpoint, and that each is consistent with its successor.
+The consistency proofs are made using the replicated log. The signatures of checkpoints for massifs removed by prune are verified, but not their consistency.`,
+				Flags: append([]cli.Flag{replicaDirFlag}, checkpointKeyFlags()...),
+				Action: func(cCtx *cli.Context) error {
+					var err error
+					cmd := &CmdCtx{}
+					ctx := cCtx.Context
+
+					if err = cfgLogging(cmd, cCtx); err != nil {
+						return err
+					}
+					if err = CfgKeys(cmd, cCtx); err != nil {
+						return err
+					}
+					if len(cmd.CheckpointKeys.Keys) == 0 {
+						return errors.New("checkpoint public key is required")
+					}
+					verifier, err := checkpointVerifier(cmd)
+					if err != nil {
+						return err
+					}
+					if err = cfgMassifFmt(cmd, cCtx); err != nil {
+						return err
+					}
+
+					history, err := cfgCheckpointHistory(cCtx)
+					if err != nil {
+						return err
+					}
+
+					reader, err := NewCmdStorageProviderFS(ctx, cCtx, cmd, cCtx.String("replicadir"), false)
+					if err != nil {
+						return err
+					}
+					logID := CtxGetOneLogOption(cCtx)
+					if err = reader.SelectLog(ctx, logID); err != nil {
+						return err
+					}
+
+					// Massifs removed by prune can't provide the nodes for
+					// consistency checks
+					manifest, err := readPruneManifest(cCtx.String("replicadir"), logID)
+					if err != nil {
+						return err
+					}
+					store := newMassifNodeStore(ctx, reader, cmd.MassifFmt.MassifHeight)
+					store.firstMassif = manifest.FirstMassif
+
+					count, err := verifyCheckpointChain(cmd, history, verifier, store)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("OK|%d checkpoints\n", count)
+					return nil
+				},
+			},
+		},
+	}
+}
+
+func cfgCheckpointHistory(cCtx *cli.Context) (*checkpointHistory, error) {
+	logID := CtxGetOneLogOption(cCtx)
+	if logID == nil {
+		return nil, fmt.Errorf("a tenant or logid is required for this command")
+	}
+	return newCheckpointHistory(cCtx.String("replicadir"), logID), nil
+}
+
+func newRetainedCheckpoint(codec commoncbor.CBORCodec, name string, rec checkpointRecord) (retainedCheckpoint, error) {
+	_, state, err := massifs.DecodeSignedRoot(codec, rec.Checkpoint)
+	if err != nil {
+		return retainedCheckpoint{}, err
+	}
+	view := retainedCheckpoint{
+		File:            name,
+		MassifIndex:     rec.MassifIndex,
+		Retained:        time.UnixMilli(rec.Retained).UTC().Format(time.RFC3339Nano),
+		Version:         state.Version,
+		MMRSize:         state.MMRSize,
+		Timestamp:       state.Timestamp,
+		IDTimestamp:     fmt.Sprintf("%x", state.IDTimestamp),
+		CommitmentEpoch: state.CommitmentEpoch,
+	}
+	for _, peak := range rec.Peaks {
+		view.Peaks = append(view.Peaks, hex.EncodeToString(peak))
+	}
+	return view, nil
+}
+
+// verifyCheckpointChain verifies each retained checkpoint, and checks it is
+// consistent with the checkpoint retained after it. Checkpoints for massifs
+// removed by prune are only verified, the log data needed to check their
+// consistency has gone. It returns the number of checkpoints verified.
+func verifyCheckpointChain(
+	cmd *CmdCtx, history *checkpointHistory, verifier cose.Verifier, store *massifNodeStore,
+) (int, error) {
+
+	names, err := history.List()
+	if err != nil {
+		return 0, err
+	}
+	if len(names) == 0 {
+		return 0, ErrCheckpointHistoryEmpty
+	}
+
+	var prev *massifs.MMRState
+	var prevName string
+	for _, name := range names {
+		rec, err := history.Read(name)
+		if err != nil {
+			return 0, err
+		}
+		state, err := verifyCheckpointRecord(cmd.CBORCodec, verifier, rec)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", name, err)
+		}
+		if rec.MassifIndex < store.firstMassif {
+			continue
+		}
+		if prev != nil {
+			if err = checkRetainedConsistency(store, *prev, state); err != nil {
+				return 0, fmt.Errorf("%w: %s and %s: %w", ErrCheckpointChainBroken, prevName, name, err)
+			}
+		}
+		prev = &state
+		prevName = name
+	}
+	return len(names), nil
+}
+
+// checkRetainedConsistency checks next is an extension of prev. Checkpoints
+// may be retained in any order with respect to the massifs, so next may seal
+// a smaller log than prev, in which case the roles are swapped.
+func checkRetainedConsistency(store *massifNodeStore, prev massifs.MMRState, next massifs.MMRState) error {
+	if prev.Version == int(massifs.MMRStateVersion0) || next.Version == int(massifs.MMRStateVersion0) {
+		// Version 0 checkpoints seal a bagged root, there are no signed peaks
+		// to prove consistency against.
+		return ErrCheckpointUnprovable
+	}
+	if next.MMRSize < prev.MMRSize {
+		prev, next = next, prev
+	}
+	ok, peaks, err := mmr.CheckConsistency(store, sha256.New(), prev.MMRSize, next.MMRSize, prev.Peaks)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("size %d is not consistent with size %d", next.MMRSize, prev.MMRSize)
+	}
+	if len(peaks) != len(next.Peaks) {
+		return fmt.Errorf("the peaks for size %d do not match the log", next.MMRSize)
+	}
+	for i := range peaks {
+		if !bytes.Equal(peaks[i], next.Peaks[i]) {
+			return fmt.Errorf("peak %d for size %d does not match the log", i, next.MMRSize)
+		}
+	}
+	return nil
+}
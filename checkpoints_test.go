@@ -0,0 +1,107 @@
+package veracity
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyCheckpointChainPruned(t *testing.T) {
+	ctx := context.Background()
+
+	// Height 3 massifs have 4 leaves. The checkpoint for massif 2 seals size
+	// 22, whose peaks are 14 and 21. Proving it consistent with size 31 needs
+	// node 14, which was added to massif 1.
+	store, codec, verifier, _ := newTestLedger(t, 3, 16)
+	cmd := &CmdCtx{CBORCodec: codec}
+
+	history := newCheckpointHistory(t.TempDir(), []byte("0123456789abcdef"))
+	retained := time.Now()
+	for massifIndex := uint32(0); massifIndex < 4; massifIndex++ {
+		checkpoint := store.checkpoints[massifIndex]
+		_, state, err := massifs.DecodeSignedRoot(codec, checkpoint)
+		require.NoError(t, err)
+		mc, err := massifs.GetMassifContext(ctx, store, massifIndex)
+		require.NoError(t, err)
+		peaks, err := mmr.PeakHashes(&mc, state.MMRSize-1)
+		require.NoError(t, err)
+		_, err = history.Add(codec, massifIndex, checkpoint, peaks, retained.Add(time.Duration(massifIndex)*time.Millisecond))
+		require.NoError(t, err)
+	}
+
+	count, err := verifyCheckpointChain(cmd, history, verifier, newMassifNodeStore(ctx, store, 3))
+	require.NoError(t, err)
+	assert.Equal(t, 4, count)
+
+	// Prune removes massifs 0 and 1, but not the retained checkpoints
+	for massifIndex := uint32(0); massifIndex < 2; massifIndex++ {
+		delete(store.massifs, massifIndex)
+		delete(store.checkpoints, massifIndex)
+	}
+	_, err = verifyCheckpointChain(cmd, history, verifier, newMassifNodeStore(ctx, store, 3))
+	assert.Error(t, err)
+
+	pruned := newMassifNodeStore(ctx, store, 3)
+	pruned.firstMassif = 2
+	count, err = verifyCheckpointChain(cmd, history, verifier, pruned)
+	require.NoError(t, err)
+	assert.Equal(t, 4, count)
+}
+
+func TestCheckRetainedConsistencyVersion0(t *testing.T) {
+	store, _, _, _ := newTestLedger(t, 3, 6)
+	nodes := newMassifNodeStore(context.Background(), store, 3)
+	prev := newTestView(t, store, "prev", 7).State
+	next := newTestView(t, store, "next", 10).State
+	require.NoError(t, checkRetainedConsistency(nodes, prev, next))
+
+	// There are no signed peaks to check a version 0 checkpoint against
+	legacy := next
+	legacy.Version = int(massifs.MMRStateVersion0)
+	legacy.Peaks = nil
+	assert.ErrorIs(t, checkRetainedConsistency(nodes, prev, legacy), ErrCheckpointUnprovable)
+	assert.ErrorIs(t, checkRetainedConsistency(nodes, legacy, prev), ErrCheckpointUnprovable)
+}
+
+func TestCheckpointHistoryAdd(t *testing.T) {
+	ctx := context.Background()
+	store, codec, _, _ := newTestLedger(t, 3, 8)
+	history := newCheckpointHistory(t.TempDir(), []byte("0123456789abcdef"))
+	retained := time.Now()
+
+	add := func(massifIndex uint32, at time.Time) string {
+		checkpoint := store.checkpoints[massifIndex]
+		_, state, err := massifs.DecodeSignedRoot(codec, checkpoint)
+		require.NoError(t, err)
+		mc, err := massifs.GetMassifContext(ctx, store, massifIndex)
+		require.NoError(t, err)
+		peaks, err := mmr.PeakHashes(&mc, state.MMRSize-1)
+		require.NoError(t, err)
+		name, err := history.Add(codec, massifIndex, checkpoint, peaks, at)
+		require.NoError(t, err)
+		return name
+	}
+
+	name := add(0, retained)
+	require.NotEmpty(t, name)
+	massifIndex, ok := recordMassifIndex(name)
+	require.True(t, ok)
+	assert.Equal(t, uint32(0), massifIndex)
+
+	// The records of other massifs are not read, so an unreadable record for
+	// massif 1 does not prevent the checkpoint for massif 0 being checked
+	unreadable := recordName(retained.Add(time.Millisecond), 1, 0)
+	require.NoError(t, os.WriteFile(filepath.Join(history.dir, unreadable), []byte("not cbor"), 0444))
+	assert.Empty(t, add(0, retained.Add(2*time.Millisecond)))
+
+	names, err := history.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{name, unreadable}, names)
+}
@@ -13,10 +13,13 @@ import (
 type CmdCtx struct {
 	Log logger.Logger
 
-	CheckpointPublic keyio.DecodedPublic
+	// CheckpointKeys are the keys for verifying checkpoints, read by CfgKeys
+	CheckpointKeys keyio.KeySet
 
 	RemoteURL string
-	CBORCodec cbor.CBORCodec
+	// RemoteProvider is how RemoteURL is read, azure or http
+	RemoteProvider string
+	CBORCodec      cbor.CBORCodec
 
 	// cfgMassifFmt sets the massif format options and the IDState
 	MassifFmt MassifFormatOptions
@@ -35,10 +38,11 @@ func (cmd *CmdCtx) NextID() (uint64, error) {
 // Clone returns a safe copy of the CmdCtx.
 func (c *CmdCtx) Clone() *CmdCtx {
 	return &CmdCtx{
-		RemoteURL: c.RemoteURL,
-		CBORCodec: c.CBORCodec,
-		MassifFmt: c.MassifFmt,
-		IDState:   c.IDState,
-		Log:       c.Log,
+		RemoteURL:      c.RemoteURL,
+		RemoteProvider: c.RemoteProvider,
+		CBORCodec:      c.CBORCodec,
+		MassifFmt:      c.MassifFmt,
+		IDState:        c.IDState,
+		Log:            c.Log,
 	}
 }
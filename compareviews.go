@@ -0,0 +1,384 @@
+package veracity
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	fsstorage "github.com/forestrie/go-merklelog-fs/storage"
+	"github.com/forestrie/go-merklelog/massifs"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/urfave/cli/v2"
+	"github.com/veraison/go-cose"
+)
+
+const (
+	defaultEvidenceFileName = "split-view-evidence.json"
+
+	// viewCheckpointFlagName is distinct from the global --checkpoint-file,
+	// which selects a local checkpoint for the other commands
+	viewCheckpointFlagName = "view-checkpoint"
+)
+
+var (
+	ErrSplitView           = errors.New("the log has presented views which can not both be prefixes of one log")
+	ErrTooFewViews         = errors.New("at least two sources are required to compare views")
+	ErrViewPeaksUnresolved = errors.New("no source log can provide the peaks for the checkpoint")
+	ErrViewUnprovable      = errors.New("no source log matches the larger checkpoint, consistency can not be proven")
+)
+
+// checkpointView is a verified checkpoint for the log, read from one source
+type checkpointView struct {
+	Source     string
+	Checkpoint []byte
+	State      massifs.MMRState
+
+	// store is the log the checkpoint was read from, it is nil for checkpoint files
+	store *massifNodeStore
+}
+
+// EvidenceCheckpoint is a signed checkpoint with the peaks it seals, which
+// are not included in published checkpoints.
+type EvidenceCheckpoint struct {
+	Source     string   `json:"source"`
+	Checkpoint []byte   `json:"checkpoint"`
+	MMRSize    uint64   `json:"mmrsize"`
+	Peaks      [][]byte `json:"peaks"`
+}
+
+// SplitViewConflict identifies two views which can not both be prefixes of
+// one log. When the sizes differ, the proof is taken from a log whose peaks
+// match the larger checkpoint. It can not be verified against the peaks of
+// the smaller checkpoint.
+type SplitViewConflict struct {
+	Smaller int                   `json:"smaller"`
+	Larger  int                   `json:"larger"`
+	Reason  string                `json:"reason"`
+	Proof   *mmr.ConsistencyProof `json:"proof,omitempty"`
+}
+
+// SplitViewEvidence is a self contained record of a split view. Given the
+// log's public key, anyone can check the signatures on the checkpoints and
+// re-run the consistency check for each conflict.
+type SplitViewEvidence struct {
+	LogID     string               `json:"logid"`
+	Views     []EvidenceCheckpoint `json:"views"`
+	Conflicts []SplitViewConflict  `json:"conflicts"`
+}
+
+// NewCompareViewsCmd compares the checkpoints for a log read from several sources
+func NewCompareViewsCmd() *cli.Command {
+	return &cli.Command{
+		Name: "compare-views",
+		Usage: `compare the checkpoints for a log from two or more sources, and detect a split view.
+
+Each source is a remote url or a local replica directory, as created by replicate-logs. The most recent checkpoint is read from each and verified against its log.
+Checkpoints may also be given as files, either as published or as retained by replicate-logs.
+Every pair of checkpoints is checked, the smaller must be a prefix of the larger.
+If two signed checkpoints can not both be prefixes of one log, the evidence is written to a file and the command fails.`,
+		Flags: append([]cli.Flag{
+			&cli.StringSliceFlag{
+				Name:    "source",
+				Aliases: []string{"s"},
+				Usage:   "a remote url (http or https) or a local replica directory to read the log from. may be repeated",
+			},
+			&cli.StringSliceFlag{
+				Name:  viewCheckpointFlagName,
+				Usage: "a signed checkpoint file for the log. may be repeated",
+			},
+			&cli.StringFlag{
+				Name:  "evidence",
+				Usage: "the file to write the evidence to if a split view is detected",
+				Value: defaultEvidenceFileName,
+			},
+		}, checkpointKeyFlags()...),
+		Action: func(cCtx *cli.Context) error {
+			var err error
+			cmd := &CmdCtx{}
+			ctx := cCtx.Context
+
+			if err = cfgLogging(cmd, cCtx); err != nil {
+				return err
+			}
+			if err = CfgKeys(cmd, cCtx); err != nil {
+				return err
+			}
+			if len(cmd.CheckpointKeys.Keys) == 0 {
+				return errors.New("checkpoint public key is required")
+			}
+			verifier, err := checkpointVerifier(cmd)
+			if err != nil {
+				return err
+			}
+			if err = cfgMassifFmt(cmd, cCtx); err != nil {
+				return err
+			}
+
+			logID := CtxGetOneLogOption(cCtx)
+			if logID == nil {
+				return fmt.Errorf("a tenant or logid is required for this command")
+			}
+
+			sources := cCtx.StringSlice("source")
+			files := cCtx.StringSlice(viewCheckpointFlagName)
+			if len(sources)+len(files) < 2 {
+				return ErrTooFewViews
+			}
+
+			var views []checkpointView
+			for _, source := range sources {
+				view, err := readSourceView(ctx, cCtx, cmd.Clone(), verifier, logID, source)
+				if err != nil {
+					return fmt.Errorf("%s: %w", source, err)
+				}
+				views = append(views, view)
+			}
+			for _, fileName := range files {
+				view, err := readFileView(cmd, verifier, views, fileName)
+				if err != nil {
+					return fmt.Errorf("%s: %w", fileName, err)
+				}
+				views = append(views, view)
+			}
+
+			conflicts, err := compareViews(views)
+			if err != nil {
+				return err
+			}
+			if len(conflicts) == 0 {
+				fmt.Printf("OK|%d views|consistent\n", len(views))
+				return nil
+			}
+
+			evidence := newSplitViewEvidence(logID, views, conflicts)
+			for _, conflict := range conflicts {
+				cmd.Log.Infof("split view: %s and %s: %s",
+					views[conflict.Smaller].Source, views[conflict.Larger].Source, conflict.Reason)
+			}
+			if err = evidence.WriteFile(cCtx.String("evidence")); err != nil {
+				return err
+			}
+			return fmt.Errorf("%w: %d conflicts, evidence written to %s",
+				ErrSplitView, len(conflicts), cCtx.String("evidence"))
+		},
+	}
+}
+
+// readSourceView reads and verifies the most recent checkpoint from a remote
+// url or a local replica.
+func readSourceView(
+	ctx context.Context, cCtx *cli.Context, cmd *CmdCtx, verifier cose.Verifier,
+	logID storage.LogID, source string,
+) (checkpointView, error) {
+
+	var reader readerSelector
+	var err error
+
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		reader, err = newRemoteStorageProvider(ctx, cCtx, cmd, source)
+	} else {
+		reader, err = newStorageProviderFS(ctx, cmd, fsstorage.FSOptions{
+			RootDir:         source,
+			MassifExtension: massifExtension(cCtx),
+		})
+	}
+	if err != nil {
+		return checkpointView{}, err
+	}
+	if err = reader.SelectLog(ctx, logID); err != nil {
+		return checkpointView{}, err
+	}
+
+	massifIndex, err := reader.HeadIndex(ctx, storage.ObjectCheckpoint)
+	if err != nil {
+		return checkpointView{}, err
+	}
+
+	// The checkpoint signature is verified, and the log is checked against
+	// the state it seals. This also restores the peaks.
+	verified, err := getContextVerified(ctx, reader, &cmd.CBORCodec, verifier, massifIndex)
+	if err != nil {
+		return checkpointView{}, err
+	}
+	checkpoint, _, err := reader.CheckpointData(massifIndex)
+	if err != nil {
+		return checkpointView{}, err
+	}
+
+	return checkpointView{
+		Source:     source,
+		Checkpoint: checkpoint,
+		State:      verified.MMRState,
+		store:      newMassifNodeStore(ctx, reader, cmd.MassifFmt.MassifHeight),
+	}, nil
+}
+
+// readFileView reads and verifies a checkpoint file. Checkpoints retained by
+// replicate-logs include the peaks. For published checkpoints, the peaks are
+// recovered from the first of the source logs which is large enough and whose
+// peaks verify the signature.
+func readFileView(
+	cmd *CmdCtx, verifier cose.Verifier, views []checkpointView, fileName string,
+) (checkpointView, error) {
+
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return checkpointView{}, err
+	}
+
+	var rec checkpointRecord
+	if err = cbor.Unmarshal(data, &rec); err == nil && len(rec.Checkpoint) > 0 {
+		state, err := verifyCheckpointRecord(cmd.CBORCodec, verifier, rec)
+		if err != nil {
+			return checkpointView{}, err
+		}
+		return checkpointView{Source: fileName, Checkpoint: rec.Checkpoint, State: state}, nil
+	}
+
+	_, state, err := massifs.DecodeSignedRoot(cmd.CBORCodec, data)
+	if err != nil {
+		return checkpointView{}, err
+	}
+	if state.Version == int(massifs.MMRStateVersion0) {
+		state, err = verifyCheckpointRecord(cmd.CBORCodec, verifier, checkpointRecord{Checkpoint: data})
+		if err != nil {
+			return checkpointView{}, err
+		}
+		return checkpointView{Source: fileName, Checkpoint: data, State: state}, nil
+	}
+
+	for _, view := range views {
+		if view.store == nil || view.State.MMRSize < state.MMRSize {
+			continue
+		}
+		peaks, err := mmr.PeakHashes(view.store, state.MMRSize-1)
+		if err != nil {
+			return checkpointView{}, err
+		}
+		verified, err := verifyCheckpointRecord(cmd.CBORCodec, verifier, checkpointRecord{Checkpoint: data, Peaks: peaks})
+		if err != nil {
+			continue
+		}
+		return checkpointView{Source: fileName, Checkpoint: data, State: verified}, nil
+	}
+	return checkpointView{}, ErrViewPeaksUnresolved
+}
+
+// compareViews checks every pair of views and returns a conflict for each
+// pair which can not both be prefixes of one log. The order the views were
+// given in does not matter, whichever of the pair is smaller must be a prefix
+// of the larger.
+func compareViews(views []checkpointView) ([]SplitViewConflict, error) {
+	var conflicts []SplitViewConflict
+	for i := 0; i < len(views); i++ {
+		for j := i + 1; j < len(views); j++ {
+			smaller, larger := i, j
+			if views[j].State.MMRSize < views[i].State.MMRSize {
+				smaller, larger = j, i
+			}
+			conflict, err := compareViewPair(views, smaller, larger)
+			if err != nil {
+				return nil, fmt.Errorf("%s and %s: %w", views[smaller].Source, views[larger].Source, err)
+			}
+			if conflict != nil {
+				conflicts = append(conflicts, *conflict)
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+func compareViewPair(views []checkpointView, smaller, larger int) (*SplitViewConflict, error) {
+	a, b := views[smaller].State, views[larger].State
+
+	if a.Version == int(massifs.MMRStateVersion0) || b.Version == int(massifs.MMRStateVersion0) {
+		// Version 0 checkpoints seal a bagged root, there are no signed peaks
+		// to prove consistency against.
+		return nil, fmt.Errorf("%w: version 0 checkpoints have no signed peaks", ErrViewUnprovable)
+	}
+
+	if a.MMRSize == b.MMRSize {
+		if peaksEqual(a.Peaks, b.Peaks) {
+			return nil, nil
+		}
+		return &SplitViewConflict{
+			Smaller: smaller, Larger: larger,
+			Reason: fmt.Sprintf("different peaks are signed for size %d", a.MMRSize),
+		}, nil
+	}
+
+	// The proof must come from a log which matches the larger checkpoint.
+	// Prefer the log the larger checkpoint was read from.
+	candidates := append([]checkpointView{views[larger]}, views...)
+	for _, candidate := range candidates {
+		if candidate.store == nil || candidate.State.MMRSize < b.MMRSize {
+			continue
+		}
+		peaks, err := mmr.PeakHashes(candidate.store, b.MMRSize-1)
+		if err != nil {
+			return nil, err
+		}
+		if !peaksEqual(peaks, b.Peaks) {
+			continue
+		}
+
+		proof, err := mmr.IndexConsistencyProof(candidate.store, a.MMRSize-1, b.MMRSize-1)
+		if err != nil {
+			return nil, err
+		}
+		ok, _, err := mmr.VerifyConsistency(sha256.New(), proof, a.Peaks, b.Peaks)
+		if err != nil && !errors.Is(err, mmr.ErrConsistencyCheck) {
+			return nil, err
+		}
+		if ok && err == nil {
+			return nil, nil
+		}
+		return &SplitViewConflict{
+			Smaller: smaller, Larger: larger,
+			Reason: fmt.Sprintf("size %d is not a prefix of size %d", a.MMRSize, b.MMRSize),
+			Proof:  &proof,
+		}, nil
+	}
+	return nil, ErrViewUnprovable
+}
+
+func peaksEqual(a [][]byte, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func newSplitViewEvidence(logID storage.LogID, views []checkpointView, conflicts []SplitViewConflict) *SplitViewEvidence {
+	evidence := &SplitViewEvidence{LogID: logIDString(logID), Conflicts: conflicts}
+	for _, view := range views {
+		evidence.Views = append(evidence.Views, EvidenceCheckpoint{
+			Source:     view.Source,
+			Checkpoint: view.Checkpoint,
+			MMRSize:    view.State.MMRSize,
+			Peaks:      view.State.Peaks,
+		})
+	}
+	return evidence
+}
+
+// WriteFile writes the evidence as json
+func (e *SplitViewEvidence) WriteFile(fileName string) error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, append(data, '\n'), os.FileMode(0644))
+}
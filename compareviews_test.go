@@ -0,0 +1,125 @@
+package veracity
+
+import (
+	"context"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestView returns a view of the log for mmrSize, as read from a source
+// log which can provide the nodes for proofs
+func newTestView(t *testing.T, store *memoryReader, source string, mmrSize uint64) checkpointView {
+	nodes := newMassifNodeStore(context.Background(), store, 3)
+	peaks, err := mmr.PeakHashes(nodes, mmrSize-1)
+	require.NoError(t, err)
+	return checkpointView{
+		Source: source,
+		State:  massifs.MMRState{Version: int(massifs.MMRStateVersionCurrent), MMRSize: mmrSize, Peaks: peaks},
+		store:  nodes,
+	}
+}
+
+// equivocatingView returns a view signing different peaks for the size of
+// view, as a log presenting a split view would. It is read from a file, so
+// has no log to provide proofs.
+func equivocatingView(view checkpointView, source string) checkpointView {
+	peaks := make([][]byte, len(view.State.Peaks))
+	for i := range view.State.Peaks {
+		peaks[i] = append([]byte(nil), view.State.Peaks[i]...)
+	}
+	peaks[0][0] ^= 1
+	state := view.State
+	state.Peaks = peaks
+	return checkpointView{Source: source, State: state}
+}
+
+// version0View returns the view as a version 0 checkpoint, which seals a
+// bagged root rather than the peaks
+func version0View(view checkpointView) checkpointView {
+	view.State.Version = int(massifs.MMRStateVersion0)
+	view.State.Peaks = nil
+	return view
+}
+
+func TestCompareViewPair(t *testing.T) {
+	// Height 3 massifs have 4 leaves, 6 leaves span two massifs
+	store, _, _, _ := newTestLedger(t, 3, 6)
+	small := newTestView(t, store, "small", 7)
+	large := newTestView(t, store, "large", 10)
+	forged := equivocatingView(small, "forged")
+
+	tests := []struct {
+		name       string
+		views      []checkpointView
+		wantReason string
+		wantProof  bool
+		wantErr    error
+	}{
+		{name: "prefix", views: []checkpointView{small, large}},
+		{name: "same size, same peaks", views: []checkpointView{small, small}},
+		{
+			name: "same size, different peaks", views: []checkpointView{small, forged},
+			wantReason: "different peaks are signed for size 7",
+		},
+		{
+			name: "not a prefix", views: []checkpointView{forged, large},
+			wantReason: "size 7 is not a prefix of size 10", wantProof: true,
+		},
+		{
+			name: "no log for the larger view", views: []checkpointView{small, equivocatingView(large, "forged")},
+			wantErr: ErrViewUnprovable,
+		},
+		{
+			name: "version 0", views: []checkpointView{small, version0View(large)},
+			wantErr: ErrViewUnprovable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conflict, err := compareViewPair(tt.views, 0, 1)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			if tt.wantReason == "" {
+				assert.Nil(t, conflict)
+				return
+			}
+			require.NotNil(t, conflict)
+			assert.Equal(t, 0, conflict.Smaller)
+			assert.Equal(t, 1, conflict.Larger)
+			assert.Equal(t, tt.wantReason, conflict.Reason)
+			assert.Equal(t, tt.wantProof, conflict.Proof != nil)
+		})
+	}
+}
+
+func TestCompareViews(t *testing.T) {
+	store, _, _, _ := newTestLedger(t, 3, 6)
+	small := newTestView(t, store, "small", 7)
+	large := newTestView(t, store, "large", 10)
+
+	// The order the views are given in does not matter
+	conflicts, err := compareViews([]checkpointView{large, newTestView(t, store, "middle", 8), small})
+	require.NoError(t, err)
+	assert.Empty(t, conflicts)
+
+	// The forged view conflicts with both views of the log, and the conflicts
+	// identify the smaller and larger of each pair
+	views := []checkpointView{large, small, equivocatingView(small, "forged")}
+	conflicts, err = compareViews(views)
+	require.NoError(t, err)
+	require.Len(t, conflicts, 2)
+	assert.Equal(t, [2]int{2, 0}, [2]int{conflicts[0].Smaller, conflicts[0].Larger})
+	assert.NotNil(t, conflicts[0].Proof)
+	assert.Equal(t, [2]int{1, 2}, [2]int{conflicts[1].Smaller, conflicts[1].Larger})
+
+	evidence := newSplitViewEvidence([]byte("0123456789abcdef"), views, conflicts)
+	assert.Len(t, evidence.Views, 3)
+	assert.Equal(t, views[2].State.Peaks, evidence.Views[2].Peaks)
+}
@@ -1,7 +1,6 @@
 package veracity
 
 import (
-	"context"
 	"encoding/binary"
 	"fmt"
 	"time"
@@ -32,7 +31,7 @@ func NewDiagCmd() *cli.Command {
 			var massif massifs.MassifContext
 			var reader massifs.ObjectReader
 
-			ctx := context.Background()
+			ctx := cCtx.Context
 
 			cmd := &CmdCtx{}
 			if reader, err = cfgMassifReader(cmd, cCtx); err != nil {
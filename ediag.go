@@ -1,7 +1,6 @@
 package veracity
 
 import (
-	"context"
 	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
@@ -94,7 +93,7 @@ func NewEventDiagCmd() *cli.Command {
 				}
 				reader.SelectLog(cCtx.Context, logID)
 				// read the massif blob
-				massif, err = massifs.GetMassifContext(context.Background(), reader, massifIndex)
+				massif, err = massifs.GetMassifContext(cCtx.Context, reader, massifIndex)
 				if err != nil {
 					return err
 				}
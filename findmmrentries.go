@@ -255,13 +255,13 @@ func NewFindMMREntriesCmd() *cli.Command {
 				return err
 			}
 			logID := datatrails.TenantID2LogID(logTenant)
-			if err := reader.SelectLog(context.Background(), logID); err != nil {
+			if err := reader.SelectLog(cCtx.Context, logID); err != nil {
 				return fmt.Errorf("could not select log for tenant %q: %w", logTenant, err)
 			}
 			cmd.Log.Debugf("app entry: %x", appEntry)
 
 			leafIndexMatches, entriesConsidered, err := findMMREntries(
-				context.Background(),
+				cCtx.Context,
 				cmd.Log,
 				reader,
 				tenantLogPath,
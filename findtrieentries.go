@@ -281,10 +281,10 @@ func NewFindTrieEntriesCmd() *cli.Command {
 
 				cmd.Log.Debugf("trieKey: %x", trieKey)
 
-				reader.SelectLog(context.Background(), logIDBytes)
+				reader.SelectLog(cCtx.Context, logIDBytes)
 
 				leafIndexMatches, entriesConsidered, err = findTrieKeys(
-					context.Background(),
+					cCtx.Context,
 					cmd.Log,
 					reader,
 					tenantLogPath,
@@ -335,12 +335,12 @@ func NewFindTrieEntriesCmd() *cli.Command {
 					[]byte(appID),
 				)
 
-				reader.SelectLog(context.Background(), logIDVersion1)
+				reader.SelectLog(cCtx.Context, logIDVersion1)
 
 				cmd.Log.Debugf("trieKey version 1: %x", trieKeyVersion1)
 
 				leafIndexMatches, entriesConsidered, err = findTrieKeys(
-					context.Background(),
+					cCtx.Context,
 					cmd.Log,
 					reader,
 					tenantLogPath,
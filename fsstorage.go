@@ -6,7 +6,6 @@ import (
 	"github.com/forestrie/go-merklelog/massifs/storage"
 	fsstorage "github.com/forestrie/go-merklelog-fs/storage"
 	"github.com/urfave/cli/v2"
-	"github.com/veraison/go-cose"
 )
 
 const (
@@ -19,29 +18,38 @@ func NewCmdStorageProviderFS(
 	dataLocal string,
 	createRootDir bool,
 ) (*fsstorage.CachingStore, error) {
-	var err error
-	massifExt := storage.V1MMRExtSep + storage.V1MMRMassifExt
+	return newStorageProviderFS(ctx, cmd, fsstorage.FSOptions{
+		MassifFile:      cCtx.String("massif-file"),
+		CheckpointFile:  cCtx.String("checkpoint-file"),
+		RootDir:         dataLocal,
+		CreateRootDir:   createRootDir,
+		MassifExtension: massifExtension(cCtx),
+	})
+}
+
+// massifExtension returns the file extension for massifs in local storage
+func massifExtension(cCtx *cli.Context) string {
 	if cCtx.IsSet("massif-ext") {
-		massifExt = cCtx.String("massif-ext")
+		return cCtx.String("massif-ext")
 	}
+	return storage.V1MMRExtSep + storage.V1MMRMassifExt
+}
 
-	opts := fsstorage.Options{
-		FSOptions: fsstorage.FSOptions{
-			MassifFile:      cCtx.String("massif-file"),
-			CheckpointFile:  cCtx.String("checkpoint-file"),
-			RootDir:         dataLocal,
-			CreateRootDir:  createRootDir,
-			MassifExtension: massifExt,
-		},
-	}
+// newStorageProviderFS creates the filesystem object store for the options,
+// for commands whose flags do not map directly to them.
+func newStorageProviderFS(
+	ctx context.Context, cmd *CmdCtx, fsOpts fsstorage.FSOptions,
+) (*fsstorage.CachingStore, error) {
+
+	opts := fsstorage.Options{FSOptions: fsOpts}
 
 	opts.MassifHeight = cmd.MassifFmt.MassifHeight
 
-	if cmd.CheckpointPublic.Public != nil {
-		verifier, err := cose.NewVerifier(cmd.CheckpointPublic.Alg, cmd.CheckpointPublic.Public)
-		if err != nil {
-			return nil, err
-		}
+	verifier, err := checkpointVerifier(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if verifier != nil {
 		opts.COSEVerifier = verifier
 	}
 
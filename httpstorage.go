@@ -0,0 +1,353 @@
+package veracity
+
+// A read only object store for logs published on any http server, for
+// example a plain web server, or an object store behind a CDN.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/massifs/watcher"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	remoteProviderAzure = "azure"
+	remoteProviderHTTP  = "http"
+
+	// httpLogsPath is the path, relative to the data url, of the logs. It
+	// mirrors the /verifiabledata/merklelogs layout of the public storage.
+	httpLogsPath          = "merklelogs/v1/mmrs/tenant/"
+	httpLogEpochDir       = "0"
+	httpMassifsDirName    = "massifs"
+	httpMassifSealsDir    = "massifseals"
+	httpIndexFileName     = "index.json"
+	httpMaxHeadIndexProbe = uint32(1) << 31
+
+	// httpProviderProbeTimeout bounds the request for the log listing made
+	// to detect the provider of a data url
+	httpProviderProbeTimeout = 5 * time.Second
+)
+
+var (
+	ErrRemoteProviderUnknown = errors.New("unknown remote provider")
+)
+
+// httpStatusError is the error for an unexpected http response status. It
+// provides the status code so that server errors can be retried.
+type httpStatusError struct {
+	URL    string
+	Status int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("GET %s: %d %s", e.URL, e.Status, http.StatusText(e.Status))
+}
+
+func (e *httpStatusError) StatusCode() int {
+	return e.Status
+}
+
+// httpLogIndex is the optional index file a server can provide, in the
+// directory of each log, to avoid discovering the head indices by probing.
+type httpLogIndex struct {
+	MassifHead     uint32 `json:"massif_head"`
+	CheckpointHead uint32 `json:"checkpoint_head"`
+}
+
+// HTTPStore reads massifs and checkpoints from a static file http server,
+// using GET and Range requests.
+//
+// The head indices are read from an index.json in the log's directory if
+// the server provides one. Otherwise they are found by probing for massifs
+// and checkpoints, which requires that they are contiguous from index 0.
+type HTTPStore struct {
+	client  *http.Client
+	dataURL string
+
+	logID       storage.LogID
+	logURL      string
+	massifs     map[uint32][]byte
+	checkpoints map[uint32][]byte
+}
+
+func NewHTTPStore(client *http.Client, dataURL string) *HTTPStore {
+	if client == nil {
+		client = &http.Client{}
+	}
+	return &HTTPStore{
+		client:      client,
+		dataURL:     strings.TrimSuffix(dataURL, "/") + "/",
+		massifs:     map[uint32][]byte{},
+		checkpoints: map[uint32][]byte{},
+	}
+}
+
+func NewCmdStorageProviderHTTP(cmd *CmdCtx, dataURL string) (*HTTPStore, error) {
+	if dataURL == "" {
+		return nil, fmt.Errorf("%w: data-url is required for the http provider", ErrRequiredOption)
+	}
+	cmd.RemoteURL = dataURL
+	return NewHTTPStore(nil, dataURL), nil
+}
+
+// remoteProvider returns the provider for reading dataURL. An explicit
+// --remote-provider is always used. Otherwise a url which serves the log
+// listing of serve-replica is read with the http provider, and a url which
+// does not have the listing, including the public logs and the storage
+// emulator, with the azure provider. Any other failure to read the listing
+// is returned, rather than guessing the provider.
+func remoteProvider(ctx context.Context, cCtx *cli.Context, cmd *CmdCtx, dataURL string) (string, error) {
+	if cCtx.IsSet("remote-provider") {
+		return cCtx.String("remote-provider"), nil
+	}
+	if dataURL == DefaultRemoteMassifURL || IsStorageEmulatorEnabled(cCtx) {
+		return remoteProviderAzure, nil
+	}
+	if !strings.HasPrefix(dataURL, "http://") && !strings.HasPrefix(dataURL, "https://") {
+		return remoteProviderAzure, nil
+	}
+	if cmd.Log == nil {
+		if err := cfgLogging(cmd, cCtx); err != nil {
+			return "", err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, httpProviderProbeTimeout)
+	defer cancel()
+	provider := remoteProviderHTTP
+	if _, err := NewHTTPStore(nil, dataURL).LogActivity(ctx); err != nil {
+		if !errors.Is(err, storage.ErrDoesNotExist) {
+			return "", fmt.Errorf(
+				"failed to detect the provider for %s, use --remote-provider: %w", dataURL, err)
+		}
+		provider = remoteProviderAzure
+	}
+	cmd.Log.Infof("reading %s with the %s provider", dataURL, provider)
+	return provider, nil
+}
+
+// newRemoteStorageProvider creates the reader for remote logs selected by --remote-provider
+func newRemoteStorageProvider(
+	ctx context.Context, cCtx *cli.Context, cmd *CmdCtx, dataURL string,
+) (omniMassifReader, error) {
+	provider, err := remoteProvider(ctx, cCtx, cmd, dataURL)
+	if err != nil {
+		return nil, err
+	}
+	switch provider {
+	case "", remoteProviderAzure:
+		return NewCmdStorageProviderAzure(ctx, cCtx, cmd, dataURL, nil)
+	case remoteProviderHTTP:
+		return NewCmdStorageProviderHTTP(cmd, dataURL)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrRemoteProviderUnknown, provider)
+	}
+}
+
+// LogActivity reads the latest activity of every log from the listing at the
+// root of the logs, as served by serve-replica. Plain http servers don't
+// provide one, and storage.ErrDoesNotExist is returned.
+func (s *HTTPStore) LogActivity(ctx context.Context) ([]watcher.LogActivity, error) {
+	url := s.dataURL + httpLogsPath + httpIndexFileName
+	data, err := s.get(ctx, url, -1)
+	if err != nil {
+		return nil, err
+	}
+	activity, err := logActivityFromData(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", url, err)
+	}
+	return activity, nil
+}
+
+func (s *HTTPStore) SelectLog(ctx context.Context, logID storage.LogID) error {
+	if logID == nil {
+		return storage.ErrLogNotSelected
+	}
+	if s.logID != nil && string(s.logID) == string(logID) {
+		return nil
+	}
+	s.logID = logID
+	s.logURL = s.dataURL + httpLogsPath + logIDString(logID) + "/" + httpLogEpochDir + "/"
+	s.massifs = map[uint32][]byte{}
+	s.checkpoints = map[uint32][]byte{}
+	return nil
+}
+
+func (s *HTTPStore) objectURL(massifIndex uint32, otype storage.ObjectType) string {
+	if otype == storage.ObjectCheckpoint {
+		return s.logURL + httpMassifSealsDir + "/" + fmt.Sprintf(storage.V1MMRSignedTreeHeadBlobNameFmt, massifIndex)
+	}
+	return s.logURL + httpMassifsDirName + "/" + fmt.Sprintf(storage.V1MMRBlobNameFmt, massifIndex)
+}
+
+func (s *HTTPStore) HeadIndex(ctx context.Context, otype storage.ObjectType) (uint32, error) {
+	if s.logID == nil {
+		return 0, storage.ErrLogNotSelected
+	}
+
+	data, err := s.get(ctx, s.logURL+httpIndexFileName, -1)
+	if err == nil {
+		var index httpLogIndex
+		if err = json.Unmarshal(data, &index); err != nil {
+			return 0, fmt.Errorf("failed to decode %s: %w", s.logURL+httpIndexFileName, err)
+		}
+		if otype == storage.ObjectCheckpoint {
+			return index.CheckpointHead, nil
+		}
+		return index.MassifHead, nil
+	}
+	if !errors.Is(err, storage.ErrDoesNotExist) {
+		return 0, err
+	}
+	return s.probeHeadIndex(ctx, otype)
+}
+
+// probeHeadIndex finds the last object by doubling the index until an object
+// is missing, then bisecting between the last found and the first missing.
+func (s *HTTPStore) probeHeadIndex(ctx context.Context, otype storage.ObjectType) (uint32, error) {
+	found, err := s.exists(ctx, 0, otype)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, storage.ErrLogEmpty
+	}
+
+	last, missing := uint32(0), uint32(1)
+	for {
+		found, err = s.exists(ctx, missing, otype)
+		if err != nil {
+			return 0, err
+		}
+		if !found {
+			break
+		}
+		if missing >= httpMaxHeadIndexProbe {
+			return 0, fmt.Errorf("no end found for the objects at %s", s.logURL)
+		}
+		last, missing = missing, missing*2
+	}
+	for missing-last > 1 {
+		mid := last + (missing-last)/2
+		found, err = s.exists(ctx, mid, otype)
+		if err != nil {
+			return 0, err
+		}
+		if found {
+			last = mid
+		} else {
+			missing = mid
+		}
+	}
+	return last, nil
+}
+
+func (s *HTTPStore) exists(ctx context.Context, massifIndex uint32, otype storage.ObjectType) (bool, error) {
+	url := s.objectURL(massifIndex, otype)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound, http.StatusForbidden:
+		// Object stores commonly respond with forbidden, rather than not
+		// found, when listing is not permitted.
+		return false, nil
+	default:
+		return false, &httpStatusError{URL: url, Status: resp.StatusCode}
+	}
+}
+
+// get reads the first n bytes of the object, or all of it if n is negative
+func (s *HTTPStore) get(ctx context.Context, url string, n int) ([]byte, error) {
+	if n == 0 {
+		return []byte{}, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", n-1))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+	case http.StatusNotFound, http.StatusForbidden:
+		return nil, fmt.Errorf("%w: %s", storage.ErrDoesNotExist, url)
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The object is empty
+		return []byte{}, nil
+	default:
+		return nil, &httpStatusError{URL: url, Status: resp.StatusCode}
+	}
+
+	var body io.Reader = resp.Body
+	if n > 0 {
+		// Servers are permitted to ignore the range and send everything
+		body = io.LimitReader(resp.Body, int64(n))
+	}
+	return io.ReadAll(body)
+}
+
+func (s *HTTPStore) MassifData(massifIndex uint32) ([]byte, bool, error) {
+	data, ok := s.massifs[massifIndex]
+	return data, ok, nil
+}
+
+func (s *HTTPStore) CheckpointData(massifIndex uint32) ([]byte, bool, error) {
+	data, ok := s.checkpoints[massifIndex]
+	return data, ok, nil
+}
+
+func (s *HTTPStore) MassifReadN(ctx context.Context, massifIndex uint32, n int) ([]byte, error) {
+	if s.logID == nil {
+		return nil, storage.ErrLogNotSelected
+	}
+	data, err := s.get(ctx, s.objectURL(massifIndex, storage.ObjectMassifData), n)
+	if err != nil {
+		return nil, err
+	}
+	s.massifs[massifIndex] = data
+	return data, nil
+}
+
+func (s *HTTPStore) CheckpointRead(ctx context.Context, massifIndex uint32) ([]byte, error) {
+	if s.logID == nil {
+		return nil, storage.ErrLogNotSelected
+	}
+	data, err := s.get(ctx, s.objectURL(massifIndex, storage.ObjectCheckpoint), -1)
+	if err != nil {
+		return nil, err
+	}
+	s.checkpoints[massifIndex] = data
+	return data, nil
+}
+
+// Put is not supported, the http store is read only
+func (s *HTTPStore) Put(
+	ctx context.Context, massifIndex uint32, ty storage.ObjectType, data []byte, failIfExists bool,
+) error {
+	return fmt.Errorf("%w: the http store is read only", storage.ErrUnsupportedCap)
+}
@@ -0,0 +1,166 @@
+package veracity
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+// newTestHTTPLog serves a log with the given number of massifs and
+// checkpoints from a static file server, and returns the data url.
+func newTestHTTPLog(t *testing.T, logID storage.LogID, massifCount, checkpointCount int) (string, string) {
+	root := t.TempDir()
+	logDir := filepath.Join(root, "verifiabledata", "merklelogs", "v1", "mmrs", "tenant", logIDString(logID), "0")
+	require.NoError(t, os.MkdirAll(filepath.Join(logDir, httpMassifsDirName), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(logDir, httpMassifSealsDir), 0755))
+	for i := 0; i < massifCount; i++ {
+		data := []byte(fmt.Sprintf("massif-%d", i))
+		require.NoError(t, os.WriteFile(filepath.Join(logDir, httpMassifsDirName, fmt.Sprintf("%016d.log", i)), data, 0644))
+	}
+	for i := 0; i < checkpointCount; i++ {
+		data := []byte(fmt.Sprintf("checkpoint-%d", i))
+		require.NoError(t, os.WriteFile(filepath.Join(logDir, httpMassifSealsDir, fmt.Sprintf("%016d.sth", i)), data, 0644))
+	}
+	server := httptest.NewServer(http.FileServer(http.Dir(root)))
+	t.Cleanup(server.Close)
+	return server.URL + "/verifiabledata", logDir
+}
+
+func TestHTTPStoreHeadIndex(t *testing.T) {
+	ctx := context.Background()
+	logID := storage.LogID([]byte("0123456789abcdef"))
+
+	for _, count := range []int{1, 2, 5, 8, 13} {
+		t.Run(fmt.Sprintf("%d massifs", count), func(t *testing.T) {
+			dataURL, _ := newTestHTTPLog(t, logID, count, count-1)
+			store := NewHTTPStore(nil, dataURL)
+			require.NoError(t, store.SelectLog(ctx, logID))
+
+			head, err := store.HeadIndex(ctx, storage.ObjectMassifData)
+			require.NoError(t, err)
+			assert.Equal(t, uint32(count-1), head)
+
+			head, err = store.HeadIndex(ctx, storage.ObjectCheckpoint)
+			if count == 1 {
+				assert.ErrorIs(t, err, storage.ErrLogEmpty)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, uint32(count-2), head)
+		})
+	}
+}
+
+func TestHTTPStoreHeadIndexFromIndexFile(t *testing.T) {
+	ctx := context.Background()
+	logID := storage.LogID([]byte("0123456789abcdef"))
+	dataURL, logDir := newTestHTTPLog(t, logID, 3, 3)
+
+	// The index takes precedence over probing
+	require.NoError(t, os.WriteFile(
+		filepath.Join(logDir, httpIndexFileName), []byte(`{"massif_head": 7, "checkpoint_head": 6}`), 0644))
+
+	store := NewHTTPStore(nil, dataURL)
+	require.NoError(t, store.SelectLog(ctx, logID))
+
+	head, err := store.HeadIndex(ctx, storage.ObjectMassifData)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(7), head)
+	head, err = store.HeadIndex(ctx, storage.ObjectCheckpoint)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(6), head)
+}
+
+func TestHTTPStoreRead(t *testing.T) {
+	ctx := context.Background()
+	logID := storage.LogID([]byte("0123456789abcdef"))
+	dataURL, _ := newTestHTTPLog(t, logID, 2, 2)
+
+	store := NewHTTPStore(nil, dataURL)
+	require.NoError(t, store.SelectLog(ctx, logID))
+
+	data, err := store.MassifReadN(ctx, 1, 6)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("massif"), data)
+
+	data, err = store.MassifReadN(ctx, 1, -1)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("massif-1"), data)
+
+	cached, ok, err := store.MassifData(1)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, data, cached)
+
+	data, err = store.CheckpointRead(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("checkpoint-0"), data)
+
+	_, err = store.MassifReadN(ctx, 2, -1)
+	assert.ErrorIs(t, err, storage.ErrDoesNotExist)
+
+	err = store.Put(ctx, 2, storage.ObjectMassifData, data, false)
+	assert.ErrorIs(t, err, storage.ErrUnsupportedCap)
+}
+
+func TestRemoteProvider(t *testing.T) {
+	newContext := func(t *testing.T, args ...string) *cli.Context {
+		set := flag.NewFlagSet("test", flag.ContinueOnError)
+		set.String("remote-provider", remoteProviderAzure, "")
+		set.String("loglevel", "TEST", "")
+		require.NoError(t, set.Parse(args))
+		return cli.NewContext(cli.NewApp(), set, nil)
+	}
+	serve := func(t *testing.T, status int) string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+				return
+			}
+			_, _ = w.Write([]byte("[]"))
+		}))
+		t.Cleanup(server.Close)
+		return server.URL + "/verifiabledata"
+	}
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name    string
+		args    []string
+		dataURL string
+		want    string
+		wantErr bool
+	}{
+		{name: "serve-replica listing", dataURL: serve(t, http.StatusOK), want: remoteProviderHTTP},
+		{name: "no listing", dataURL: serve(t, http.StatusNotFound), want: remoteProviderAzure},
+		{name: "public logs", dataURL: DefaultRemoteMassifURL, want: remoteProviderAzure},
+		{
+			name: "explicit provider", args: []string{"--remote-provider", remoteProviderHTTP},
+			dataURL: serve(t, http.StatusNotFound), want: remoteProviderHTTP,
+		},
+		{name: "server error", dataURL: serve(t, http.StatusInternalServerError), wantErr: true},
+		{name: "unreachable", dataURL: closed.URL + "/verifiabledata", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := remoteProvider(context.Background(), newContext(t, tt.args...), &CmdCtx{}, tt.dataURL)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, provider)
+		})
+	}
+}
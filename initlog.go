@@ -0,0 +1,151 @@
+package veracity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/massifs"
+	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	ErrLogExists = errors.New("the log already exists")
+)
+
+// initLog creates the first massif of a new log, and seals the empty log
+// with the signer. The massif start header is created for the massif height
+// and commitment epoch of the format options.
+func initLog(
+	ctx context.Context, store massifs.ObjectReaderWriter,
+	codec commoncbor.CBORCodec, signer *identifiableCoseSigner,
+	massifFmt MassifFormatOptions, subject string,
+) ([]byte, error) {
+
+	_, err := store.HeadIndex(ctx, storage.ObjectMassifData)
+	if err == nil {
+		return nil, ErrLogExists
+	}
+	if !errors.Is(err, storage.ErrLogEmpty) && !errors.Is(err, storage.ErrDoesNotExist) {
+		return nil, err
+	}
+
+	mc, err := massifs.CreateFirstMassifContext(
+		ctx, uint32(massifFmt.CommitmentEpoch), massifFmt.MassifHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	// The checkpoint of the empty log. Subsequent checkpoints are checked
+	// for consistency against it, in the same way as for any other.
+	verified := &massifs.VerifiedContext{
+		MassifContext: mc,
+		MMRState: massifs.MMRState{
+			Version:         int(massifs.MMRStateVersionCurrent),
+			CommitmentEpoch: uint32(massifFmt.CommitmentEpoch),
+		},
+	}
+	checkpoint, err := sealMassif(codec, signer, verified, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = massifs.CommitContext(ctx, store, &mc); err != nil {
+		return nil, fmt.Errorf("failed to write massif 0: %w", err)
+	}
+	if err = store.Put(ctx, 0, storage.ObjectCheckpoint, checkpoint, true); err != nil {
+		return nil, fmt.Errorf("failed to write checkpoint 0: %w", err)
+	}
+	return checkpoint, nil
+}
+
+// NewInitLogCmd creates a new, empty, local ledger
+func NewInitLogCmd() *cli.Command {
+	return &cli.Command{
+		Name: "init-log",
+		Usage: `create a new, empty, local ledger, sealed with the provided key.
+
+Massif 0 is created for the massif --height and --commitment-epoch, along
+with the checkpoint for the empty log. The ledger can then be used with
+append and scitt-serve, by setting --data-local to the replica directory.`,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:     "logid",
+				Usage:    "the log identity for the new ledger, a uuid",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "replicadir",
+				Usage:   `the root directory for all tenant log replicas, as used with replicate-logs`,
+				Aliases: []string{"d"},
+				Value:   ".",
+			},
+			&cli.StringFlag{
+				Name:  "sealer-key",
+				Usage: "the sealer key to use for sealing the ledger, in cose .cbor. P-256, P-384, P-521 and Ed25519 keys are supported.",
+			},
+			&cli.StringFlag{
+				Name:  "sealer-key-pem",
+				Usage: "the sealer key to use for sealing the ledger, in PEM format. P-256, P-384, P-521 and Ed25519 keys are supported.",
+			},
+			&cli.Uint64Flag{
+				Name:  "commitment-epoch",
+				Usage: "the epoch for the id timestamps of the ledger, 1 (the default) is correct until the unix epoch changes in 2038",
+				Value: 1,
+			},
+		}, sealerIdentityFlags()...),
+		Action: func(cCtx *cli.Context) error {
+			var err error
+			cmd := &CmdCtx{}
+			ctx := cCtx.Context
+
+			if err = cfgLogging(cmd, cCtx); err != nil {
+				return err
+			}
+			if err = cfgMassifFmt(cmd, cCtx); err != nil {
+				return err
+			}
+			if cmd.CBORCodec, err = massifs.NewCBORCodec(); err != nil {
+				return err
+			}
+
+			logID := ParseTenantOrLogID(cCtx.String("logid"))
+			if logID == nil {
+				return fmt.Errorf("%w: the logid must be a uuid", ErrRequiredOption)
+			}
+
+			sealingKey, err := readSealerKey(cCtx)
+			if err != nil {
+				return err
+			}
+			if sealingKey == nil {
+				return ErrSealerKeyNeeded
+			}
+			signer, err := newIdentifiableCoseSigner(sealingKey, readSealerIdentity(cCtx))
+			if err != nil {
+				return err
+			}
+			if err = writeSealerJWKS(cCtx, signer); err != nil {
+				return err
+			}
+
+			replicaDir := cCtx.String("replicadir")
+			store, err := NewCmdStorageProviderFS(ctx, cCtx, cmd, replicaDir, true)
+			if err != nil {
+				return err
+			}
+			if err = store.SelectLog(ctx, logID); err != nil {
+				return err
+			}
+
+			if _, err = initLog(ctx, store, cmd.CBORCodec, signer, cmd.MassifFmt, logIDString(logID)); err != nil {
+				return err
+			}
+			fmt.Printf("created log %s in %s, massif height %d, commitment epoch %d\n",
+				logIDString(logID), replicaDir, cmd.MassifFmt.MassifHeight, cmd.MassifFmt.CommitmentEpoch)
+			return nil
+		},
+	}
+}
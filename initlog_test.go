@@ -0,0 +1,42 @@
+package veracity
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitLog(t *testing.T) {
+	ctx := context.Background()
+	massifFmt := MassifFormatOptions{MassifHeight: 3, CommitmentEpoch: 1}
+	store, codec, signer, verifier := newTestLog(t, newTestKey(t), massifFmt.MassifHeight)
+
+	verified, err := massifs.GetContextVerified(ctx, store, &codec, verifier, 0)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), verified.MMRState.MMRSize)
+	assert.Equal(t, uint8(3), verified.Start.MassifHeight)
+	assert.Equal(t, uint32(1), verified.Start.CommitmentEpoch)
+
+	// The first entries are sealed against the checkpoint of the empty log
+	for i := range 3 {
+		leaf := sha256.Sum256([]byte{byte(i)})
+		_, err = verified.AddHashedLeaf(sha256.New(), uint64(i+1), nil, nil, nil, leaf[:])
+		require.NoError(t, err)
+	}
+	checkpoint, err := sealMassif(codec, signer, verified, "test")
+	require.NoError(t, err)
+	require.NoError(t, store.Put(ctx, 0, storage.ObjectMassifData, verified.Data, false))
+	require.NoError(t, store.Put(ctx, 0, storage.ObjectCheckpoint, checkpoint, false))
+
+	verified, err = massifs.GetContextVerified(ctx, store, &codec, verifier, 0)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), verified.MMRState.MMRSize)
+
+	_, err = initLog(ctx, store, codec, signer, massifFmt, "test")
+	assert.ErrorIs(t, err, ErrLogExists)
+}
@@ -1,7 +1,9 @@
 package keyio
 
 import (
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"errors"
 	"fmt"
@@ -43,13 +45,34 @@ var (
 	ErrKeyFormatError = errors.New("key format error")
 )
 
+// DecodedPublic is a public key, *ecdsa.PublicKey or ed25519.PublicKey, and
+// the algorithm it is used with
 type DecodedPublic struct {
 	Alg    cose.Algorithm
-	Public *ecdsa.PublicKey
+	Public crypto.PublicKey
 }
+
+// DecodedPrivate is a private key, *ecdsa.PrivateKey or ed25519.PrivateKey,
+// and the algorithm it is used with
 type DecodedPrivate struct {
 	Alg     cose.Algorithm
-	Private *ecdsa.PrivateKey
+	Private crypto.Signer
+}
+
+// COSEDecodePrivate decodes an EC2 or OKP private key
+func COSEDecodePrivate(m map[int64]any) (DecodedPrivate, error) {
+	if KTYRequireOKP(m[KeyTypeLabel]) == nil {
+		return COSEDecodeOKPPrivate(m)
+	}
+	return COSEDecodeEC2Private(m)
+}
+
+// COSEDecodePublic decodes an EC2 or OKP public key
+func COSEDecodePublic(m map[int64]any) (DecodedPublic, error) {
+	if KTYRequireOKP(m[KeyTypeLabel]) == nil {
+		return COSEDecodeOKPPublic(m)
+	}
+	return COSEDecodeEC2Public(m)
 }
 
 func COSEDecodeEC2Private(
@@ -61,7 +84,7 @@ func COSEDecodeEC2Private(
 	}
 
 	privateKey := &ecdsa.PrivateKey{
-		PublicKey: *decoded.Public,
+		PublicKey: *decoded.Public.(*ecdsa.PublicKey),
 		D:         big.NewInt(0),
 	}
 	privateKey.D.SetBytes(m[cose.KeyLabelEC2D].([]byte))
@@ -141,6 +164,93 @@ func COSEDecodeEC2Curve(m map[int64]any) (elliptic.Curve, error) {
 	}
 }
 
+// COSEDecodeOKPPrivate decodes an Ed25519 private key. The d parameter is
+// the 32 byte seed, per https://www.rfc-editor.org/rfc/rfc8037#section-2
+func COSEDecodeOKPPrivate(m map[int64]any) (DecodedPrivate, error) {
+	decoded, err := COSEDecodeOKPPublic(m)
+	if err != nil {
+		return DecodedPrivate{}, fmt.Errorf("%w: decoding public component of private key.", err)
+	}
+	d, err := DecodeLabeledBytes(m, cose.KeyLabelOKPD)
+	if err != nil {
+		return DecodedPrivate{}, fmt.Errorf("failed to decode d from map: %w", err)
+	}
+	if len(d) != ed25519.SeedSize {
+		return DecodedPrivate{}, fmt.Errorf("%w: expected %d bytes for d, got %d", ErrKeyFormatError, ed25519.SeedSize, len(d))
+	}
+	privateKey := ed25519.NewKeyFromSeed(d)
+	if !privateKey.Public().(ed25519.PublicKey).Equal(decoded.Public) {
+		return DecodedPrivate{}, fmt.Errorf("%w: x does not match d", ErrKeyFormatError)
+	}
+	return DecodedPrivate{Alg: decoded.Alg, Private: privateKey}, nil
+}
+
+// COSEDecodeOKPPublic decodes an Ed25519 public key. Only the Ed25519 curve
+// is supported, and the algorithm, if present, must be EdDSA.
+func COSEDecodeOKPPublic(m map[int64]any) (DecodedPublic, error) {
+	if err := KTYRequireOKP(m[KeyTypeLabel]); err != nil {
+		return DecodedPublic{}, fmt.Errorf("failed to decode public key from map: %w", err)
+	}
+	if label, ok := m[AlgorithmLabel]; ok {
+		if err := AlgRequireEdDSA(label); err != nil {
+			return DecodedPublic{}, fmt.Errorf("failed to decode public key from map: %w", err)
+		}
+	}
+
+	curve, err := decodeLabeledInt(m, cose.KeyLabelOKPCurve)
+	if err != nil {
+		return DecodedPublic{}, err
+	}
+	if cose.Curve(curve) != cose.CurveEd25519 {
+		return DecodedPublic{}, fmt.Errorf("unsupported curve label in COSE key map: %d", curve)
+	}
+
+	x, err := DecodeLabeledBytes(m, cose.KeyLabelOKPX)
+	if err != nil {
+		return DecodedPublic{}, fmt.Errorf("failed to decode x from map: %w", err)
+	}
+	if len(x) != ed25519.PublicKeySize {
+		return DecodedPublic{}, fmt.Errorf("%w: expected %d bytes for x, got %d", ErrKeyFormatError, ed25519.PublicKeySize, len(x))
+	}
+	return DecodedPublic{Alg: cose.AlgorithmEdDSA, Public: ed25519.PublicKey(x)}, nil
+}
+
+// KTYRequireOKP returns an error if the label is not OKP
+func KTYRequireOKP(label any) error {
+	if s, ok := label.(string); ok {
+		if s != "OKP" {
+			return fmt.Errorf("%w: expected OKP or %d, got %s", ErrKeyFormatError, cose.KeyTypeOKP, s)
+		}
+		return nil
+	}
+	i64, err := decodeInt(label)
+	if err != nil {
+		return err
+	}
+	if cose.KeyType(i64) != cose.KeyTypeOKP {
+		return fmt.Errorf("%w: expected OKP or %d, got %d", ErrKeyFormatError, cose.KeyTypeOKP, i64)
+	}
+	return nil
+}
+
+func AlgRequireEdDSA(label any) error {
+	if s, ok := label.(string); ok {
+		if s != "EdDSA" {
+			return fmt.Errorf("%w: decoding string label, expected EdDSA, got %s", ErrKeyFormatError, s)
+		}
+		return nil
+	}
+	i64, err := decodeInt(label)
+	if err != nil {
+		return err
+	}
+	if cose.Algorithm(i64) != cose.AlgorithmEdDSA {
+		return fmt.Errorf(
+			"%w: decoding integer label expected %d, got %d", ErrKeyFormatError, cose.AlgorithmEdDSA, i64)
+	}
+	return nil
+}
+
 // KTYRequireEC2 returns an error if the label is not EC2
 // The strings "EC" and "EC2" are accepted as an accommodation for JOSE
 // Both uint64 and int64 are accepted as accommodations for sloppy encoders.
@@ -219,6 +329,27 @@ func DecodeLabeledBytes(m map[int64]interface{}, label int64) ([]byte, error) {
 	return DecodeBytes(v)
 }
 
+func decodeLabeledInt(m map[int64]any, label int64) (int64, error) {
+	v, ok := m[label]
+	if !ok {
+		return 0, fmt.Errorf("missing label %d in map", label)
+	}
+	return decodeInt(v)
+}
+
+// decodeInt accepts both int64 and uint64, as an accommodation for sloppy encoders
+func decodeInt(label any) (int64, error) {
+	i64, ok := label.(int64)
+	if ok {
+		return i64, nil
+	}
+	u64, ok := label.(uint64)
+	if !ok {
+		return 0, fmt.Errorf("%w: expected [uint64|int64] not %T", ErrKeyFormatError, label)
+	}
+	return int64(u64), nil
+}
+
 func DecodeBytes(label any) ([]byte, error) {
 	b, ok := label.([]byte)
 	if ok {
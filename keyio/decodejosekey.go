@@ -2,6 +2,7 @@ package keyio
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"encoding/base64"
 	"encoding/json"
@@ -13,15 +14,18 @@ import (
 	"github.com/veraison/go-cose"
 )
 
-// JWK represents a single JOSE key (simplified for EC public keys)
+// JWK represents a single JOSE key (simplified for EC and OKP public keys)
 type JWK struct {
 	Kty string `json:"kty"`
 	Crv string `json:"crv"`
 	X   string `json:"x"`
-	Y   string `json:"y"`
+	Y   string `json:"y,omitempty"`
 	Alg string `json:"alg,omitempty"`
 	Use string `json:"use,omitempty"`
 	Kid string `json:"kid,omitempty"`
+	// Nbf and Exp, in unix seconds, optionally limit when the key is valid
+	Nbf int64 `json:"nbf,omitempty"`
+	Exp int64 `json:"exp,omitempty"`
 }
 
 // JWKS represents a JOSE key set
@@ -31,23 +35,71 @@ type JWKS struct {
 
 // ReadECDSAPublicJOSE decodes a JSON-encoded JOSE EC public key set and returns the first *last* key as DecodedPublic
 func ReadECDSAPublicJOSE(fileName string) (DecodedPublic, error) {
+	jwk, err := readLastJWK(fileName)
+	if err != nil {
+		return DecodedPublic{}, err
+	}
+	if jwk.Kty != "EC" {
+		return DecodedPublic{}, errors.New("only EC keys are supported")
+	}
+	return JWKPublic(jwk)
+}
 
+// ReadPublicJOSE decodes a JSON-encoded JOSE EC or OKP public key set and returns the *last* key as DecodedPublic
+func ReadPublicJOSE(fileName string) (DecodedPublic, error) {
+	jwk, err := readLastJWK(fileName)
+	if err != nil {
+		return DecodedPublic{}, err
+	}
+	return JWKPublic(jwk)
+}
+
+func readLastJWK(fileName string) (JWK, error) {
 	joseKey, err := os.ReadFile(fileName)
 	if err != nil {
-		return DecodedPublic{}, fmt.Errorf("failed to read public keyset file: %w", err)
+		return JWK{}, fmt.Errorf("failed to read public keyset file: %w", err)
 	}
 
 	var jwks JWKS
 	if err := json.Unmarshal(joseKey, &jwks); err != nil {
-		return DecodedPublic{}, err
+		return JWK{}, err
 	}
 	if len(jwks.Keys) == 0 {
-		return DecodedPublic{}, errors.New("no keys found in JWKS")
+		return JWK{}, errors.New("no keys found in JWKS")
 	}
-	jwk := jwks.Keys[len(jwks.Keys)-1]
-	if jwk.Kty != "EC" {
-		return DecodedPublic{}, errors.New("only EC keys are supported")
+	return jwks.Keys[len(jwks.Keys)-1], nil
+}
+
+// JWKPublic decodes an EC or OKP (Ed25519) JWK
+func JWKPublic(jwk JWK) (DecodedPublic, error) {
+	switch jwk.Kty {
+	case "EC":
+		return jwkECPublic(jwk)
+	case "OKP":
+		return jwkOKPPublic(jwk)
+	default:
+		return DecodedPublic{}, fmt.Errorf("%w: kty %s, only EC and OKP keys are supported", ErrKeyFormatError, jwk.Kty)
+	}
+}
+
+func jwkOKPPublic(jwk JWK) (DecodedPublic, error) {
+	if jwk.Crv != "Ed25519" {
+		return DecodedPublic{}, fmt.Errorf("%w: curve %s invalid for OKP keys", ErrKeyFormatError, jwk.Crv)
+	}
+	if jwk.Alg != "" && jwk.Alg != "EdDSA" {
+		return DecodedPublic{}, fmt.Errorf("%w: alg %s invalid for OKP keys", ErrKeyFormatError, jwk.Alg)
 	}
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil {
+		return DecodedPublic{}, err
+	}
+	if len(x) != ed25519.PublicKeySize {
+		return DecodedPublic{}, fmt.Errorf("%w: expected %d bytes for x, got %d", ErrKeyFormatError, ed25519.PublicKeySize, len(x))
+	}
+	return DecodedPublic{Public: ed25519.PublicKey(x), Alg: cose.AlgorithmEdDSA}, nil
+}
+
+func jwkECPublic(jwk JWK) (DecodedPublic, error) {
 	// Decode base64url-encoded X and Y
 	// Use base64.RawURLEncoding to decode JOSE base64url values (no padding)
 	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
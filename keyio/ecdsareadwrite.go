@@ -2,6 +2,7 @@ package keyio
 
 import (
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
@@ -163,29 +164,53 @@ func WriteECDSAPrivateCOSE(
 
 // Encode private key to COSE_Key format (as CBOR bytes)
 func encodePrivateKeyToCOSE(key *ecdsa.PrivateKey) ([]byte, error) {
-	m := map[int64]interface{}{
-		int64(1):              int64(cose.KeyTypeEC2),
-		int64(3):              cose.AlgorithmPS256,
-		cose.KeyLabelEC2Curve: cose.CurveP256, // P-256
-		cose.KeyLabelEC2X:     key.PublicKey.X.Bytes(),
-		cose.KeyLabelEC2Y:     key.PublicKey.Y.Bytes(),
-		cose.KeyLabelEC2D:     key.D.Bytes(),
+	m, err := ec2PublicKeyMap(&key.PublicKey)
+	if err != nil {
+		return nil, err
 	}
+	m[cose.KeyLabelEC2D] = key.D.FillBytes(make([]byte, ec2CoordinateSize(key.Curve)))
 	return cbor.Marshal(m)
 }
 
 // Encode public key to COSE_Key format (as CBOR bytes)
 func encodePublicKeyToCOSE(key *ecdsa.PublicKey) ([]byte, error) {
-	m := map[int64]interface{}{
-		int64(1):              int64(cose.KeyTypeEC2),
-		int64(3):              cose.AlgorithmPS256,
-		cose.KeyLabelEC2Curve: cose.CurveP256, // P-256
-		cose.KeyLabelEC2X:     key.X.Bytes(),
-		cose.KeyLabelEC2Y:     key.Y.Bytes(),
+	m, err := ec2PublicKeyMap(key)
+	if err != nil {
+		return nil, err
 	}
 	return cbor.Marshal(m)
 }
 
+// ec2PublicKeyMap returns the COSE_Key map for the public key, the algorithm
+// is the one appropriate for the curve.
+func ec2PublicKeyMap(key *ecdsa.PublicKey) (map[int64]any, error) {
+	var crv cose.Curve
+	var alg cose.Algorithm
+	switch key.Curve.Params().Name {
+	case "P-256":
+		crv, alg = cose.CurveP256, cose.AlgorithmES256
+	case "P-384":
+		crv, alg = cose.CurveP384, cose.AlgorithmES384
+	case "P-521":
+		crv, alg = cose.CurveP521, cose.AlgorithmES512
+	default:
+		return nil, fmt.Errorf("%w: curve %s invalid for EC keys", ErrKeyFormatError, key.Curve.Params().Name)
+	}
+	size := ec2CoordinateSize(key.Curve)
+	return map[int64]any{
+		KeyTypeLabel:          int64(cose.KeyTypeEC2),
+		AlgorithmLabel:        int64(alg),
+		cose.KeyLabelEC2Curve: int64(crv),
+		cose.KeyLabelEC2X:     key.X.FillBytes(make([]byte, size)),
+		cose.KeyLabelEC2Y:     key.Y.FillBytes(make([]byte, size)),
+	}, nil
+}
+
+// ec2CoordinateSize is the size of the coordinates, including leading zeros
+func ec2CoordinateSize(curve elliptic.Curve) int {
+	return (curve.Params().BitSize + 7) / 8
+}
+
 func WriteCoseECDSAPrivateKey(
 	fileName string,
 	privateKey *ecdsa.PrivateKey,
@@ -0,0 +1,95 @@
+package keyio
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/veraison/go-cose"
+)
+
+// PublicJWK encodes an EC or Ed25519 public key as a JWK. If kid is empty,
+// the RFC 7638 thumbprint of the key is used.
+func PublicJWK(publicKey crypto.PublicKey, alg cose.Algorithm, kid string) (JWK, error) {
+	var jwk JWK
+	switch pub := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		switch pub.Curve.Params().Name {
+		case "P-256", "P-384", "P-521":
+		default:
+			return JWK{}, fmt.Errorf("%w: curve %s invalid for EC keys", ErrKeyFormatError, pub.Curve.Params().Name)
+		}
+		// The coordinates are the full size of the curve, including leading zeros
+		size := ec2CoordinateSize(pub.Curve)
+		jwk = JWK{
+			Kty: "EC",
+			Crv: pub.Curve.Params().Name,
+			X:   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+			Y:   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+		}
+	case ed25519.PublicKey:
+		jwk = JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+		}
+	default:
+		return JWK{}, fmt.Errorf("%w: %T", ErrKeyTypeUnsupported, publicKey)
+	}
+	jwk.Alg = alg.String()
+	jwk.Use = "sig"
+	jwk.Kid = kid
+
+	if jwk.Kid == "" {
+		thumbprint, err := JWKThumbprint(jwk)
+		if err != nil {
+			return JWK{}, err
+		}
+		jwk.Kid = thumbprint
+	}
+	return jwk, nil
+}
+
+// JWKThumbprint returns the RFC 7638 SHA-256 thumbprint of an EC or OKP JWK, base64url encoded
+func JWKThumbprint(jwk JWK) (string, error) {
+	// The required members only, in lexicographic order and without
+	// whitespace. OKP keys have no y, per RFC 8037.
+	var required []byte
+	var err error
+	switch jwk.Kty {
+	case "EC":
+		required, err = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y})
+	case "OKP":
+		required, err = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X})
+	default:
+		return "", fmt.Errorf("%w: kty %s, only EC and OKP keys are supported", ErrKeyFormatError, jwk.Kty)
+	}
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(required)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// WriteJWKS writes the keys as a JOSE key set
+func WriteJWKS(fileName string, keys ...JWK) error {
+	data, err := json.MarshalIndent(JWKS{Keys: keys}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, append(data, '\n'), ECDSAPublicDefaultPerm)
+}
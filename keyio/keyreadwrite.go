@@ -0,0 +1,235 @@
+package keyio
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+// The key types supported for signing. The EC curves use ES256, ES384 and
+// ES512 respectively, and Ed25519 uses EdDSA.
+const (
+	KeyTypeP256    = "P-256"
+	KeyTypeP384    = "P-384"
+	KeyTypeP521    = "P-521"
+	KeyTypeEd25519 = "Ed25519"
+)
+
+const (
+	Ed25519PublicDefaultPEMFileName  = "ed25519-key-public.pem"
+	Ed25519PrivateDefaultPEMFileName = "ed25519-key-private.pem"
+	Ed25519PrivateDefaultFileName    = "ed25519-key-private.cbor"
+)
+
+var (
+	ErrKeyTypeUnsupported = errors.New("key type not supported, use P-256, P-384, P-521 or Ed25519")
+)
+
+// GenerateKey generates a new signing key of the key type
+func GenerateKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case KeyTypeP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyTypeP521:
+		return ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case KeyTypeEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrKeyTypeUnsupported, keyType)
+	}
+}
+
+// AlgForPublic returns the algorithm for the public key. Per rfc 8152, each
+// EC curve has a single appropriate algorithm.
+func AlgForPublic(pub crypto.PublicKey) (cose.Algorithm, error) {
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch pub.Curve.Params().Name {
+		case "P-256":
+			return cose.AlgorithmES256, nil
+		case "P-384":
+			return cose.AlgorithmES384, nil
+		case "P-521":
+			return cose.AlgorithmES512, nil
+		}
+		return 0, fmt.Errorf("%w: curve %s", ErrKeyTypeUnsupported, pub.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return cose.AlgorithmEdDSA, nil
+	default:
+		return 0, fmt.Errorf("%w: %T", ErrKeyTypeUnsupported, pub)
+	}
+}
+
+// ReadPublicCOSE reads an EC2 or OKP public key in COSE_Key format
+func ReadPublicCOSE(fileName string) (DecodedPublic, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return DecodedPublic{}, fmt.Errorf("failed to read public key file: %w", err)
+	}
+	var m map[int64]any
+	if err := cbor.Unmarshal(data, &m); err != nil {
+		return DecodedPublic{}, err
+	}
+	return COSEDecodePublic(m)
+}
+
+// ReadPrivateCOSE reads an EC2 or OKP private key in COSE_Key format
+func ReadPrivateCOSE(fileName string) (DecodedPrivate, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return DecodedPrivate{}, fmt.Errorf("failed to read private key file: %w", err)
+	}
+	var m map[int64]any
+	if err := cbor.Unmarshal(data, &m); err != nil {
+		return DecodedPrivate{}, err
+	}
+	return COSEDecodePrivate(m)
+}
+
+// ReadPrivatePEM reads an EC private key, in SEC 1 or PKCS #8 form, or an
+// Ed25519 private key in PKCS #8 form.
+func ReadPrivatePEM(filePath string) (DecodedPrivate, error) {
+	pemData, err := os.ReadFile(filePath)
+	if err != nil {
+		return DecodedPrivate{}, err
+	}
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return DecodedPrivate{}, errors.New("invalid PEM block or type")
+	}
+
+	var key any
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return DecodedPrivate{}, errors.New("invalid PEM block or type")
+	}
+	if err != nil {
+		return DecodedPrivate{}, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return DecodedPrivate{}, fmt.Errorf("%w: %T", ErrKeyTypeUnsupported, key)
+	}
+	alg, err := AlgForPublic(signer.Public())
+	if err != nil {
+		return DecodedPrivate{}, err
+	}
+	return DecodedPrivate{Alg: alg, Private: signer}, nil
+}
+
+// ReadPublicPEM reads an EC or Ed25519 public key in PKIX form
+func ReadPublicPEM(filePath string) (DecodedPublic, error) {
+	pemData, err := os.ReadFile(filePath)
+	if err != nil {
+		return DecodedPublic{}, err
+	}
+	block, _ := pem.Decode(pemData)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return DecodedPublic{}, errors.New("invalid PEM block or type")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return DecodedPublic{}, err
+	}
+	alg, err := AlgForPublic(key)
+	if err != nil {
+		return DecodedPublic{}, err
+	}
+	return DecodedPublic{Alg: alg, Public: key}, nil
+}
+
+// WritePrivateCOSE writes an EC or Ed25519 private key in COSE_Key format, with 0600 permissions
+func WritePrivateCOSE(fileName string, key crypto.Signer) error {
+	var data []byte
+	var err error
+	switch key := key.(type) {
+	case *ecdsa.PrivateKey:
+		data, err = encodePrivateKeyToCOSE(key)
+	case ed25519.PrivateKey:
+		m := okpPublicKeyMap(key.Public().(ed25519.PublicKey))
+		m[cose.KeyLabelOKPD] = key.Seed()
+		data, err = cbor.Marshal(m)
+	default:
+		return fmt.Errorf("%w: %T", ErrKeyTypeUnsupported, key)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, data, ECDSAPrivateDefaultPerm)
+}
+
+// WritePublicCOSE writes an EC or Ed25519 public key in COSE_Key format
+func WritePublicCOSE(fileName string, pub crypto.PublicKey) error {
+	var data []byte
+	var err error
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		data, err = encodePublicKeyToCOSE(pub)
+	case ed25519.PublicKey:
+		data, err = cbor.Marshal(okpPublicKeyMap(pub))
+	default:
+		return fmt.Errorf("%w: %T", ErrKeyTypeUnsupported, pub)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, data, ECDSAPublicDefaultPerm)
+}
+
+// WritePrivatePEM writes an EC private key in SEC 1 form, or an Ed25519
+// private key in PKCS #8 form, with 0600 permissions
+func WritePrivatePEM(pemFile string, key crypto.Signer) error {
+	block := &pem.Block{Type: "PRIVATE KEY"}
+	var err error
+	switch key := key.(type) {
+	case *ecdsa.PrivateKey:
+		block.Type = "EC PRIVATE KEY"
+		block.Bytes, err = x509.MarshalECPrivateKey(key)
+	case ed25519.PrivateKey:
+		block.Bytes, err = x509.MarshalPKCS8PrivateKey(key)
+	default:
+		return fmt.Errorf("%w: %T", ErrKeyTypeUnsupported, key)
+	}
+	if err != nil {
+		return fmt.Errorf("PEM encoding failed: %w", err)
+	}
+	return os.WriteFile(pemFile, pem.EncodeToMemory(block), ECDSAPrivateDefaultPerm)
+}
+
+// WritePublicPEM writes an EC or Ed25519 public key in PKIX form
+func WritePublicPEM(pemFile string, pub crypto.PublicKey) error {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return fmt.Errorf("PEM encoding failed: %w", err)
+	}
+	block := &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	return os.WriteFile(pemFile, pem.EncodeToMemory(block), ECDSAPublicDefaultPerm)
+}
+
+// okpPublicKeyMap returns the COSE_Key map for an Ed25519 public key
+func okpPublicKeyMap(pub ed25519.PublicKey) map[int64]any {
+	return map[int64]any{
+		KeyTypeLabel:          int64(cose.KeyTypeOKP),
+		AlgorithmLabel:        int64(cose.AlgorithmEdDSA),
+		cose.KeyLabelOKPCurve: int64(cose.CurveEd25519),
+		cose.KeyLabelOKPX:     []byte(pub),
+	}
+}
@@ -0,0 +1,169 @@
+package keyio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+var (
+	ErrKeySetEmpty       = errors.New("no keys found in the key set")
+	ErrKeySetDuplicateID = errors.New("the kid is used by more than one key in the key set")
+)
+
+// KeySetKey is a public key in a key set, identified by its kid. If
+// NotBefore or NotAfter are set, the key is only valid for signatures made in
+// that window.
+type KeySetKey struct {
+	DecodedPublic
+	Kid       string
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// ValidAt returns true if the key may be used to verify a signature made at t
+func (k KeySetKey) ValidAt(t time.Time) bool {
+	if !k.NotBefore.IsZero() && t.Before(k.NotBefore) {
+		return false
+	}
+	if !k.NotAfter.IsZero() && !t.Before(k.NotAfter) {
+		return false
+	}
+	return true
+}
+
+// KeySet is a set of public keys, for verifying signatures made by a signer
+// whose keys are rotated.
+type KeySet struct {
+	Keys []KeySetKey
+}
+
+// NewKeySet creates a key set from the keys. Keys without a kid are
+// identified by the RFC 7638 thumbprint of the key. Each kid must be unique.
+func NewKeySet(keys ...KeySetKey) (KeySet, error) {
+	if len(keys) == 0 {
+		return KeySet{}, ErrKeySetEmpty
+	}
+	kids := map[string]bool{}
+	for i := range keys {
+		if keys[i].Kid == "" {
+			jwk, err := PublicJWK(keys[i].Public, keys[i].Alg, "")
+			if err != nil {
+				return KeySet{}, err
+			}
+			keys[i].Kid = jwk.Kid
+		}
+		if kids[keys[i].Kid] {
+			return KeySet{}, fmt.Errorf("%w: %s", ErrKeySetDuplicateID, keys[i].Kid)
+		}
+		kids[keys[i].Kid] = true
+	}
+	return KeySet{Keys: keys}, nil
+}
+
+// Lookup returns the key identified by kid, if it is in the set
+func (ks KeySet) Lookup(kid string) (KeySetKey, bool) {
+	for _, k := range ks.Keys {
+		if k.Kid == kid {
+			return k, true
+		}
+	}
+	return KeySetKey{}, false
+}
+
+// ReadKeySetJOSE reads every EC and OKP key of a JWKS. The optional nbf and
+// exp members, in unix seconds, set the window in which a key is valid.
+func ReadKeySetJOSE(fileName string) (KeySet, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return KeySet{}, fmt.Errorf("failed to read public keyset file: %w", err)
+	}
+	var jwks JWKS
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return KeySet{}, err
+	}
+
+	var keys []KeySetKey
+	for _, jwk := range jwks.Keys {
+		pub, err := JWKPublic(jwk)
+		if err != nil {
+			return KeySet{}, fmt.Errorf("kid %s: %w", jwk.Kid, err)
+		}
+		key := KeySetKey{DecodedPublic: pub, Kid: jwk.Kid}
+		if jwk.Nbf != 0 {
+			key.NotBefore = time.Unix(jwk.Nbf, 0)
+		}
+		if jwk.Exp != 0 {
+			key.NotAfter = time.Unix(jwk.Exp, 0)
+		}
+		keys = append(keys, key)
+	}
+	return NewKeySet(keys...)
+}
+
+// ReadKeySetCOSE reads every EC2 and OKP key of a COSE_KeySet. The kid is
+// read from the kid label of each key.
+func ReadKeySetCOSE(fileName string) (KeySet, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return KeySet{}, fmt.Errorf("failed to read public keyset file: %w", err)
+	}
+	var coseKeys []map[int64]any
+	if err := cbor.Unmarshal(data, &coseKeys); err != nil {
+		return KeySet{}, err
+	}
+
+	var keys []KeySetKey
+	for i, m := range coseKeys {
+		pub, err := COSEDecodePublic(m)
+		if err != nil {
+			return KeySet{}, fmt.Errorf("key %d: %w", i, err)
+		}
+		key := KeySetKey{DecodedPublic: pub}
+		switch kid := m[KeyIDLabel].(type) {
+		case nil:
+		case []byte:
+			key.Kid = string(kid)
+		case string:
+			key.Kid = kid
+		default:
+			return KeySet{}, fmt.Errorf("%w: key %d: kid must be bstr or tstr, got %T", ErrKeyFormatError, i, kid)
+		}
+		keys = append(keys, key)
+	}
+	return NewKeySet(keys...)
+}
+
+// ReadKeySetPEMDir reads every public key PEM file, with the .pem extension,
+// in the directory. Each key is identified by its RFC 7638 thumbprint.
+func ReadKeySetPEMDir(dir string) (KeySet, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return KeySet{}, fmt.Errorf("failed to read public key directory: %w", err)
+	}
+	var fileNames []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".pem") {
+			continue
+		}
+		fileNames = append(fileNames, filepath.Join(dir, entry.Name()))
+	}
+	sort.Strings(fileNames)
+
+	var keys []KeySetKey
+	for _, fileName := range fileNames {
+		pub, err := ReadPublicPEM(fileName)
+		if err != nil {
+			return KeySet{}, fmt.Errorf("%s: %w", fileName, err)
+		}
+		keys = append(keys, KeySetKey{DecodedPublic: pub})
+	}
+	return NewKeySet(keys...)
+}
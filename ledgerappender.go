@@ -0,0 +1,250 @@
+package veracity
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/datatrails/veracity/scitt"
+	"github.com/forestrie/go-merklelog/massifs"
+	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/veraison/go-cose"
+)
+
+// sealedMassif is a massif, and the checkpoint which seals it
+type sealedMassif struct {
+	Massif massifs.MassifContext
+	// State is the sealed state, including the peaks, which are not present
+	// in the checkpoint.
+	State      massifs.MMRState
+	Checkpoint []byte
+}
+
+// ledgerAppender adds statements to the head massif of a local ledger. When
+// the head massif is full, it is sealed and the next massif is started, with
+// the peak stack carried forward.
+type ledgerAppender struct {
+	codec   commoncbor.CBORCodec
+	signer  *identifiableCoseSigner
+	subject string
+
+	// head is the massif statements are added to. Its state is the last
+	// sealed state of the ledger, which is the state the next checkpoint is
+	// checked for consistency against.
+	head *massifs.VerifiedContext
+	// sealed are the massifs sealed by the appender, in order.
+	sealed []sealedMassif
+}
+
+func newLedgerAppender(
+	codec commoncbor.CBORCodec, signer *identifiableCoseSigner, subject string, head *massifs.VerifiedContext,
+) *ledgerAppender {
+	return &ledgerAppender{codec: codec, signer: signer, subject: subject, head: head}
+}
+
+// massifFull reports whether all the leaves for the massif height have been added
+func massifFull(mc *massifs.MassifContext) bool {
+	return uint64(len(mc.Data))-mc.LogStart() >= massifs.TreeSize(mc.Start.MassifHeight)
+}
+
+// Add adds the statement to the head massif, starting the next massif first if it is full
+func (a *ledgerAppender) Add(mmrStatement *scitt.MMRStatement) error {
+	if massifFull(&a.head.MassifContext) {
+		if err := a.rollover(); err != nil {
+			return err
+		}
+	}
+	return addStatement(&a.head.MassifContext, mmrStatement)
+}
+
+// Seal seals the head massif, and returns all the massifs sealed by the
+// appender. The last is the head massif.
+func (a *ledgerAppender) Seal() ([]sealedMassif, error) {
+	if _, err := a.sealHead(); err != nil {
+		return nil, err
+	}
+	return a.sealed, nil
+}
+
+// Sealed returns the sealed massif containing the mmr index
+func (a *ledgerAppender) Sealed(mmrIndex uint64) (sealedMassif, bool) {
+	for _, s := range a.sealed {
+		if mmrIndex >= s.Massif.Start.FirstIndex && mmrIndex < s.State.MMRSize {
+			return s, true
+		}
+	}
+	return sealedMassif{}, false
+}
+
+func (a *ledgerAppender) sealHead() (sealedMassif, error) {
+	checkpoint, err := sealMassif(a.codec, a.signer, a.head, a.subject)
+	if err != nil {
+		return sealedMassif{}, err
+	}
+
+	// note that state is not verified here, but we just signed it so it is our droid
+	_, state, err := massifs.DecodeSignedRoot(a.codec, checkpoint)
+	if err != nil {
+		return sealedMassif{}, err
+	}
+	// An empty log has no peaks
+	state.Peaks = nil
+	if state.MMRSize > 0 {
+		state.Peaks, err = mmr.PeakHashes(&a.head.MassifContext, state.MMRSize-1)
+		if err != nil {
+			return sealedMassif{}, err
+		}
+	}
+
+	a.head.MMRState = state
+	sealed := sealedMassif{Massif: a.head.MassifContext, State: state, Checkpoint: checkpoint}
+	a.sealed = append(a.sealed, sealed)
+	return sealed, nil
+}
+
+// rollover seals the full head massif, and starts the next. The new massif
+// starts with the peak stack of the full massif, and the sealed state of the
+// full massif is the state its first checkpoint is checked against.
+func (a *ledgerAppender) rollover() error {
+	var err error
+
+	// The head may already be sealed, if it was filled by an earlier append
+	full := sealedMassif{Massif: a.head.MassifContext, State: a.head.MMRState}
+	if a.head.MMRState.MMRSize != a.head.RangeCount() {
+		if full, err = a.sealHead(); err != nil {
+			return err
+		}
+	}
+
+	// Starting the next massif re-uses the peak stack of the full massif in
+	// place, so it must work on a copy, or the sealed data is changed.
+	next := full.Massif
+	next.Data = append([]byte(nil), full.Massif.Data...)
+	next.Creating = true
+	if err = next.StartNextMassif(); err != nil {
+		return err
+	}
+	if err = next.CreatePeakStackMap(); err != nil {
+		return err
+	}
+	a.head = &massifs.VerifiedContext{MassifContext: next, MMRState: full.State}
+	return nil
+}
+
+// ledgerHead returns the index of the head massif of the ledger, which is the
+// last massif with a checkpoint. commitSealed writes each massif before its
+// checkpoint, so an interrupted append can leave the massif after the head
+// started but not sealed, started reports that. Any other massif without a
+// checkpoint is refused.
+func ledgerHead(ctx context.Context, store massifs.ObjectReader) (uint32, bool, error) {
+	headIndex, err := store.HeadIndex(ctx, storage.ObjectCheckpoint)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get head index: %w", err)
+	}
+	massifHeadIndex, err := store.HeadIndex(ctx, storage.ObjectMassifData)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get head index: %w", err)
+	}
+	if massifHeadIndex != headIndex && massifHeadIndex != headIndex+1 {
+		return 0, false, fmt.Errorf("%w: massif %d, checkpoint %d", ErrLedgerUnsealed, massifHeadIndex, headIndex)
+	}
+	return headIndex, massifHeadIndex != headIndex, nil
+}
+
+// ledgerAppendHead reads the verified head massif of the ledger, ready to be
+// appended to. The leaves an interrupted append left after the head
+// checkpoint were never sealed, and no receipt was issued for them, so they
+// are discarded rather than sealed by the next append. The returned started
+// is passed to commitSealed, so that a massif started by the interrupted
+// append is replaced.
+//
+// The head of a forked ledger is sealed by the log it was forked from until it
+// is first appended to. The leaves after its checkpoint were replicated from
+// that log, so they are kept and sealed by the first append.
+func ledgerAppendHead(
+	ctx context.Context, store massifs.ObjectReader, codec *commoncbor.CBORCodec, verifiers []cose.Verifier,
+) (*massifs.VerifiedContext, bool, error) {
+	headIndex, started, err := ledgerHead(ctx, store)
+	if err != nil {
+		return nil, false, err
+	}
+	verified, verifier, err := verifiedLedgerContext(ctx, store, codec, verifiers, headIndex)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read verified head massif: %w", err)
+	}
+	// The first verifier is for the key the ledger is sealed with
+	if verifier != verifiers[0] {
+		if started {
+			return nil, false, fmt.Errorf("%w: massif %d, checkpoint %d", ErrLedgerUnsealed, headIndex+1, headIndex)
+		}
+		return verified, false, nil
+	}
+	discardUnsealed(verified)
+	return verified, started, nil
+}
+
+// discardUnsealed removes the leaves after the sealed state from the massif,
+// clears their trie entries, and restores the last id timestamp of the sealed
+// state.
+func discardUnsealed(verified *massifs.VerifiedContext) {
+	if verified.MMRState.MMRSize < verified.Start.FirstIndex {
+		return
+	}
+	sealedEnd := verified.LogStart() + (verified.MMRState.MMRSize-verified.Start.FirstIndex)*massifs.ValueBytes
+	if uint64(len(verified.Data)) <= sealedEnd {
+		return
+	}
+	trieEnd := verified.IndexStart() + verified.MassifLeafCount()*massifs.TrieEntryBytes
+	verified.Data = verified.Data[:sealedEnd]
+	trieStart := verified.IndexStart() + verified.MassifLeafCount()*massifs.TrieEntryBytes
+	clear(verified.Data[trieStart:trieEnd])
+
+	verified.Start.LastID = verified.MMRState.IDTimestamp
+	binary.BigEndian.PutUint64(
+		verified.Data[massifs.MassifStartKeyLastIDFirstByte:massifs.MassifStartKeyLastIDEnd], verified.MMRState.IDTimestamp)
+}
+
+// verifiedLedgerContext reads the verified massif, trying each verifier in
+// turn. A forked ledger is sealed by a different key to the log it was forked
+// from, so more than one key may be needed. The verifier which succeeded is
+// returned with the massif.
+func verifiedLedgerContext(
+	ctx context.Context, store massifs.ObjectReader, codec *commoncbor.CBORCodec,
+	verifiers []cose.Verifier, massifIndex uint32,
+) (*massifs.VerifiedContext, cose.Verifier, error) {
+	err := ErrLedgerUnverified
+	for _, verifier := range verifiers {
+		var verified *massifs.VerifiedContext
+		verified, err = getContextVerified(ctx, store, codec, verifier, massifIndex)
+		if err == nil {
+			return verified, verifier, nil
+		}
+	}
+	return nil, nil, err
+}
+
+// commitSealed writes the sealed massifs to the ledger, each massif followed
+// by its checkpoint, so that a checkpoint never refers to data which is not
+// in the ledger. If the commit is interrupted, the massifs whose checkpoints
+// were written stay sealed, and the leaves after the last checkpoint are left
+// unsealed, for ledgerAppendHead to discard. started is set when the first
+// new massif was started by an interrupted append, and may be replaced.
+func commitSealed(ctx context.Context, store massifs.ObjectWriter, sealed []sealedMassif, started bool) error {
+	for _, s := range sealed {
+		massifIndex := s.Massif.Start.MassifIndex
+		// A new massif must not exist, otherwise the ledger was appended to concurrently
+		failIfExists := s.Massif.Creating && !started
+		if s.Massif.Creating {
+			started = false
+		}
+		if err := store.Put(ctx, massifIndex, storage.ObjectMassifData, s.Massif.Data, failIfExists); err != nil {
+			return fmt.Errorf("failed to write massif %d: %w", massifIndex, err)
+		}
+		if err := store.Put(ctx, massifIndex, storage.ObjectCheckpoint, s.Checkpoint, false); err != nil {
+			return fmt.Errorf("failed to write checkpoint %d: %w", massifIndex, err)
+		}
+	}
+	return nil
+}
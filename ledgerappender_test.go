@@ -0,0 +1,169 @@
+package veracity
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/datatrails/veracity/scitt"
+	"github.com/forestrie/go-merklelog/massifs"
+	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	commoncose "github.com/forestrie/go-merklelog/massifs/cose"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func TestLedgerAppenderRollover(t *testing.T) {
+	ctx := context.Background()
+
+	// Height 2 massifs have 2 leaves
+	store, codec, signer, verifier := newTestLog(t, newTestKey(t), 2)
+
+	var statements []*scitt.MMRStatement
+	appendBatch := func(count int) []sealedMassif {
+		verified, started, err := ledgerAppendHead(ctx, store, &codec, []cose.Verifier{verifier})
+		require.NoError(t, err)
+
+		appender := newLedgerAppender(codec, signer, "test", verified)
+		for range count {
+			statement := testStatement(len(statements))
+			require.NoError(t, appender.Add(statement))
+			statements = append(statements, statement)
+		}
+		sealed, err := appender.Seal()
+		require.NoError(t, err)
+		require.NoError(t, commitSealed(ctx, store, sealed, started))
+		return sealed
+	}
+
+	// Fill massif 0 exactly, then overflow into 1, 2 and 3 in one batch
+	assert.Len(t, appendBatch(2), 1)
+	assert.Len(t, appendBatch(5), 3)
+
+	head, err := store.HeadIndex(ctx, storage.ObjectMassifData)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), head)
+
+	// Every leaf has a verifiable receipt against the checkpoint of its massif
+	for _, statement := range statements {
+		receipt, err := massifs.NewReceipt(ctx, store, &codec, verifier, 2, statement.MMRIndexLeaf)
+		require.NoError(t, err)
+		data, err := receipt.MarshalCBOR()
+		require.NoError(t, err)
+		decoded, err := commoncose.NewCoseSign1MessageFromCBOR(data, commoncose.WithDecOptions(commoncbor.DecOptions))
+		require.NoError(t, err)
+		ok, _, err := massifs.VerifySignedInclusionReceipt(ctx, decoded, statement.LeafHash)
+		require.NoError(t, err)
+		assert.True(t, ok, "leaf %d", statement.MMRIndexLeaf)
+	}
+
+	// Only the massif after the head can be started by an interrupted append
+	require.NoError(t, store.Put(ctx, 5, storage.ObjectMassifData, []byte("interrupted"), true))
+	_, _, err = ledgerHead(ctx, store)
+	assert.ErrorIs(t, err, ErrLedgerUnsealed)
+}
+
+// failingWriter fails the numbered Put, counting from 1, as if the commit was
+// interrupted
+type failingWriter struct {
+	*memoryReader
+	failPut int
+	puts    int
+}
+
+func (w *failingWriter) Put(
+	ctx context.Context, massifIndex uint32, ty storage.ObjectType, data []byte, failIfExists bool,
+) error {
+	w.puts++
+	if w.puts == w.failPut {
+		return errors.New("interrupted")
+	}
+	return w.memoryReader.Put(ctx, massifIndex, ty, data, failIfExists)
+}
+
+func TestLedgerAppendInterrupted(t *testing.T) {
+	ctx := context.Background()
+
+	// appendBatch appends the statements, failing the numbered Put of the
+	// commit, or none if it is 0
+	appendBatch := func(
+		store *memoryReader, codec commoncbor.CBORCodec, signer *identifiableCoseSigner, verifier cose.Verifier,
+		statements []*scitt.MMRStatement, failPut int,
+	) error {
+		verified, started, err := ledgerAppendHead(ctx, store, &codec, []cose.Verifier{verifier})
+		require.NoError(t, err)
+		appender := newLedgerAppender(codec, signer, "test", verified)
+		for _, statement := range statements {
+			require.NoError(t, appender.Add(statement))
+		}
+		sealed, err := appender.Seal()
+		require.NoError(t, err)
+		return commitSealed(ctx, &failingWriter{memoryReader: store, failPut: failPut}, sealed, started)
+	}
+
+	// assertSealed checks the ledger is sealed at the size, and that the
+	// statement has a verifiable receipt
+	assertSealed := func(
+		store *memoryReader, codec commoncbor.CBORCodec, verifier cose.Verifier, mmrSize uint64, statement *scitt.MMRStatement,
+	) {
+		verified, _, err := ledgerAppendHead(ctx, store, &codec, []cose.Verifier{verifier})
+		require.NoError(t, err)
+		assert.Equal(t, mmrSize, verified.MMRState.MMRSize)
+		assert.Equal(t, mmrSize, verified.RangeCount())
+		assert.Equal(t, statement.IDTimestamp, verified.GetLastIDTimestamp())
+
+		receipt, err := massifs.NewReceipt(ctx, store, &codec, verifier, 2, statement.MMRIndexLeaf)
+		require.NoError(t, err)
+		data, err := receipt.MarshalCBOR()
+		require.NoError(t, err)
+		decoded, err := commoncose.NewCoseSign1MessageFromCBOR(data, commoncose.WithDecOptions(commoncbor.DecOptions))
+		require.NoError(t, err)
+		ok, _, err := massifs.VerifySignedInclusionReceipt(ctx, decoded, statement.LeafHash)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+
+	t.Run("leaves after the head checkpoint are discarded", func(t *testing.T) {
+		// Height 2 massifs have 2 leaves
+		store, codec, signer, verifier := newTestLog(t, newTestKey(t), 2)
+		require.NoError(t, appendBatch(store, codec, signer, verifier, []*scitt.MMRStatement{testStatement(0)}, 0))
+
+		// The head massif is written, but its checkpoint is not
+		err := appendBatch(store, codec, signer, verifier, []*scitt.MMRStatement{testStatement(1)}, 2)
+		require.Error(t, err)
+		verified, err := massifs.GetContextVerified(ctx, store, &codec, verifier, 0)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), verified.MMRState.MMRSize)
+		assert.Equal(t, uint64(3), verified.RangeCount())
+
+		// The next append replaces the unsealed leaf
+		retried := testStatement(2)
+		require.NoError(t, appendBatch(store, codec, signer, verifier, []*scitt.MMRStatement{retried}, 0))
+		assert.Equal(t, uint64(1), retried.MMRIndexLeaf)
+		assertSealed(store, codec, verifier, 3, retried)
+	})
+
+	t.Run("a started massif is replaced", func(t *testing.T) {
+		store, codec, signer, verifier := newTestLog(t, newTestKey(t), 2)
+		require.NoError(t, appendBatch(store, codec, signer, verifier, []*scitt.MMRStatement{testStatement(0), testStatement(1)}, 0))
+
+		// Massif 1 is started, but its checkpoint is not written
+		err := appendBatch(store, codec, signer, verifier, []*scitt.MMRStatement{testStatement(2)}, 2)
+		require.Error(t, err)
+		head, started, err := ledgerHead(ctx, store)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(0), head)
+		assert.True(t, started)
+
+		retried := testStatement(3)
+		require.NoError(t, appendBatch(store, codec, signer, verifier, []*scitt.MMRStatement{retried}, 0))
+		assert.Equal(t, uint64(3), retried.MMRIndexLeaf)
+		assertSealed(store, codec, verifier, 4, retried)
+		head, started, err = ledgerHead(ctx, store)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(1), head)
+		assert.False(t, started)
+	})
+}
@@ -221,7 +221,7 @@ func NewLogTailCmd() *cli.Command {
 		Action: func(cCtx *cli.Context) error {
 			var err error
 			cmd := &CmdCtx{}
-			ctx := context.Background()
+			ctx := cCtx.Context
 
 			if err = cfgMassifFmt(cmd, cCtx); err != nil {
 				return err
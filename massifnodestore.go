@@ -0,0 +1,59 @@
+package veracity
+
+import (
+	"context"
+
+	"github.com/forestrie/go-merklelog/massifs"
+)
+
+// massifNodeStore provides node access to an MMR that spans many massifs.
+//
+// A MassifContext can only read the nodes it holds, plus the ancestor peaks
+// carried forward in its peak stack. Proofs against sizes beyond the massif
+// that holds the proven node need nodes from later massifs. This store reads
+// massifs on demand and gets each node from the massif it was added to.
+//
+// It satisfies the node getter interface required by the mmr proof functions.
+type massifNodeStore struct {
+	ctx          context.Context
+	reader       massifs.ObjectReader
+	massifHeight uint8
+	contexts     map[uint32]*massifs.MassifContext
+
+	// firstMassif is the first massif of a pruned replica. Nodes added to the
+	// massifs before it are only available if they are ancestor peaks, which
+	// are carried forward in the peak stack of firstMassif.
+	firstMassif uint32
+}
+
+func newMassifNodeStore(ctx context.Context, reader massifs.ObjectReader, massifHeight uint8) *massifNodeStore {
+	return &massifNodeStore{
+		ctx:          ctx,
+		reader:       reader,
+		massifHeight: massifHeight,
+		contexts:     map[uint32]*massifs.MassifContext{},
+	}
+}
+
+// Get returns the value of the node at mmrIndex i
+func (s *massifNodeStore) Get(i uint64) ([]byte, error) {
+	massifIndex := max(uint32(massifs.MassifIndexFromMMRIndex(s.massifHeight, i)), s.firstMassif)
+	mc, err := s.Massif(massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	return mc.Get(i)
+}
+
+// Massif returns the context for massifIndex, reading it if it has not been read before.
+func (s *massifNodeStore) Massif(massifIndex uint32) (*massifs.MassifContext, error) {
+	if mc, ok := s.contexts[massifIndex]; ok {
+		return mc, nil
+	}
+	mc, err := massifs.GetMassifContext(s.ctx, s.reader, massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	s.contexts[massifIndex] = &mc
+	return &mc, nil
+}
@@ -59,7 +59,7 @@ func newMassifStore(cmd *CmdCtx, cCtx *cli.Context) (omniMassifReader, error) {
 	var reader omniMassifReader
 
 	if remoteLog != "" || IsStorageEmulatorEnabled(cCtx) {
-		reader, err = NewCmdStorageProviderAzure(context.Background(), cCtx, cmd, remoteLog, nil)
+		reader, err = newRemoteStorageProvider(cCtx.Context, cCtx, cmd, remoteLog)
 		if err != nil {
 			return nil, fmt.Errorf("could not create massif reader: %w", err)
 		}
@@ -67,7 +67,7 @@ func newMassifStore(cmd *CmdCtx, cCtx *cli.Context) (omniMassifReader, error) {
 	}
 	if localSet {
 
-		reader, err := NewCmdStorageProviderFS(context.Background(), cCtx, cmd, cCtx.String("data-local"), false)
+		reader, err := NewCmdStorageProviderFS(cCtx.Context, cCtx, cmd, cCtx.String("data-local"), false)
 		if err != nil {
 			return nil, fmt.Errorf("could not create massif reader: %w", err)
 		}
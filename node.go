@@ -1,7 +1,6 @@
 package veracity
 
 import (
-	"context"
 	"fmt"
 
 	"github.com/urfave/cli/v2"
@@ -21,7 +20,7 @@ func NewNodeCmd() *cli.Command {
 		},
 		Action: func(cCtx *cli.Context) error {
 			cmd := &CmdCtx{}
-			massif, err := cfgMassif(context.Background(), cmd, cCtx)
+			massif, err := cfgMassif(cCtx.Context, cmd, cCtx)
 			if err != nil {
 				return err
 			}
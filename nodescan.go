@@ -2,7 +2,6 @@ package veracity
 
 import (
 	"bytes"
-	"context"
 	"encoding/hex"
 	"fmt"
 
@@ -29,7 +28,7 @@ func NewNodeScanCmd() *cli.Command {
 
 			var err error
 			var massif *massifs.MassifContext
-			if massif, err = cfgMassif(context.Background(), cmd, cCtx); err != nil {
+			if massif, err = cfgMassif(cCtx.Context, cmd, cCtx); err != nil {
 				return err
 			}
 
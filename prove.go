@@ -1,18 +1,248 @@
 package veracity
 
 import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 
+	"github.com/forestrie/go-merklelog/massifs"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/fxamacker/cbor/v2"
 	"github.com/urfave/cli/v2"
 )
 
-// NewProveCmd (will) generate a proof and node path for the argument node
+const (
+	proveFmtJSON = "json"
+	proveFmtCBOR = "cbor"
+)
+
+var (
+	ErrProveOptionsInvalid = errors.New("provide --mmrindex, or both of --from-size and --to-size")
+)
+
+// proofNode is a node value which renders as hex in json output, and as a
+// byte string in cbor output.
+type proofNode []byte
+
+func (n proofNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(n))
+}
+
+func proofNodes(values [][]byte) []proofNode {
+	nodes := make([]proofNode, 0, len(values))
+	for _, v := range values {
+		nodes = append(nodes, proofNode(v))
+	}
+	return nodes
+}
+
+// InclusionProofOutput is the raw, un-signed, inclusion proof for a single
+// node. The proven node, combined with the path, reproduces the accumulator
+// peak identified by PeakIndex.
+type InclusionProofOutput struct {
+	MMRIndex    uint64      `json:"mmrindex" cbor:"1,keyasint"`
+	MMRSize     uint64      `json:"mmrsize" cbor:"2,keyasint"`
+	Node        proofNode   `json:"node" cbor:"3,keyasint"`
+	PathIndices []uint64    `json:"path_indices" cbor:"4,keyasint"`
+	Path        []proofNode `json:"path" cbor:"5,keyasint"`
+	PeakIndex   int         `json:"peak_index" cbor:"6,keyasint"`
+	Accumulator []proofNode `json:"accumulator" cbor:"7,keyasint"`
+}
+
+// ConsistencyProofOutput is the raw, un-signed, consistency proof between two
+// MMR sizes. Paths has an inclusion path in MMR(ToSize) for each peak in
+// AccumulatorFrom.
+type ConsistencyProofOutput struct {
+	FromSize        uint64        `json:"from_size" cbor:"1,keyasint"`
+	ToSize          uint64        `json:"to_size" cbor:"2,keyasint"`
+	FromPeakIndices []uint64      `json:"from_peak_indices" cbor:"3,keyasint"`
+	Paths           [][]proofNode `json:"paths" cbor:"4,keyasint"`
+	AccumulatorFrom []proofNode   `json:"accumulator_from" cbor:"5,keyasint"`
+	AccumulatorTo   []proofNode   `json:"accumulator_to" cbor:"6,keyasint"`
+}
+
+// NewProveCmd generates raw inclusion and consistency proofs for the selected log
 func NewProveCmd() *cli.Command {
 	return &cli.Command{Name: "prove",
-		Usage: "generate a proof for merklelog node",
+		Usage: `generate raw inclusion or consistency proofs for a merklelog.
+
+Provide --mmrindex for an inclusion proof, or --from-size and --to-size for a consistency proof.
+The proofs are not wrapped as COSE receipts, use the receipt command for that.
+		`,
+		Flags: []cli.Flag{
+			&cli.Uint64Flag{
+				Name: "mmrindex", Aliases: []string{"i"},
+				Usage: "the mmr index of the node to prove inclusion for",
+			},
+			&cli.Uint64Flag{
+				Name:  "mmrsize",
+				Usage: "the size of the MMR to prove inclusion in, defaults to the size of the massif containing the node",
+			},
+			&cli.Uint64Flag{
+				Name:  "from-size",
+				Usage: "the size of the earlier MMR for a consistency proof",
+			},
+			&cli.Uint64Flag{
+				Name:  "to-size",
+				Usage: "the size of the later MMR for a consistency proof",
+			},
+			&cli.StringFlag{
+				Name: "format", Aliases: []string{"f"},
+				Value: proveFmtJSON,
+				Usage: fmt.Sprintf("the output format. one of [%s, %s]", proveFmtJSON, proveFmtCBOR),
+				Action: func(ctx *cli.Context, v string) error {
+					if v != proveFmtJSON && v != proveFmtCBOR {
+						return fmt.Errorf("unsupported format '%s'. Use one of: %s, %s", v, proveFmtJSON, proveFmtCBOR)
+					}
+					return nil
+				},
+			},
+			&cli.StringFlag{
+				Name: "output", Aliases: []string{"o"},
+				Usage: "write the proof to this file rather than stdout",
+			},
+		},
 		Action: func(cCtx *cli.Context) error {
-			fmt.Println("prove: ", cCtx.Args().First())
-			return nil
+			var err error
+			cmd := &CmdCtx{}
+			ctx := cCtx.Context
+
+			inclusion := cCtx.IsSet("mmrindex")
+			consistency := cCtx.IsSet("from-size") || cCtx.IsSet("to-size")
+			if inclusion == consistency {
+				return ErrProveOptionsInvalid
+			}
+			if consistency && !(cCtx.IsSet("from-size") && cCtx.IsSet("to-size")) {
+				return ErrProveOptionsInvalid
+			}
+
+			reader, err := cfgMassifReader(cmd, cCtx)
+			if err != nil {
+				return err
+			}
+			logID := CtxGetOneLogOption(cCtx)
+			if logID == nil {
+				return fmt.Errorf("a tenant or logid is required for this command")
+			}
+			if err = reader.SelectLog(ctx, logID); err != nil {
+				return err
+			}
+
+			store := newMassifNodeStore(ctx, reader, cmd.MassifFmt.MassifHeight)
+
+			var proof any
+			if inclusion {
+				proof, err = proveInclusion(store, cCtx.Uint64("mmrindex"), cCtx.Uint64("mmrsize"))
+			} else {
+				proof, err = proveConsistency(store, cCtx.Uint64("from-size"), cCtx.Uint64("to-size"))
+			}
+			if err != nil {
+				return err
+			}
+
+			var data []byte
+			switch cCtx.String("format") {
+			case proveFmtCBOR:
+				data, err = cbor.Marshal(proof)
+			default:
+				data, err = json.MarshalIndent(proof, "", "  ")
+				data = append(data, '\n')
+			}
+			if err != nil {
+				return err
+			}
+
+			if cCtx.String("output") == "" {
+				_, err = os.Stdout.Write(data)
+				return err
+			}
+			return os.WriteFile(cCtx.String("output"), data, os.FileMode(0644))
 		},
 	}
 }
+
+// proveInclusion produces the inclusion proof for mmrIndex in MMR(mmrSize).
+// If mmrSize is zero, the size of the massif containing mmrIndex is used.
+func proveInclusion(store *massifNodeStore, mmrIndex uint64, mmrSize uint64) (InclusionProofOutput, error) {
+
+	if mmrSize == 0 {
+		mc, err := store.Massif(uint32(massifs.MassifIndexFromMMRIndex(store.massifHeight, mmrIndex)))
+		if err != nil {
+			return InclusionProofOutput{}, err
+		}
+		mmrSize = mc.RangeCount()
+	}
+	if mmrIndex >= mmrSize {
+		return InclusionProofOutput{}, fmt.Errorf("mmrindex %d is not in MMR(%d)", mmrIndex, mmrSize)
+	}
+	if mmr.FirstMMRSize(mmrSize-1) != mmrSize {
+		return InclusionProofOutput{}, fmt.Errorf("mmrsize %d must be a complete MMR size", mmrSize)
+	}
+
+	node, err := store.Get(mmrIndex)
+	if err != nil {
+		return InclusionProofOutput{}, err
+	}
+	path, err := mmr.InclusionProof(store, mmrSize-1, mmrIndex)
+	if err != nil {
+		return InclusionProofOutput{}, err
+	}
+	pathIndices, err := mmr.InclusionProofPath(mmrSize-1, mmrIndex)
+	if err != nil {
+		return InclusionProofOutput{}, err
+	}
+	accumulator, err := mmr.PeakHashes(store, mmrSize-1)
+	if err != nil {
+		return InclusionProofOutput{}, err
+	}
+
+	return InclusionProofOutput{
+		MMRIndex:    mmrIndex,
+		MMRSize:     mmrSize,
+		Node:        node,
+		PathIndices: pathIndices,
+		Path:        proofNodes(path),
+		PeakIndex:   mmr.GetProofPeakIndex(mmrSize, len(path), uint8(mmr.IndexHeight(mmrIndex))),
+		Accumulator: proofNodes(accumulator),
+	}, nil
+}
+
+// proveConsistency produces the proof that MMR(toSize) appends to MMR(fromSize)
+func proveConsistency(store *massifNodeStore, fromSize uint64, toSize uint64) (ConsistencyProofOutput, error) {
+
+	if fromSize == 0 || fromSize > toSize {
+		return ConsistencyProofOutput{}, fmt.Errorf("from-size %d must be non zero and not greater than to-size %d", fromSize, toSize)
+	}
+	if mmr.FirstMMRSize(fromSize-1) != fromSize || mmr.FirstMMRSize(toSize-1) != toSize {
+		return ConsistencyProofOutput{}, fmt.Errorf("from-size %d and to-size %d must both be complete MMR sizes", fromSize, toSize)
+	}
+
+	cp, err := mmr.IndexConsistencyProof(store, fromSize-1, toSize-1)
+	if err != nil {
+		return ConsistencyProofOutput{}, err
+	}
+	accumulatorFrom, err := mmr.PeakHashes(store, fromSize-1)
+	if err != nil {
+		return ConsistencyProofOutput{}, err
+	}
+	accumulatorTo, err := mmr.PeakHashes(store, toSize-1)
+	if err != nil {
+		return ConsistencyProofOutput{}, err
+	}
+
+	paths := make([][]proofNode, 0, len(cp.Path))
+	for _, path := range cp.Path {
+		paths = append(paths, proofNodes(path))
+	}
+
+	return ConsistencyProofOutput{
+		FromSize:        cp.MMRSizeA,
+		ToSize:          cp.MMRSizeB,
+		FromPeakIndices: mmr.Peaks(fromSize - 1),
+		Paths:           paths,
+		AccumulatorFrom: proofNodes(accumulatorFrom),
+		AccumulatorTo:   proofNodes(accumulatorTo),
+	}, nil
+}
@@ -0,0 +1,104 @@
+package veracity
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProveInclusion(t *testing.T) {
+	// Height 2 massifs have 2 leaves and 3 nodes, 8 leaves is MMR(15)
+	store, _, _, _ := newTestLedger(t, 2, 8)
+	nodes := newMassifNodeStore(context.Background(), store, 2)
+
+	tests := []struct {
+		name     string
+		mmrIndex uint64
+		mmrSize  uint64
+		wantSize uint64
+		wantErr  bool
+	}{
+		{name: "leaf in its own massif", mmrIndex: 0, mmrSize: 0, wantSize: 3},
+		{name: "leaf in the last massif", mmrIndex: 11, mmrSize: 0, wantSize: 15},
+		{name: "first leaf, path crosses every massif", mmrIndex: 0, mmrSize: 15, wantSize: 15},
+		{name: "interior node", mmrIndex: 5, mmrSize: 10, wantSize: 10},
+		{name: "peak is its own proof", mmrIndex: 6, mmrSize: 7, wantSize: 7},
+		{name: "index outside the size", mmrIndex: 10, mmrSize: 10, wantErr: true},
+		{name: "incomplete size", mmrIndex: 0, mmrSize: 5, wantErr: true},
+		{name: "incomplete size, last massif", mmrIndex: 7, mmrSize: 13, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proof, err := proveInclusion(nodes, tt.mmrIndex, tt.mmrSize)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSize, proof.MMRSize)
+
+			path := make([][]byte, len(proof.Path))
+			for i, n := range proof.Path {
+				path[i] = n
+			}
+			root := mmr.IncludedRoot(sha256.New(), tt.mmrIndex, proof.Node, path)
+			require.Less(t, proof.PeakIndex, len(proof.Accumulator))
+			assert.Equal(t, []byte(proof.Accumulator[proof.PeakIndex]), root)
+			assert.Len(t, proof.PathIndices, len(proof.Path))
+		})
+	}
+}
+
+func TestProveConsistency(t *testing.T) {
+	store, _, _, _ := newTestLedger(t, 2, 8)
+	nodes := newMassifNodeStore(context.Background(), store, 2)
+
+	tests := []struct {
+		name     string
+		fromSize uint64
+		toSize   uint64
+		wantErr  bool
+	}{
+		{name: "same massif", fromSize: 1, toSize: 3},
+		{name: "same size", fromSize: 7, toSize: 7},
+		{name: "first massif to the head", fromSize: 3, toSize: 15},
+		{name: "across one massif", fromSize: 7, toSize: 10},
+		{name: "several peaks", fromSize: 11, toSize: 15},
+		{name: "zero from size", fromSize: 0, toSize: 15, wantErr: true},
+		{name: "from after to", fromSize: 15, toSize: 10, wantErr: true},
+		{name: "incomplete from size", fromSize: 5, toSize: 15, wantErr: true},
+		{name: "incomplete to size", fromSize: 3, toSize: 13, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proof, err := proveConsistency(nodes, tt.fromSize, tt.toSize)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, mmr.Peaks(tt.fromSize-1), proof.FromPeakIndices)
+
+			accumulatorFrom := make([][]byte, len(proof.AccumulatorFrom))
+			for i, n := range proof.AccumulatorFrom {
+				accumulatorFrom[i] = n
+			}
+			paths := make([][][]byte, len(proof.Paths))
+			for i, p := range proof.Paths {
+				for _, n := range p {
+					paths[i] = append(paths[i], n)
+				}
+			}
+			// Every peak of the older accumulator is proven to a peak of the newer one
+			proven, err := mmr.ConsistentRoots(sha256.New(), tt.fromSize-1, accumulatorFrom, paths)
+			require.NoError(t, err)
+			for _, root := range proven {
+				assert.Contains(t, proof.AccumulatorTo, proofNode(root))
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+package veracity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs"
+	"github.com/forestrie/go-merklelog/massifs/snowflakeid"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	// pruneManifestsDirName is the directory, in the root of the replica
+	// directory, which holds the prune manifest for each log.
+	pruneManifestsDirName = "prune-manifests"
+)
+
+var (
+	ErrPrunePolicyRequired = errors.New("one of --keep-massifs or --keep-since is required")
+	ErrPrunePolicyInvalid  = errors.New("invalid prune policy")
+)
+
+// PruneRecord describes a single prune of a replica
+type PruneRecord struct {
+	Pruned      string   `json:"pruned"`
+	Policy      string   `json:"policy"`
+	FirstMassif uint32   `json:"first_massif"`
+	HeadMassif  uint32   `json:"head_massif"`
+	Removed     []string `json:"removed"`
+}
+
+// PruneManifest records the massifs deliberately removed from a replica. The
+// massifs before FirstMassif are not expected to be present.
+type PruneManifest struct {
+	LogID       string        `json:"logid"`
+	FirstMassif uint32        `json:"first_massif"`
+	Prunes      []PruneRecord `json:"prunes"`
+}
+
+func pruneManifestPath(replicaDir string, logID storage.LogID) string {
+	return filepath.Join(replicaDir, pruneManifestsDirName, logIDString(logID)+".json")
+}
+
+// readPruneManifest reads the prune manifest for the log. If the replica has
+// never been pruned, the manifest is empty.
+func readPruneManifest(replicaDir string, logID storage.LogID) (PruneManifest, error) {
+	manifest := PruneManifest{LogID: logIDString(logID)}
+	data, err := os.ReadFile(pruneManifestPath(replicaDir, logID))
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, err
+	}
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("failed to decode the prune manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+func writePruneManifest(replicaDir string, logID storage.LogID, manifest PruneManifest) error {
+	fileName := pruneManifestPath(replicaDir, logID)
+	if err := os.MkdirAll(filepath.Dir(fileName), os.FileMode(0755)); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpFileName := fileName + ".tmp"
+	if err = os.WriteFile(tmpFileName, append(data, '\n'), os.FileMode(0644)); err != nil {
+		return err
+	}
+	return os.Rename(tmpFileName, fileName)
+}
+
+// NewPruneCmd removes the oldest massifs from a local replica
+func NewPruneCmd() *cli.Command {
+	return &cli.Command{
+		Name: "prune",
+		Usage: `remove the oldest massifs, and their checkpoints, from a local replica.
+
+The latest checkpoint, and the massif it seals, are always kept. The massifs kept are always a contiguous range ending with the most recent.
+Each massif carries the ancestor peaks it depends on in its peak stack, so receipts can be produced for any entry in a kept massif.
+A prune manifest is written, so that audit-replica knows the removed massifs were removed deliberately.`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "replicadir",
+				Usage:   `the root directory for all tenant log replicas, as used with replicate-logs`,
+				Aliases: []string{"d"},
+				Value:   ".",
+			},
+			&cli.IntFlag{
+				Name:  "keep-massifs",
+				Usage: "the number of most recent massifs to keep",
+			},
+			&cli.StringFlag{
+				Name:  "keep-since",
+				Usage: "keep the massifs with entries more recent than this time. either RFC 3339, or a duration before now, such as 720h",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "list the files which would be removed, without removing them",
+			},
+		},
+		Action: func(cCtx *cli.Context) error {
+			var err error
+			cmd := &CmdCtx{}
+			ctx := cCtx.Context
+
+			if err = cfgLogging(cmd, cCtx); err != nil {
+				return err
+			}
+			if err = cfgMassifFmt(cmd, cCtx); err != nil {
+				return err
+			}
+
+			logID := CtxGetOneLogOption(cCtx)
+			if logID == nil {
+				return fmt.Errorf("a tenant or logid is required for this command")
+			}
+
+			replicaDir := cCtx.String("replicadir")
+			reader, err := NewCmdStorageProviderFS(ctx, cCtx, cmd, replicaDir, false)
+			if err != nil {
+				return err
+			}
+			if err = reader.SelectLog(ctx, logID); err != nil {
+				return fmt.Errorf("failed to select local log %s: %w", logID, err)
+			}
+
+			manifest, err := readPruneManifest(replicaDir, logID)
+			if err != nil {
+				return err
+			}
+
+			policy, firstMassif, headMassif, err := pruneFirstMassif(ctx, cCtx, reader, manifest.FirstMassif)
+			if err != nil {
+				return err
+			}
+			if firstMassif <= manifest.FirstMassif {
+				fmt.Printf("nothing to prune, massifs %d to %d are kept\n", manifest.FirstMassif, headMassif)
+				return nil
+			}
+
+			files, err := findReplicaFiles(replicaDir, logID, massifExtension(cCtx), firstMassif)
+			if err != nil {
+				return err
+			}
+			for _, fileName := range files {
+				fmt.Printf("remove %s\n", fileName)
+			}
+			if cCtx.Bool("dry-run") {
+				fmt.Printf("%d files would be removed, massifs %d to %d would be kept\n", len(files), firstMassif, headMassif)
+				return nil
+			}
+
+			// The manifest is written first, so an interrupted prune is
+			// still recorded as deliberate.
+			record := PruneRecord{
+				Pruned:      time.Now().UTC().Format(time.RFC3339),
+				Policy:      policy,
+				FirstMassif: firstMassif,
+				HeadMassif:  headMassif,
+			}
+			for _, fileName := range files {
+				rel, err := filepath.Rel(replicaDir, fileName)
+				if err != nil {
+					rel = fileName
+				}
+				record.Removed = append(record.Removed, filepath.ToSlash(rel))
+			}
+			manifest.FirstMassif = firstMassif
+			manifest.Prunes = append(manifest.Prunes, record)
+			if err = writePruneManifest(replicaDir, logID, manifest); err != nil {
+				return err
+			}
+
+			for _, fileName := range files {
+				if err = os.Remove(fileName); err != nil && !errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+			}
+			fmt.Printf("%d files removed, massifs %d to %d kept\n", len(files), firstMassif, headMassif)
+			return nil
+		},
+	}
+}
+
+// pruneFirstMassif applies the prune policy and returns a description of the
+// policy, the first massif to keep and the most recent massif. The first
+// massif to keep is never after the massif sealed by the latest checkpoint.
+func pruneFirstMassif(
+	ctx context.Context, cCtx *cli.Context, reader massifs.ObjectReader, firstPresent uint32,
+) (string, uint32, uint32, error) {
+
+	if cCtx.IsSet("keep-massifs") == cCtx.IsSet("keep-since") {
+		return "", 0, 0, ErrPrunePolicyRequired
+	}
+
+	headMassif, err := reader.HeadIndex(ctx, storage.ObjectMassifData)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("failed to get head massif index: %w", err)
+	}
+	checkpointMassif, err := reader.HeadIndex(ctx, storage.ObjectCheckpoint)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("failed to get the latest checkpoint: %w", err)
+	}
+
+	var policy string
+	var firstMassif uint32
+
+	if cCtx.IsSet("keep-massifs") {
+		keep := cCtx.Int("keep-massifs")
+		if keep < 1 {
+			return "", 0, 0, fmt.Errorf("%w: at least one massif must be kept", ErrPrunePolicyInvalid)
+		}
+		policy = fmt.Sprintf("keep-massifs=%d", keep)
+		if uint64(keep) <= uint64(headMassif) {
+			firstMassif = headMassif + 1 - uint32(keep)
+		}
+	} else {
+		since, err := parseKeepSince(cCtx.String("keep-since"), time.Now())
+		if err != nil {
+			return "", 0, 0, err
+		}
+		policy = fmt.Sprintf("keep-since=%s", since.UTC().Format(time.RFC3339))
+
+		// Massifs are in time order, so the massifs to keep are found by
+		// working back from the head until one is found which is entirely
+		// older than since.
+		firstMassif = headMassif
+		for firstMassif > firstPresent {
+			mc, err := massifs.GetMassifContext(ctx, reader, firstMassif-1)
+			if err != nil {
+				return "", 0, 0, err
+			}
+			ms, err := snowflakeid.IDUnixMilli(mc.GetLastIDTimestamp(), uint8(mc.Start.CommitmentEpoch))
+			if err != nil {
+				return "", 0, 0, err
+			}
+			if time.UnixMilli(ms).Before(since) {
+				break
+			}
+			firstMassif--
+		}
+	}
+	return policy, min(firstMassif, checkpointMassif), headMassif, nil
+}
+
+// parseKeepSince accepts either an RFC 3339 time or a duration before now
+func parseKeepSince(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: keep-since %s is neither a time nor a duration", ErrPrunePolicyInvalid, value)
+	}
+	return t, nil
+}
+
+// findReplicaFiles returns the massif and checkpoint files for the log with
+// a massif index before firstMassif. The retained checkpoint history is
+// never included.
+func findReplicaFiles(replicaDir string, logID storage.LogID, massifExt string, firstMassif uint32) ([]string, error) {
+	logDir := string(filepath.Separator) + logIDString(logID) + string(filepath.Separator)
+	checkpointExt := storage.V1MMRExtSep + storage.V1MMRSealSignedRootExt
+
+	var files []string
+	err := filepath.WalkDir(replicaDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != replicaDir && (d.Name() == checkpointHistoryDirName || d.Name() == pruneManifestsDirName) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.Contains(path, logDir) {
+			return nil
+		}
+		name := d.Name()
+		var base string
+		switch {
+		case strings.HasSuffix(name, massifExt):
+			base = strings.TrimSuffix(name, massifExt)
+		case strings.HasSuffix(name, checkpointExt):
+			base = strings.TrimSuffix(name, checkpointExt)
+		default:
+			return nil
+		}
+		massifIndex, err := strconv.ParseUint(base, 10, 32)
+		if err != nil {
+			return nil
+		}
+		if uint32(massifIndex) < firstMassif {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
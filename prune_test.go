@@ -0,0 +1,57 @@
+package veracity
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeepSince(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	got, err := parseKeepSince("48h", now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-48*time.Hour), got)
+
+	got, err = parseKeepSince("2025-01-01T00:00:00Z", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), got)
+
+	_, err = parseKeepSince("last week", now)
+	assert.ErrorIs(t, err, ErrPrunePolicyInvalid)
+}
+
+func TestFindReplicaFiles(t *testing.T) {
+	replicaDir := t.TempDir()
+	logID := []byte("0123456789abcdef")
+	otherID := []byte("fedcba9876543210")
+
+	logDir := filepath.Join(replicaDir, "v1", "mmrs", "tenant", logIDString(logID), "0")
+	otherDir := filepath.Join(replicaDir, "v1", "mmrs", "tenant", logIDString(otherID), "0")
+	historyDir := filepath.Join(replicaDir, checkpointHistoryDirName, logIDString(logID))
+
+	for _, fileName := range []string{
+		filepath.Join(logDir, "massifs", "0000000000000000.log"),
+		filepath.Join(logDir, "massifs", "0000000000000001.log"),
+		filepath.Join(logDir, "massifs", "0000000000000002.log"),
+		filepath.Join(logDir, "massifseals", "0000000000000000.sth"),
+		filepath.Join(logDir, "massifseals", "0000000000000002.sth"),
+		filepath.Join(otherDir, "massifs", "0000000000000000.log"),
+		filepath.Join(historyDir, "0000000000000001-00000000-0000000000000007.cbor"),
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(fileName), 0755))
+		require.NoError(t, os.WriteFile(fileName, []byte{0}, 0644))
+	}
+
+	files, err := findReplicaFiles(replicaDir, logID, ".log", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(logDir, "massifs", "0000000000000000.log"),
+		filepath.Join(logDir, "massifs", "0000000000000001.log"),
+		filepath.Join(logDir, "massifseals", "0000000000000000.sth"),
+	}, files)
+}
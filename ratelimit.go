@@ -0,0 +1,91 @@
+package veracity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+)
+
+// maxRequestRate is the highest request rate a requestLimiter can pace, one
+// request each nanosecond
+const maxRequestRate = float64(time.Second)
+
+var ErrRateLimitRange = errors.New("the rate limit is out of range")
+
+// checkRequestRate returns an error if perSecond can't be paced by a
+// requestLimiter
+func checkRequestRate(perSecond float64) error {
+	if perSecond < 0 || perSecond > maxRequestRate {
+		return fmt.Errorf("%w: %v requests per second, the limit must be between 0 and %v", ErrRateLimitRange, perSecond, maxRequestRate)
+	}
+	return nil
+}
+
+// requestLimiter paces requests to a steady global rate. It is shared by all
+// replication workers, so the total request rate is limited regardless of the
+// concurrency. A nil limiter does not limit.
+type requestLimiter struct {
+	ticker *time.Ticker
+}
+
+// newRequestLimiter returns a limiter allowing perSecond requests each
+// second, or nil if perSecond is not positive.
+func newRequestLimiter(perSecond float64) *requestLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &requestLimiter{ticker: time.NewTicker(max(time.Duration(float64(time.Second)/perSecond), 1))}
+}
+
+// Wait blocks until the next request is permitted, or the context is done
+func (l *requestLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-l.ticker.C:
+		return nil
+	}
+}
+
+func (l *requestLimiter) Stop() {
+	if l == nil {
+		return
+	}
+	l.ticker.Stop()
+}
+
+// rateLimitedReader applies a requestLimiter to the requests made by an
+// ObjectReader. Only the methods which read from storage wait, the
+// MassifData and CheckpointData methods return previously read data.
+type rateLimitedReader struct {
+	massifs.ObjectReader
+	limiter *requestLimiter
+}
+
+func (r *rateLimitedReader) HeadIndex(ctx context.Context, otype storage.ObjectType) (uint32, error) {
+	if err := r.limiter.Wait(ctx); err != nil {
+		return 0, err
+	}
+	return r.ObjectReader.HeadIndex(ctx, otype)
+}
+
+func (r *rateLimitedReader) MassifReadN(ctx context.Context, massifIndex uint32, n int) ([]byte, error) {
+	if err := r.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return r.ObjectReader.MassifReadN(ctx, massifIndex, n)
+}
+
+func (r *rateLimitedReader) CheckpointRead(ctx context.Context, massifIndex uint32) ([]byte, error) {
+	if err := r.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return r.ObjectReader.CheckpointRead(ctx, massifIndex)
+}
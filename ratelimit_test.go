@@ -0,0 +1,52 @@
+package veracity
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestLimiter(t *testing.T) {
+	// A nil limiter does not limit
+	limiter := newRequestLimiter(0)
+	require.Nil(t, limiter)
+	assert.NoError(t, limiter.Wait(context.Background()))
+	limiter.Stop()
+
+	// Requests are paced to the rate
+	limiter = newRequestLimiter(100)
+	start := time.Now()
+	for range 3 {
+		require.NoError(t, limiter.Wait(context.Background()))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	// A waiting request returns when the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	slow := newRequestLimiter(0.001)
+	assert.ErrorIs(t, slow.Wait(ctx), context.Canceled)
+	slow.Stop()
+	limiter.Stop()
+
+	// Rates too high to pace are limited to one request each nanosecond
+	limiter = newRequestLimiter(2 * maxRequestRate)
+	require.NotNil(t, limiter)
+	assert.NoError(t, limiter.Wait(context.Background()))
+	limiter.Stop()
+}
+
+func TestCheckRequestRate(t *testing.T) {
+	assert.NoError(t, checkRequestRate(0))
+	assert.NoError(t, checkRequestRate(10))
+	assert.NoError(t, checkRequestRate(maxRequestRate))
+	assert.ErrorIs(t, checkRequestRate(-1), ErrRateLimitRange)
+	assert.ErrorIs(t, checkRequestRate(2e9), ErrRateLimitRange)
+
+	app := AddCommands(NewApp("version", true), true)
+	err := app.Run([]string{"veracity", "replicate-logs", "--rate-limit", "2e9"})
+	assert.ErrorIs(t, err, ErrRateLimitRange)
+}
@@ -1,7 +1,6 @@
 package veracity
 
 import (
-	"context"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
@@ -17,7 +16,7 @@ func NewReceiptCmd() *cli.Command {
 	return &cli.Command{
 		Name:  "receipt",
 		Usage: "Generate a COSE Receipt of inclusion for any merklelog entry",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:    "output",
 				Aliases: []string{"o"},
@@ -37,7 +36,7 @@ func NewReceiptCmd() *cli.Command {
 					return nil
 				},
 			},
-		},
+		}, checkpointKeyFlags()...),
 		Action: func(cCtx *cli.Context) error {
 			cmd := &CmdCtx{}
 
@@ -56,6 +55,9 @@ func NewReceiptCmd() *cli.Command {
 			if err = cfgMassifFmt(cmd, cCtx); err != nil {
 				return err
 			}
+			if err = CfgKeys(cmd, cCtx); err != nil {
+				return err
+			}
 
 			reader, err := newMassifReader(cmd, cCtx)
 			if err != nil {
@@ -69,11 +71,11 @@ func NewReceiptCmd() *cli.Command {
 
 			var verifier cose.Verifier
 
-			if cmd.CheckpointPublic.Public == nil {
+			if len(cmd.CheckpointKeys.Keys) == 0 {
 				return errors.New("checkpoint public key is required")
 			}
 
-			verifier, err = cose.NewVerifier(cmd.CheckpointPublic.Alg, cmd.CheckpointPublic.Public)
+			verifier, err = checkpointVerifier(cmd)
 			if err != nil {
 				return err
 			}
@@ -87,8 +89,15 @@ func NewReceiptCmd() *cli.Command {
 			mmrIndex := cCtx.Uint64("mmrindex")
 			massifHeight := uint8(cCtx.Int64("height"))
 
+			// The checkpoint may be signed by any key of the set
+			massifIndex := uint32(massifs.MassifIndexFromMMRIndex(massifHeight, mmrIndex))
+			verifier, _, err = checkpointVerifierFor(cCtx.Context, reader, &codec, verifier, massifIndex)
+			if err != nil {
+				return err
+			}
+
 			signedReceipt, err := massifs.NewReceipt(
-				context.Background(), reader,
+				cCtx.Context, reader,
 				&codec, verifier,
 				massifHeight, mmrIndex,
 			)
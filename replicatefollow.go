@@ -0,0 +1,234 @@
+package veracity
+
+// Continuous replication, replicate-logs --follow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	azwatcher "github.com/forestrie/go-merklelog-azure/watcher"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/massifs/watcher"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	// followCursorFileName is the file, in the root of the replica directory,
+	// that records the idtimestamp of the most recent change replicated by
+	// --follow. It is named so that it can not be mistaken for log data.
+	followCursorFileName = ".replicate-logs-cursor"
+)
+
+// watchLogActivity polls for log changes once, using the --latest watch
+// configuration, and returns the activity for each changed log. If idSince is
+// not empty, only changes at or after that idtimestamp are considered.
+func watchLogActivity(
+	ctx context.Context, cCtx *cli.Context, cmd *CmdCtx, idSince string,
+) ([]watcher.LogActivity, error) {
+
+	cfg, err := newWatchConfig(cCtx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	if idSince != "" {
+		cfg.IDSince = idSince
+	}
+
+	if cmd.RemoteURL == "" {
+		return nil, fmt.Errorf("%w: remote-url is required", ErrRequiredOption)
+	}
+
+	if cmd.RemoteProvider == remoteProviderHTTP {
+		return httpLogActivity(ctx, cmd, cfg)
+	}
+
+	reader, err := cfgReader(cmd, cCtx, cmd.RemoteURL)
+	if err != nil {
+		return nil, err
+	}
+	collator := azwatcher.NewLogTailCollator(
+		func(storagePath string) storage.LogID {
+			return storage.ParsePrefixedLogID("tenant/", storagePath)
+		},
+		storage.ObjectIndexFromPath,
+	)
+	watcher, err := azwatcher.NewWatcher(cfg.WatchConfig)
+	if err != nil {
+		return nil, err
+	}
+	wc := &WatcherCollator{
+		Watcher:         watcher,
+		LogTailCollator: collator,
+	}
+
+	collector := &changeCollector{log: cmd.Log}
+	err = azwatcher.WatchForChanges(ctx, cfg.WatchConfig, wc, reader, collector)
+	if err != nil {
+		return nil, err
+	}
+
+	return logActivityFromData([]byte(collector.watchOutput))
+}
+
+// httpLogActivity reads the log activity from the listing of a serve-replica
+// instance. The listing has the latest activity of every log, those which
+// are not watched are left out. Activity already seen is left out by
+// newActivity, which compares it with the cursor.
+func httpLogActivity(ctx context.Context, cmd *CmdCtx, cfg WatchConfig) ([]watcher.LogActivity, error) {
+	all, err := NewHTTPStore(nil, cmd.RemoteURL).LogActivity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.WatchLogs) == 0 {
+		return all, nil
+	}
+	var activity []watcher.LogActivity
+	for _, a := range all {
+		if cfg.WatchLogs[string(a.LogID)] {
+			activity = append(activity, a)
+		}
+	}
+	return activity, nil
+}
+
+func logActivityFromData(data []byte) ([]watcher.LogActivity, error) {
+	var activity []watcher.LogActivity
+	if len(bytes.TrimSpace(data)) == 0 {
+		return activity, nil
+	}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&activity); err != nil {
+		return nil, err
+	}
+	return activity, nil
+}
+
+// followStopped returns the error --follow exits with once the context is
+// done. A signal is the normal way to stop following, but an expired
+// --timeout is an error, so that a timed out daemon does not exit successfully.
+func followStopped(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// readFollowCursor returns the idtimestamp persisted by a previous --follow, or "" if there is none
+func readFollowCursor(replicaDir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(replicaDir, followCursorFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// writeFollowCursor persists the idtimestamp cursor. The cursor is written to
+// a temporary file and renamed into place so that an interrupted write can
+// not leave a truncated cursor.
+func writeFollowCursor(replicaDir string, idSince string) error {
+	if err := os.MkdirAll(replicaDir, os.FileMode(0755)); err != nil {
+		return fmt.Errorf("%w: %v", ErrFailedToCreateReplicaDir, err)
+	}
+	fileName := filepath.Join(replicaDir, followCursorFileName)
+	tmpFileName := fileName + ".tmp"
+	if err := os.WriteFile(tmpFileName, []byte(idSince+"\n"), os.FileMode(0644)); err != nil {
+		return err
+	}
+	return os.Rename(tmpFileName, fileName)
+}
+
+// newActivity returns the activity more recent than the cursor, and the
+// cursor advanced to the most recent change. idtimestamps are fixed width hex
+// strings, so they order lexically.
+func newActivity(activity []watcher.LogActivity, cursor string) ([]watcher.LogMassif, string) {
+	var changes []watcher.LogMassif
+	next := cursor
+	for _, a := range activity {
+		if cursor != "" && len(a.IDCommitted) == len(cursor) && a.IDCommitted <= cursor {
+			continue
+		}
+		changes = append(changes, watcher.LogMassif{LogID: a.LogID, Massif: a.Massif})
+		if next == "" || len(a.IDCommitted) != len(next) || a.IDCommitted > next {
+			next = a.IDCommitted
+		}
+	}
+	return changes, next
+}
+
+// followChanges watches for log changes and replicates each batch as it
+// arrives, until the command context is cancelled by SIGINT, SIGTERM or
+// --timeout. The cursor is only advanced once a batch completes, so a batch
+// which is interrupted is replicated again on restart.
+func followChanges(cCtx *cli.Context, cmd *CmdCtx) error {
+
+	ctx := cCtx.Context
+
+	replicaDir := cCtx.String("replicadir")
+	interval := cCtx.Duration("follow-interval")
+	if interval < time.Second {
+		return fmt.Errorf("polling more than once per second is not currently supported")
+	}
+
+	cursor, err := readFollowCursor(replicaDir)
+	if err != nil {
+		return err
+	}
+	if cursor != "" {
+		cmd.Log.Infof("resuming from idtimestamp %s", cursor)
+	}
+
+	for {
+		activity, err := watchLogActivity(ctx, cCtx, cmd, cursor)
+		if ctx.Err() != nil {
+			return followStopped(ctx)
+		}
+		if err != nil && !errors.Is(err, ErrNoChanges) {
+			return err
+		}
+
+		changes, next := newActivity(activity, cursor)
+		if len(changes) > 0 {
+			cmd.Log.Infof("replicating %d changed logs", len(changes))
+			progress := newProgressor(cCtx, "tenants", len(changes))
+			report, err := replicateAll(cCtx, cmd, changes, progress)
+			if rerr := reportReplication(cCtx, report); rerr != nil {
+				return rerr
+			}
+			if ctx.Err() != nil {
+				cmd.Log.Infof("stopping, resume from idtimestamp %s", cursor)
+				return followStopped(ctx)
+			}
+
+			// With --keep-going a failed batch does not stop following, but
+			// the cursor is not advanced, so the whole batch is retried on
+			// the next poll.
+			switch {
+			case err != nil && !cCtx.Bool("keep-going"):
+				return err
+			case err != nil:
+				cmd.Log.Infof("%v, retrying from idtimestamp %s", err, cursor)
+			default:
+				if err = writeFollowCursor(replicaDir, next); err != nil {
+					return err
+				}
+				cursor = next
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			cmd.Log.Infof("stopping, resume from idtimestamp %s", cursor)
+			return followStopped(ctx)
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package veracity
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/watcher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewActivity(t *testing.T) {
+	activity := []watcher.LogActivity{
+		{LogID: []byte("log-a"), Massif: 1, IDCommitted: "01918fd01c3a8d0100"},
+		{LogID: []byte("log-b"), Massif: 3, IDCommitted: "01918fd2a85bdf0300"},
+		{LogID: []byte("log-c"), Massif: 0, IDCommitted: "01918fd0e2dd9a0000"},
+	}
+
+	tests := []struct {
+		name       string
+		cursor     string
+		wantLogs   []string
+		wantCursor string
+	}{
+		{
+			name:       "no cursor takes everything",
+			cursor:     "",
+			wantLogs:   []string{"log-a", "log-b", "log-c"},
+			wantCursor: "01918fd2a85bdf0300",
+		},
+		{
+			name:       "changes at or before the cursor are skipped",
+			cursor:     "01918fd0e2dd9a0000",
+			wantLogs:   []string{"log-b"},
+			wantCursor: "01918fd2a85bdf0300",
+		},
+		{
+			name:       "nothing new leaves the cursor alone",
+			cursor:     "01918fd2a85bdf0300",
+			wantLogs:   nil,
+			wantCursor: "01918fd2a85bdf0300",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, cursor := newActivity(activity, tt.cursor)
+			var logs []string
+			for _, c := range changes {
+				logs = append(logs, string(c.LogID))
+			}
+			assert.Equal(t, tt.wantLogs, logs)
+			assert.Equal(t, tt.wantCursor, cursor)
+		})
+	}
+}
+
+func TestFollowCursorRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	cursor, err := readFollowCursor(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "", cursor)
+
+	require.NoError(t, writeFollowCursor(dir, "01918fd2a85bdf0300"))
+	cursor, err = readFollowCursor(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "01918fd2a85bdf0300", cursor)
+}
+
+func TestFollowStopped(t *testing.T) {
+	// A signal cancels the context, which stops following without error
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NoError(t, followStopped(ctx))
+
+	// An expired --timeout is an error
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	assert.ErrorIs(t, followStopped(ctx), context.DeadlineExceeded)
+}
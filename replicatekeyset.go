@@ -0,0 +1,169 @@
+package veracity
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/massifs"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+)
+
+// replicateKeySet is massifs.VerifyingReplicator.ReplicateVerifiedUpdates for
+// a checkpoint key set. The massifs replicator verifies every checkpoint with
+// its one COSEVerifier, and go-cose requires the alg of that verifier to be
+// the alg of each checkpoint, which the keys of a set need not share. Here
+// each checkpoint is verified by the key which signed it, selected from the
+// checkpoint itself by getContextVerified.
+//
+// Otherwise the replication is the same. The sink head is verified, each
+// source massif is verified to be consistent with the last verified sink
+// massif, and the sink is only replaced by a verified extension of it.
+func replicateKeySet(
+	ctx context.Context, r *massifs.VerifyingReplicator, keys *keySetVerifier, startMassif, endMassif uint32,
+) error {
+	sinkHeadIndex, err := r.Sink.HeadIndex(ctx, storage.ObjectCheckpoint)
+	if !replicaNotFound(err) {
+		return err
+	}
+	var sink *massifs.VerifiedContext
+	if err == nil {
+		sink, err = getContextVerified(ctx, r.Sink, &r.CBORCodec, keys, sinkHeadIndex)
+		if !replicaNotFound(err) {
+			return err
+		}
+	}
+
+	// Massifs already verified and replicated in the sink are not verified
+	// again, unless the start is more than one massif ahead of the sink.
+	if sink != nil {
+		if startMassif > sink.Start.MassifIndex+1 {
+			sink = nil
+		} else {
+			startMassif = sink.Start.MassifIndex
+		}
+	}
+
+	for i := startMassif; i <= endMassif; i++ {
+		var opts []massifs.Option
+		if sink != nil {
+			baseState, err := replicaTrustedState(sink)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, massifs.WithVerifyTrustedState(baseState))
+		}
+
+		// getContextVerified reads the checkpoint before the massif, so a
+		// massif extended after its checkpoint was read still verifies.
+		source, err := getContextVerified(ctx, r.Source, &r.CBORCodec, keys, i, opts...)
+		if err != nil {
+			return err
+		}
+		sink, err = getContextVerified(ctx, r.Sink, &r.CBORCodec, keys, i)
+		if !replicaNotFound(err) {
+			return err
+		}
+		if sink, err = replaceReplica(ctx, r.Sink, sink, source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replicaNotFound reports whether err is nil, or only reports that the
+// replica does not have the object yet
+func replicaNotFound(err error) bool {
+	return err == nil ||
+		errors.Is(err, storage.ErrDoesNotExist) ||
+		errors.Is(err, storage.ErrLogEmpty) ||
+		errors.Is(err, storage.ErrNotAvailable)
+}
+
+// replicaTrustedState returns the state of the sink massif, promoting a
+// version 0 state to a version 1 state with peaks, so that the source can be
+// checked for consistency with it.
+func replicaTrustedState(sink *massifs.VerifiedContext) (massifs.MMRState, error) {
+	if sink.MMRState.Version > int(massifs.MMRStateVersion0) {
+		return sink.MMRState, nil
+	}
+	peaks, err := mmr.PeakHashes(sink, sink.MMRState.MMRSize-1)
+	if err != nil {
+		return massifs.MMRState{}, err
+	}
+	if !bytes.Equal(mmr.HashPeaksRHS(sha256.New(), peaks), sink.MMRState.LegacySealRoot) {
+		return massifs.MMRState{}, fmt.Errorf("legacy seal root does not match the bagged peaks")
+	}
+	state := sink.MMRState
+	state.Version = int(massifs.MMRStateVersion1)
+	state.Peaks = peaks
+	return state, nil
+}
+
+// replaceReplica writes the verified source massif to the sink, unless the
+// sink already has it. A sink which is longer than the source, or has the
+// same data but a different verified state, is refused.
+func replaceReplica(
+	ctx context.Context, writer massifs.ObjectWriter, sink *massifs.VerifiedContext, source *massifs.VerifiedContext,
+) (*massifs.VerifiedContext, error) {
+	if sink == nil {
+		return nil, massifs.ReplaceVerifiedContext(ctx, writer, source)
+	}
+	massifIndex := sink.Start.MassifIndex
+	if massifIndex != source.Start.MassifIndex {
+		return nil, fmt.Errorf(
+			"can't replace, massif indices don't match: sink %d vs source %d", massifIndex, source.Start.MassifIndex)
+	}
+	if len(sink.Data) > len(source.Data) {
+		return nil, fmt.Errorf("%w: massif=%d", massifs.ErrSourceLogTruncated, massifIndex)
+	}
+	if len(sink.Data) == len(source.Data) {
+		if !replicaStateEqual(sink, source) {
+			return nil, fmt.Errorf("%w: massif=%d", massifs.ErrSourceLogInconsistentRootState, massifIndex)
+		}
+		return sink, nil
+	}
+	if err := massifs.ReplaceVerifiedContext(ctx, writer, source); err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+// replicaStateEqual reports whether the verified states of two copies of a
+// massif agree. A version 0 state is compared by its bagged root.
+func replicaStateEqual(a *massifs.VerifiedContext, b *massifs.VerifiedContext) bool {
+	rootsOf := func(vc *massifs.VerifiedContext) ([]byte, [][]byte, error) {
+		if vc.MMRState.Version > int(massifs.MMRStateVersion0) {
+			return mmr.HashPeaksRHS(sha256.New(), vc.MMRState.Peaks), vc.ConsistentRoots, nil
+		}
+		peaks, err := mmr.PeakHashes(vc, vc.MMRState.MMRSize-1)
+		return vc.MMRState.LegacySealRoot, peaks, err
+	}
+	if len(a.Data) != len(b.Data) {
+		return false
+	}
+	rootA, fromRoots, err := rootsOf(a)
+	if err != nil {
+		return false
+	}
+	rootB, toRoots, err := rootsOf(b)
+	if err != nil {
+		return false
+	}
+	legacy := a.MMRState.Version == int(massifs.MMRStateVersion0) || b.MMRState.Version == int(massifs.MMRStateVersion0)
+	if legacy && !bytes.Equal(rootA, rootB) {
+		return false
+	}
+	if len(fromRoots) != len(toRoots) {
+		return false
+	}
+	for i := range fromRoots {
+		if !bytes.Equal(fromRoots[i], toRoots[i]) {
+			return false
+		}
+	}
+	return true
+}
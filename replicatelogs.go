@@ -1,12 +1,12 @@
 package veracity
 
 import (
-	"bufio"
 	"context"
 	"errors"
 	"fmt"
-	"strings"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/datatrails/go-datatrails-common/logger"
@@ -14,7 +14,6 @@ import (
 	"github.com/forestrie/go-merklelog/massifs/storage"
 	"github.com/forestrie/go-merklelog/massifs/watcher"
 	"github.com/gosuri/uiprogress"
-	azblobs "github.com/forestrie/go-merklelog-azure/blobs"
 	azwatcher "github.com/forestrie/go-merklelog-azure/watcher"
 	"github.com/urfave/cli/v2"
 	"github.com/veraison/go-cose"
@@ -32,6 +31,8 @@ const (
 
 	// jitterRangeMS is the range from 0 to jitter in milliseconds
 	jitterRangeMS = 100
+	// jitterDivisor sets the additional jitter as a fraction of the backoff delay
+	jitterDivisor = 4
 
 	// massifHeightMax is the maximum massif height
 	massifHeightMax = 255
@@ -58,7 +59,7 @@ func NewReplicateLogsCmd() *cli.Command {
 		Name:    "replicate-logs",
 		Aliases: []string{"replicate"},
 		Usage:   `verifies the remote log and replicates it locally, ensuring the remote changes are consistent with the trusted local replica.`,
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.BoolFlag{Name: skipUncommittedFlagName, Value: false},
 			&cli.IntFlag{
 				Name: "massif", Aliases: []string{"m"},
@@ -66,7 +67,7 @@ func NewReplicateLogsCmd() *cli.Command {
 			&cli.UintFlag{
 				Usage: `The number of massif 'ancestors' to retain in the local replica.
 This many massifs, prior to the requested, will be verified and retained localy.
-If more exist locally, they are not removed (or reverified). If set to 0, a full replica is requested.`,
+If more exist locally, they are not removed (or reverified), use prune to remove them. If set to 0, a full replica is requested.`,
 				Value: 0,
 				Name:  "ancestors", Aliases: []string{"a"},
 			},
@@ -78,16 +79,6 @@ in the publicly accessible remote storage`,
 				Aliases: []string{"d"},
 				Value:   ".",
 			},
-			&cli.StringFlag{
-				Name:    "checkpoint-public",
-				Usage:   `A COSE Key format file, containing the key to use to verify checkpoint signatures, ES2 only.`,
-				Aliases: []string{"pub"},
-			},
-			&cli.StringFlag{
-				Name:    "checkpoint-jwks",
-				Usage:   `A JWKS format file, whose *last* entry is the key to use to verify checkpoint signatures. ES only`,
-				Aliases: []string{"jwks"},
-			},
 
 			&cli.StringFlag{
 				Name: "changes",
@@ -103,6 +94,18 @@ changes are read from standard input.`,
 				Value:   false,
 				Aliases: []string{"p"},
 			},
+			&cli.BoolFlag{
+				Name: "follow",
+				Usage: `keep watching for changes and replicate each batch as it arrives, until interrupted.
+The idtimestamp of the most recent change replicated is saved in the replicadir, and a restart resumes from it.
+When there is no saved idtimestamp, the first batch is the latest changes, as for --latest.`,
+				Value: false,
+			},
+			&cli.DurationFlag{
+				Name:  "follow-interval",
+				Usage: "how often to poll for changes when using --follow",
+				Value: threeSeconds,
+			},
 			&cli.BoolFlag{
 				Name:  "latest",
 				Usage: `find the latest changes automaticaly. When --latest is set, a list of tenants can be provided to --tenant to limit the tenant logs to be replicated.`,
@@ -114,7 +117,9 @@ changes are read from standard input.`,
 				Value:   -1, // -1 means no limit
 				Usage: `
 Set a maximum number of retries for transient error conditions. Set 0 to disable retries.
-By default transient errors are re-tried without limit, and if the error is 429, the Retry-After header is honored.`,
+By default transient errors are re-tried without limit, and if the error is 429, the Retry-After header is honored.
+Network errors, timeouts, server errors (500, 502, 503, 504) and partially read blobs are transient.
+Retries back off exponentially, with jitter.`,
 			},
 			&cli.IntFlag{
 				Name:    "concurrency",
@@ -123,7 +128,32 @@ By default transient errors are re-tried without limit, and if the error is 429,
 				Usage: fmt.Sprintf(
 					`The number of concurrent replication operations to run, defaults to %d. A high number is a sure way to get rate limited`, defaultConcurrency),
 			},
-		},
+			&cli.BoolFlag{
+				Name: "keep-going",
+				Usage: `continue replicating the remaining tenants when one fails, rather than stopping at the first failure.
+A summary of the outcome for each log is printed, and the exit status is non zero if any failed.`,
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:  "report",
+				Usage: "write a json summary of the outcome for each log to this file",
+			},
+			&cli.Float64Flag{
+				Name: "rate-limit",
+				Usage: `The maximum number of remote storage requests per second, shared by all concurrent replications.
+By default requests are not limited, and the concurrency alone determines the request rate.`,
+				Action: func(ctx *cli.Context, v float64) error {
+					return checkRequestRate(v)
+				},
+			},
+			&cli.BoolFlag{
+				Name: "checkpoint-history",
+				Usage: `retain every verified checkpoint in the checkpoint-history directory of the replica.
+Retained checkpoints are never replaced or pruned, use the checkpoints command to list them and check they are consistent with each other.
+Use --checkpoint-history=false to disable retention.`,
+				Value: true,
+			},
+		}, checkpointKeyFlags()...),
 		Action: func(cCtx *cli.Context) error {
 			cmd := &CmdCtx{}
 
@@ -146,9 +176,22 @@ By default transient errors are re-tried without limit, and if the error is 429,
 			}
 			cmd.RemoteURL = dataUrl
 
-			// There isn't really a better context. We could implement user
-			// defined timeouts for "lights out/ci" use cases in future. Humans can ctrl-c
-			changes, err := readTenantMassifChanges(context.Background(), cCtx, cmd)
+			cmd.RemoteProvider, err = remoteProvider(cCtx.Context, cCtx, cmd, dataUrl)
+			if err != nil {
+				return err
+			}
+
+			if cCtx.Bool("follow") {
+				if cCtx.IsSet("changes") || cCtx.IsSet("massif") {
+					return fmt.Errorf("--follow can not be used with --changes or --massif")
+				}
+				if cCtx.Bool("progress") {
+					uiprogress.Start()
+				}
+				return followChanges(cCtx, cmd)
+			}
+
+			changes, err := readTenantMassifChanges(cCtx.Context, cCtx, cmd)
 			if err != nil {
 				return err
 			}
@@ -158,95 +201,154 @@ By default transient errors are re-tried without limit, and if the error is 429,
 			}
 			progress := newProgressor(cCtx, "tenants", len(changes))
 
-			concurency := min(len(changes), max(1, cCtx.Int("concurrency")))
-			for i := 0; i < len(changes); i += concurency {
-				err = replicateChanges(cCtx, cmd, changes[i:min(i+concurency, len(changes))], progress)
-				if err != nil {
-					return err
-				}
+			report, err := replicateAll(cCtx, cmd, changes, progress)
+			if rerr := reportReplication(cCtx, report); rerr != nil {
+				return rerr
 			}
-
-			return nil
+			return err
 		},
 	}
 }
 
-// replicateChanges replicate the changes for the provided slice of tenants.
-// Paralelism is limited by breaking the total changes into smaller slices and calling this function
-func replicateChanges(cCtx *cli.Context, cmd *CmdCtx, changes []watcher.LogMassif, progress Progresser) error {
-	var wg sync.WaitGroup
-	errChan := make(chan error, len(changes)) // buffered so it doesn't block
-
-	for _, change := range changes {
-		wg.Add(1)
-		go func(change watcher.LogMassif, errChan chan<- error) {
-			defer wg.Done()
-			defer progress.Completed()
+// replicateAll replicates the changes for all of the provided tenants.
+//
+// A pool of --concurrency workers each take the next tenant as soon as they
+// finish their current one, so a slow tenant only occupies its own worker. If
+// --rate-limit is set, the remote reads of all workers together are paced to
+// that many requests per second.
+//
+// Once a tenant fails no further tenants are started, unless --keep-going is
+// set. Either way, the report records the outcome for every tenant, and an
+// error is returned if any tenant was not replicated.
+func replicateAll(cCtx *cli.Context, cmd *CmdCtx, changes []watcher.LogMassif, progress Progresser) (*ReplicationReport, error) {
 
-			retries := max(-1, cCtx.Int("retries"))
-			for {
+	limiter := newRequestLimiter(cCtx.Float64("rate-limit"))
+	defer limiter.Stop()
 
-				replicator, startMassif, endMassif, err := initReplication(cCtx, cmd, change)
-				if err != nil {
-					errChan <- err
-					return
-				}
+	keepGoing := cCtx.Bool("keep-going")
+	concurrency := min(len(changes), max(1, cCtx.Int("concurrency")))
+	report := newReplicationReport(changes)
 
-				// There isn't really a better context. We could implement user
-				// defined timeouts for "lights out/ci" use cases in future. Humans can ctrl-c
-				err = replicator.ReplicateVerifiedUpdates(
-					context.Background(),
-					startMassif, endMassif,
-				)
-				if err == nil {
-					return
-				}
+	// workers are sent the index of the change, and each writes only the
+	// result at that index.
+	work := make(chan int)
+	var failed atomic.Bool
+	var firstErr error
+	var firstErrOnce sync.Once
 
-				// 429 is the only transient error we currently re-try
-				var retryDelay time.Duration
-				retryDelay, ok := azblobs.IsRateLimiting(err)
-				if !ok || retries == 0 {
-					// not transient
-					errChan <- err
-					return
-				}
-				if retryDelay == 0 {
-					retryDelay = defaultRetryDelay(err)
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				retries, err := replicateChange(cCtx, cmd, changes[i], limiter)
+				progress.Completed()
+				report.Logs[i].Retries = retries
+				if err != nil {
+					cmd.Log.Infof("%v", err)
+					firstErrOnce.Do(func() { firstErr = err })
+					failed.Store(true)
+					report.Logs[i].Status = replicationStatusFailed
+					report.Logs[i].Error = err.Error()
+					continue
 				}
-
-				// underflow will actually terminate the loop, but that would have been running for an infeasible amount of time
-				retries--
-				// in the default case, remaining is always reported as -1
-				cmd.Log.Infof("retrying in %s, remaining: %d", retryDelay, max(-1, retries))
+				report.Logs[i].Status = replicationStatusOK
 			}
-		}(change, errChan)
+		}()
 	}
 
-	// the error channel is buffered enough for each tenant, so this will not get deadlocked
+	for i := range changes {
+		if failed.Load() && !keepGoing {
+			break
+		}
+		work <- i
+	}
+	close(work)
 	wg.Wait()
-	close(errChan)
 
-	var errs []error
-	for err := range errChan {
-		cmd.Log.Infof("%v", err)
-		errs = append(errs, err)
+	report.tally()
+	if firstErr != nil && !keepGoing {
+		return report, firstErr
 	}
-	if len(errs) > 0 {
-		return errs[0]
+	if err := report.Err(); err != nil {
+		return report, err
 	}
 	if len(changes) == 1 {
 		cmd.Log.Infof("replication complete for log %x", changes[0].LogID)
 	} else {
 		cmd.Log.Infof("replication complete for %d logs", len(changes))
 	}
+	return report, nil
+}
+
+// reportReplication prints the per log summary when --keep-going is set, and
+// writes it to the --report file if requested.
+func reportReplication(cCtx *cli.Context, report *ReplicationReport) error {
+	if report == nil {
+		return nil
+	}
+	if cCtx.Bool("keep-going") {
+		report.Print(os.Stdout)
+	}
+	if cCtx.String("report") != "" {
+		return report.WriteFile(cCtx.String("report"))
+	}
 	return nil
 }
 
-func initReplication(cCtx *cli.Context, cmd *CmdCtx, change watcher.LogMassif) (*VerifiedReplica, uint32, uint32, error) {
+// replicateChange replicates the changes for a single tenant, retrying
+// transient errors. The number of retries made is returned.
+func replicateChange(cCtx *cli.Context, cmd *CmdCtx, change watcher.LogMassif, limiter *requestLimiter) (int, error) {
+
+	retries := max(-1, cCtx.Int("retries"))
+	for attempt := 0; ; attempt++ {
+
+		replicator, startMassif, endMassif, err := initReplication(cCtx, cmd, change, limiter)
+		if err != nil {
+			return attempt, err
+		}
+
+		// The context is cancelled by ctrl-c or --timeout. Each massif is
+		// verified before it is written to the replica, so an interrupted
+		// replication leaves the replica consistent.
+		err = replicator.ReplicateVerifiedUpdates(
+			cCtx.Context,
+			startMassif, endMassif,
+		)
+		if err == nil {
+			return attempt, nil
+		}
+
+		delay, ok := retryDelay(err, attempt)
+		if !ok || retries == 0 || cCtx.Context.Err() != nil {
+			// not transient
+			return attempt, err
+		}
+
+		// underflow will actually terminate the loop, but that would have been running for an infeasible amount of time
+		retries--
+		// in the default case, remaining is always reported as -1
+		cmd.Log.Infof("log %x attempt %d failed: %v. retrying in %s, remaining: %d",
+			change.LogID, attempt+1, err, delay, max(-1, retries))
+		select {
+		case <-cCtx.Context.Done():
+			return attempt, cCtx.Context.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func initReplication(
+	cCtx *cli.Context, cmd *CmdCtx, change watcher.LogMassif, limiter *requestLimiter,
+) (*VerifiedReplica, uint32, uint32, error) {
 	replicator, err := NewVerifiedReplica(cCtx, cmd.Clone(), change.LogID)
 	if err != nil {
 		return nil, 0, 0, err
 	}
+	if limiter != nil {
+		replicator.Source = &rateLimitedReader{ObjectReader: replicator.Source, limiter: limiter}
+	}
 	endMassif := uint32(change.Massif)
 	startMassif := uint32(0)
 	if cCtx.IsSet("ancestors") && uint32(cCtx.Int("ancestors")) < endMassif {
@@ -255,9 +357,17 @@ func initReplication(cCtx *cli.Context, cmd *CmdCtx, change watcher.LogMassif) (
 	return replicator, startMassif, endMassif, nil
 }
 
-func defaultRetryDelay(_ error) time.Duration {
-	// give the delay some jitter, this is universally a good practice
-	return baseDefaultRetryDelay + time.Duration(rand.Intn(jitterRangeMS))*time.Millisecond
+// defaultRetryDelay returns the backoff for the attempt, doubling from
+// baseDefaultRetryDelay up to maxRetryDelay.
+func defaultRetryDelay(_ error, attempt int) time.Duration {
+	delay := min(baseDefaultRetryDelay<<min(max(0, attempt), maxBackoffDoublings), maxRetryDelay)
+
+	// give the delay some jitter, this is universally a good practice. The
+	// jitter grows with the delay so that workers which failed together do
+	// not all retry together.
+	jitter := time.Duration(rand.Intn(jitterRangeMS)) * time.Millisecond
+	jitter += time.Duration(rand.Int63n(int64(delay/jitterDivisor) + 1))
+	return delay + jitter
 }
 
 func newProgressor(cCtx *cli.Context, barName string, increments int) Progresser {
@@ -271,6 +381,19 @@ type VerifiedReplica struct {
 	massifs.VerifyingReplicator
 	cCtx *cli.Context
 	log  logger.Logger
+
+	// keys is set when the checkpoints are verified by a key set
+	keys *keySetVerifier
+}
+
+// ReplicateVerifiedUpdates verifies and replicates the massifs from
+// startMassif to endMassif. Checkpoints verified by a key set, whose keys may
+// use different algorithms, are replicated by replicateKeySet.
+func (r *VerifiedReplica) ReplicateVerifiedUpdates(ctx context.Context, startMassif, endMassif uint32) error {
+	if r.keys != nil {
+		return replicateKeySet(ctx, &r.VerifyingReplicator, r.keys, startMassif, endMassif)
+	}
+	return r.VerifyingReplicator.ReplicateVerifiedUpdates(ctx, startMassif, endMassif)
 }
 
 func NewVerifiedReplica(
@@ -294,46 +417,67 @@ func NewVerifiedReplica(
 		return nil, fmt.Errorf("%w: remote-url is required", ErrRequiredOption)
 	}
 
-	reader, err := cfgReader(cmd, cCtx, cmd.RemoteURL)
-	if err != nil {
-		return nil, err
-	}
+	var remoteReader readerSelector
+	if cmd.RemoteProvider == remoteProviderHTTP {
+		remoteReader, err = NewCmdStorageProviderHTTP(cmd, cmd.RemoteURL)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		reader, err := cfgReader(cmd, cCtx, cmd.RemoteURL)
+		if err != nil {
+			return nil, err
+		}
 
-	dataUrl := cmd.RemoteURL // may be azurite in emulator mode, which overrides
+		dataUrl := cmd.RemoteURL // may be azurite in emulator mode, which overrides
 
-	remoteReader, err := NewCmdStorageProviderAzure(context.Background(), cCtx, cmd, dataUrl, reader)
-	if err != nil {
-		return nil, err
+		remoteReader, err = NewCmdStorageProviderAzure(cCtx.Context, cCtx, cmd, dataUrl, reader)
+		if err != nil {
+			return nil, err
+		}
 	}
-	if err = remoteReader.SelectLog(context.Background(), logID); err != nil {
+	if err = remoteReader.SelectLog(cCtx.Context, logID); err != nil {
 		return nil, fmt.Errorf("failed to select remote log %s: %w", logID, err)
 	}
 	localReader, err := NewCmdStorageProviderFS(
-		context.Background(), cCtx, cmd, cCtx.String("replicadir"), true)
+		cCtx.Context, cCtx, cmd, cCtx.String("replicadir"), true)
 	if err != nil {
 		return nil, err
 	}
 
-	if err = localReader.SelectLog(context.Background(), logID); err != nil {
+	if err = localReader.SelectLog(cCtx.Context, logID); err != nil {
 		return nil, fmt.Errorf("failed to select local log %s: %w", logID, err)
 	}
 
 	var verifier cose.Verifier
 
-	if cmd.CheckpointPublic.Public != nil {
-		verifier, err = cose.NewVerifier(cmd.CheckpointPublic.Alg, cmd.CheckpointPublic.Public)
+	if len(cmd.CheckpointKeys.Keys) != 0 {
+		verifier, err = checkpointVerifier(cmd)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	var sink massifs.ObjectReaderWriter = localReader
+	if cCtx.Bool("checkpoint-history") {
+		sink = &checkpointHistoryWriter{
+			ObjectReaderWriter: localReader,
+			codec:              cmd.CBORCodec,
+			history:            newCheckpointHistory(cCtx.String("replicadir"), logID),
+		}
+	}
+
+	// Each checkpoint may be signed by a different key of the set
+	keys, _ := verifier.(*keySetVerifier)
+
 	return &VerifiedReplica{
 		cCtx: cCtx,
 		log:  logger.Sugar,
+		keys: keys,
 		VerifyingReplicator: massifs.VerifyingReplicator{
 			CBORCodec:    cmd.CBORCodec,
 			COSEVerifier: verifier,
-			Sink:         localReader,
+			Sink:         sink,
 			Source:       remoteReader,
 		},
 	}, nil
@@ -385,41 +529,12 @@ func readTenantMassifChanges(ctx context.Context, cCtx *cli.Context, cmd *CmdCtx
 	if cCtx.IsSet("latest") {
 		// This is because people get tripped up with the `veracity watch -z 90000h | veracity replicate-logs` idiom,
 		// Its such a common use case that we should just make it work.
-		cfg, err := newWatchConfig(cCtx, cmd)
-		if err != nil {
-			return nil, err
-		}
-
-		if cmd.RemoteURL == "" {
-			return nil, fmt.Errorf("%w: remote-url is required", ErrRequiredOption)
-		}
-
-		reader, err := cfgReader(cmd, cCtx, cmd.RemoteURL)
-		if err != nil {
-			return nil, err
-		}
-		collator := azwatcher.NewLogTailCollator(
-			func(storagePath string) storage.LogID {
-				return storage.ParsePrefixedLogID("tenant/", storagePath)
-			},
-			storage.ObjectIndexFromPath,
-		)
-		watcher, err := azwatcher.NewWatcher(cfg.WatchConfig)
+		activity, err := watchLogActivity(ctx, cCtx, cmd, "")
 		if err != nil {
 			return nil, err
 		}
-		wc := &WatcherCollator{
-			Watcher:         watcher,
-			LogTailCollator: collator,
-		}
-
-		collector := &changeCollector{log: cmd.Log}
-		err = azwatcher.WatchForChanges(ctx, cfg.WatchConfig, wc, reader, collector)
-		if err != nil {
-			return nil, err
-		}
-
-		return scannerToLogMassifs(bufio.NewScanner(strings.NewReader(collector.watchOutput)))
+		changes, _ := newActivity(activity, "")
+		return changes, nil
 	}
 
 	logs := CtxGetLogOptions(cCtx)
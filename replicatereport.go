@@ -0,0 +1,110 @@
+package veracity
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/massifs/watcher"
+	"github.com/google/uuid"
+)
+
+const (
+	replicationStatusOK         = "ok"
+	replicationStatusFailed     = "failed"
+	replicationStatusNotStarted = "not-started"
+)
+
+var (
+	ErrReplicationFailed = errors.New("replication failed for one or more logs")
+)
+
+// ReplicationResult is the outcome of replicating a single log
+type ReplicationResult struct {
+	LogID   string `json:"logid"`
+	Massif  int    `json:"massifindex"`
+	Status  string `json:"status"`
+	Retries int    `json:"retries"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ReplicationReport is the per log summary of a replicate-logs run
+type ReplicationReport struct {
+	OK         int                 `json:"ok"`
+	Failed     int                 `json:"failed"`
+	NotStarted int                 `json:"not_started"`
+	Logs       []ReplicationResult `json:"logs"`
+}
+
+// newReplicationReport creates a report with every log not started. The
+// results are in the same order as the changes.
+func newReplicationReport(changes []watcher.LogMassif) *ReplicationReport {
+	report := &ReplicationReport{Logs: make([]ReplicationResult, len(changes))}
+	for i, change := range changes {
+		report.Logs[i] = ReplicationResult{
+			LogID:  logIDString(change.LogID),
+			Massif: change.Massif,
+			Status: replicationStatusNotStarted,
+		}
+	}
+	return report
+}
+
+// logIDString formats a log id as a uuid where possible
+func logIDString(logID storage.LogID) string {
+	uid, err := uuid.FromBytes(logID)
+	if err != nil {
+		return fmt.Sprintf("%x", []byte(logID))
+	}
+	return uid.String()
+}
+
+// tally counts the results by status. It is called once all replications have finished.
+func (r *ReplicationReport) tally() {
+	r.OK, r.Failed, r.NotStarted = 0, 0, 0
+	for _, result := range r.Logs {
+		switch result.Status {
+		case replicationStatusOK:
+			r.OK++
+		case replicationStatusFailed:
+			r.Failed++
+		default:
+			r.NotStarted++
+		}
+	}
+}
+
+// Err returns ErrReplicationFailed if any log was not replicated
+func (r *ReplicationReport) Err() error {
+	if r.Failed == 0 && r.NotStarted == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %d failed, %d not started, of %d", ErrReplicationFailed, r.Failed, r.NotStarted, len(r.Logs))
+}
+
+// Print writes a line for each log, followed by the totals
+func (r *ReplicationReport) Print(w io.Writer) {
+	for _, result := range r.Logs {
+		line := fmt.Sprintf("%-11s %s massif %d", result.Status, result.LogID, result.Massif)
+		if result.Retries > 0 {
+			line += fmt.Sprintf(", retried %d times", result.Retries)
+		}
+		if result.Error != "" {
+			line += ": " + result.Error
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintf(w, "%d ok, %d failed, %d not started\n", r.OK, r.Failed, r.NotStarted)
+}
+
+// WriteFile writes the report as json
+func (r *ReplicationReport) WriteFile(fileName string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, append(data, '\n'), os.FileMode(0644))
+}
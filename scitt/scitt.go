@@ -37,12 +37,17 @@ type idTimetampGenerator interface {
 }
 
 func NewMMRStatementFromFile(fileName string, idState idTimetampGenerator, policy RegistrationPolicy) (*MMRStatement, *ConciseProblemDetails, error) {
-	m := &MMRStatement{}
-
 	content, err := os.ReadFile(fileName)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to read file %s: %w", fileName, err)
 	}
+	return NewMMRStatement(content, idState, policy)
+}
+
+// NewMMRStatement checks the signed statement content and prepares it for registration
+func NewMMRStatement(content []byte, idState idTimetampGenerator, policy RegistrationPolicy) (*MMRStatement, *ConciseProblemDetails, error) {
+	var err error
+	m := &MMRStatement{}
 
 	var cpd *ConciseProblemDetails
 	m.CheckedStatement, cpd = RegistrationMandatoryChecks(content, policy)
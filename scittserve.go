@@ -0,0 +1,385 @@
+package veracity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/datatrails/veracity/scitt"
+	"github.com/forestrie/go-merklelog/massifs"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/urfave/cli/v2"
+	"github.com/veraison/go-cose"
+)
+
+const (
+	coseMediaType = "application/cose"
+
+	scittEntriesPath    = "/entries"
+	scittCheckpointPath = "/checkpoint"
+
+	scittMaxStatementSize = 1 << 20
+)
+
+var (
+	ErrEntryNotFound    = errors.New("entry not found")
+	ErrLedgerUnsealed   = errors.New("the ledger has massifs which are not sealed")
+	ErrSealerKeyNeeded  = errors.New("a sealer key is required, use --sealer-key or --sealer-key-pem")
+	ErrLedgerUnverified = errors.New("the head checkpoint of the ledger could not be verified")
+)
+
+// problemError carries the problem details for a request that is rejected
+type problemError struct {
+	scitt.ConciseProblemDetails
+}
+
+func (e *problemError) Error() string {
+	return e.Detail
+}
+
+// transparencyService is the ledger behind the scitt-serve endpoints
+type transparencyService interface {
+	// Register adds the signed statement to the ledger, and seals it. The
+	// entry id and a receipt against the new checkpoint are returned.
+	Register(ctx context.Context, signedStatement []byte) (uint64, []byte, error)
+	// Receipt returns a receipt for the entry
+	Receipt(ctx context.Context, entryID uint64) ([]byte, error)
+	// Checkpoint returns the latest signed checkpoint
+	Checkpoint(ctx context.Context) ([]byte, error)
+}
+
+// scittHandler provides SCRAPI style endpoints for a transparency service:
+//
+//	POST /entries         register a signed statement, responds with its receipt
+//	GET  /entries/{id}    the receipt for the entry
+//	GET  /checkpoint      the latest signed checkpoint
+//
+// The entry id is the mmr index of the leaf registered for the statement.
+// Errors are reported as RFC 9290 concise problem details.
+func newSCITTHandler(service transparencyService, log func(msg string, args ...any)) http.Handler {
+	h := &scittHandler{service: service, log: log}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+scittEntriesPath, h.register)
+	mux.HandleFunc("GET "+scittEntriesPath+"/{id}", h.receipt)
+	mux.HandleFunc("GET "+scittCheckpointPath, h.checkpoint)
+	return mux
+}
+
+type scittHandler struct {
+	service transparencyService
+	log     func(msg string, args ...any)
+}
+
+func (h *scittHandler) register(w http.ResponseWriter, r *http.Request) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" && contentType != coseMediaType {
+		h.error(w, r, &problemError{scitt.ConciseProblemDetails{
+			Title:        scitt.ProblemTitleRejected,
+			Detail:       fmt.Sprintf("signed statements must be %s, not %s", coseMediaType, contentType),
+			ResponseCode: scitt.CoAPUnsupportedContentFormat,
+		}})
+		return
+	}
+
+	signedStatement, err := io.ReadAll(http.MaxBytesReader(w, r.Body, scittMaxStatementSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			err = &problemError{scitt.ConciseProblemDetails{
+				Title:        scitt.ProblemTitleRejected,
+				Detail:       fmt.Sprintf("signed statements are limited to %d bytes", maxBytesErr.Limit),
+				ResponseCode: scitt.CoAPRequestEntityToLarge,
+			}}
+		}
+		h.error(w, r, err)
+		return
+	}
+
+	entryID, receipt, err := h.service.Register(r.Context(), signedStatement)
+	if err != nil {
+		h.error(w, r, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s/%d", scittEntriesPath, entryID))
+	h.write(w, http.StatusCreated, receipt)
+}
+
+func (h *scittHandler) receipt(w http.ResponseWriter, r *http.Request) {
+	entryID, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.error(w, r, fmt.Errorf("%w: %s", ErrEntryNotFound, r.PathValue("id")))
+		return
+	}
+	receipt, err := h.service.Receipt(r.Context(), entryID)
+	if err != nil {
+		h.error(w, r, err)
+		return
+	}
+	h.write(w, http.StatusOK, receipt)
+}
+
+func (h *scittHandler) checkpoint(w http.ResponseWriter, r *http.Request) {
+	checkpoint, err := h.service.Checkpoint(r.Context())
+	if err != nil {
+		h.error(w, r, err)
+		return
+	}
+	h.write(w, http.StatusOK, checkpoint)
+}
+
+func (h *scittHandler) write(w http.ResponseWriter, status int, data []byte) {
+	w.Header().Set("Content-Type", coseMediaType)
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func (h *scittHandler) error(w http.ResponseWriter, r *http.Request, err error) {
+	var problem *problemError
+	var details scitt.ConciseProblemDetails
+	switch {
+	case errors.As(err, &problem):
+		details = problem.ConciseProblemDetails
+	case errors.Is(err, ErrEntryNotFound) || errors.Is(err, storage.ErrDoesNotExist) ||
+		errors.Is(err, storage.ErrLogEmpty) || isMassifNotFound(err):
+		details = scitt.ConciseProblemDetails{
+			Title:        scitt.ProblemTitleOperationNotFound,
+			Detail:       err.Error(),
+			Instance:     scitt.ProblemInstanceNotFound,
+			ResponseCode: scitt.CoAPNotFound,
+		}
+	default:
+		if h.log != nil {
+			h.log("%s %s: %v", r.Method, r.URL.Path, err)
+		}
+		details = scitt.ConciseProblemDetails{
+			Title:        scitt.ProblemTitleOperationFailed,
+			Detail:       err.Error(),
+			Instance:     scitt.ProblemInstanceTransientAndInternal,
+			ResponseCode: scitt.CoAPInternalServerError,
+		}
+	}
+	w.Header().Set("Content-Type", scitt.RFC9290MediaType)
+	w.WriteHeader(int(details.ResponseCode))
+	w.Write(details.MustMarshalCBOR())
+}
+
+// scittLedger registers statements on a local ledger, in the same way as
+// append, but persists each new massif state and checkpoint to the ledger.
+// Registrations are serialized, so that id timestamps are added in order.
+type scittLedger struct {
+	mu sync.Mutex
+
+	cmd    *CmdCtx
+	open   func(ctx context.Context) (omniMassifReader, error)
+	signer *identifiableCoseSigner
+	// verifiers are tried in order to verify the ledger checkpoints. The
+	// sealer key is first, followed by any key for the checkpoint the ledger
+	// was forked from.
+	verifiers []cose.Verifier
+	subject   string
+}
+
+func (l *scittLedger) Register(ctx context.Context, signedStatement []byte) (uint64, []byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	mmrStatement, cpd, err := newMMRStatement(signedStatement, l.cmd)
+	if cpd != nil {
+		return 0, nil, &problemError{*cpd}
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	store, err := l.open(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	verified, started, err := ledgerAppendHead(ctx, store, &l.cmd.CBORCodec, l.verifiers)
+	if err != nil {
+		return 0, nil, err
+	}
+	appender := newLedgerAppender(l.cmd.CBORCodec, l.signer, l.subject, verified)
+	if err = appender.Add(mmrStatement); err != nil {
+		return 0, nil, err
+	}
+	sealed, err := appender.Seal()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err = commitSealed(ctx, store, sealed, started); err != nil {
+		return 0, nil, err
+	}
+
+	receipt, err := l.receipt(ctx, mmrStatement.MMRIndexLeaf)
+	if err != nil {
+		return 0, nil, err
+	}
+	return mmrStatement.MMRIndexLeaf, receipt, nil
+}
+
+func (l *scittLedger) Receipt(ctx context.Context, entryID uint64) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.receipt(ctx, entryID)
+}
+
+func (l *scittLedger) receipt(ctx context.Context, entryID uint64) ([]byte, error) {
+	if mmr.IndexHeight(entryID) != 0 {
+		return nil, fmt.Errorf("%w: %d is not a leaf", ErrEntryNotFound, entryID)
+	}
+
+	// Always read the ledger afresh, the store may cache data from before
+	// the last registration.
+	store, err := l.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	massifIndex := uint32(massifs.MassifIndexFromMMRIndex(l.cmd.MassifFmt.MassifHeight, entryID))
+	verified, verifier, err := verifiedLedgerContext(ctx, store, &l.cmd.CBORCodec, l.verifiers, massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	if entryID >= verified.MMRState.MMRSize {
+		return nil, fmt.Errorf("%w: %d", ErrEntryNotFound, entryID)
+	}
+
+	receipt, err := massifs.NewReceipt(
+		ctx, store, &l.cmd.CBORCodec, verifier, l.cmd.MassifFmt.MassifHeight, entryID)
+	if err != nil {
+		return nil, err
+	}
+	return receipt.MarshalCBOR()
+}
+
+func (l *scittLedger) Checkpoint(ctx context.Context) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	store, err := l.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	headIndex, err := store.HeadIndex(ctx, storage.ObjectCheckpoint)
+	if err != nil {
+		return nil, err
+	}
+	return store.CheckpointRead(ctx, headIndex)
+}
+
+// NewSCITTServeCmd serves a local ledger as a SCITT transparency service
+func NewSCITTServeCmd() *cli.Command {
+	return &cli.Command{
+		Name: "scitt-serve",
+		Usage: `serve a local ledger as a self hosted SCITT transparency service, for integration testing.
+
+Signed statements are registered, as they are by append, with POST /entries.
+The receipt for an entry is read with GET /entries/{id}, and the latest
+signed checkpoint with GET /checkpoint. Errors are reported as RFC 9290
+concise problem details.
+
+The ledger is the log selected by --logid in --data-local. Each registration
+is sealed, and the massif and checkpoint are written back to the ledger.`,
+		Flags: slices.Concat([]cli.Flag{
+			&cli.StringFlag{
+				Name:  "sealer-key",
+				Usage: "the sealer key to use for sealing the ledger, in cose .cbor. P-256, P-384, P-521 and Ed25519 keys are supported.",
+			},
+			&cli.StringFlag{
+				Name:  "sealer-key-pem",
+				Usage: "the sealer key to use for sealing the ledger, in PEM format. P-256, P-384, P-521 and Ed25519 keys are supported.",
+			},
+			&cli.StringFlag{
+				Name:  "logid",
+				Usage: "the log to serve as the ledger, --tenant may be used instead",
+			},
+			&cli.StringFlag{
+				Name:  "listen",
+				Usage: "the address to listen on",
+				Value: ":8080",
+			},
+		}, checkpointKeyFlags(), sealerIdentityFlags()),
+		Action: func(cCtx *cli.Context) error {
+			var err error
+			cmd := &CmdCtx{}
+			ctx := cCtx.Context
+
+			if !cCtx.IsSet("data-local") {
+				return errors.New("this command supports local replicas only, and requires --data-local")
+			}
+			if err = cfgLogging(cmd, cCtx); err != nil {
+				return err
+			}
+			if err = cfgMassifFmt(cmd, cCtx); err != nil {
+				return err
+			}
+			// The key for the checkpoint the ledger was forked from, if it
+			// was not sealed by the sealer key.
+			if err = CfgKeys(cmd, cCtx); err != nil {
+				return err
+			}
+
+			logID := CtxGetOneLogOption(cCtx)
+			if logID == nil {
+				return fmt.Errorf("%w: a tenant or logid is required for this command", ErrRequiredOption)
+			}
+
+			sealingKey, err := readSealerKey(cCtx)
+			if err != nil {
+				return err
+			}
+			if sealingKey == nil {
+				return ErrSealerKeyNeeded
+			}
+			signer, err := newIdentifiableCoseSigner(sealingKey, readSealerIdentity(cCtx))
+			if err != nil {
+				return err
+			}
+			if err = writeSealerJWKS(cCtx, signer); err != nil {
+				return err
+			}
+			sealerVerifier, err := cose.NewVerifier(signer.Algorithm(), sealingKey.Public())
+			if err != nil {
+				return err
+			}
+
+			ledger := &scittLedger{
+				cmd:       cmd,
+				signer:    signer,
+				verifiers: []cose.Verifier{sealerVerifier},
+				subject:   logIDString(logID),
+				open: func(ctx context.Context) (omniMassifReader, error) {
+					store, err := NewCmdStorageProviderFS(ctx, cCtx, cmd.Clone(), cCtx.String("data-local"), false)
+					if err != nil {
+						return nil, err
+					}
+					if err = store.SelectLog(ctx, logID); err != nil {
+						return nil, err
+					}
+					return store, nil
+				},
+			}
+			if len(cmd.CheckpointKeys.Keys) != 0 {
+				verifier, err := checkpointVerifier(cmd)
+				if err != nil {
+					return err
+				}
+				ledger.verifiers = append(ledger.verifiers, verifier)
+			}
+
+			listener, err := net.Listen("tcp", cCtx.String("listen"))
+			if err != nil {
+				return err
+			}
+			fmt.Printf("serving %s on http://%s\n", logIDString(logID), listener.Addr())
+			return serveUntilDone(ctx, &http.Server{Handler: newSCITTHandler(ledger, cmd.Log.Infof)}, listener)
+		},
+	}
+}
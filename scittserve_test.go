@@ -0,0 +1,101 @@
+package veracity
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/datatrails/veracity/scitt"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTransparencyService registers statements in memory, using the
+// statement itself as the receipt.
+type fakeTransparencyService struct {
+	entries    [][]byte
+	checkpoint []byte
+}
+
+func (s *fakeTransparencyService) Register(ctx context.Context, signedStatement []byte) (uint64, []byte, error) {
+	if len(signedStatement) == 0 {
+		// the real ledger rejects anything which is not a signed statement
+		return (&scittLedger{cmd: &CmdCtx{}}).Register(ctx, signedStatement)
+	}
+	s.entries = append(s.entries, signedStatement)
+	return uint64(len(s.entries) - 1), signedStatement, nil
+}
+
+func (s *fakeTransparencyService) Receipt(ctx context.Context, entryID uint64) ([]byte, error) {
+	if entryID >= uint64(len(s.entries)) {
+		return nil, ErrEntryNotFound
+	}
+	return s.entries[entryID], nil
+}
+
+func (s *fakeTransparencyService) Checkpoint(ctx context.Context) ([]byte, error) {
+	if s.checkpoint == nil {
+		return nil, storage.ErrLogEmpty
+	}
+	return s.checkpoint, nil
+}
+
+func requireProblem(t *testing.T, resp *http.Response, code uint64) scitt.ConciseProblemDetails {
+	t.Helper()
+	defer resp.Body.Close()
+	require.Equal(t, int(code), resp.StatusCode)
+	require.Equal(t, scitt.RFC9290MediaType, resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	var problem scitt.ConciseProblemDetails
+	require.NoError(t, cbor.Unmarshal(body, &problem))
+	assert.Equal(t, code, problem.ResponseCode)
+	return problem
+}
+
+func TestSCITTHandler(t *testing.T) {
+	service := &fakeTransparencyService{}
+	server := httptest.NewServer(newSCITTHandler(service, nil))
+	defer server.Close()
+	client := server.Client()
+
+	// No checkpoint before the first registration
+	resp, err := client.Get(server.URL + scittCheckpointPath)
+	require.NoError(t, err)
+	requireProblem(t, resp, scitt.CoAPNotFound)
+
+	resp, err = client.Post(server.URL+scittEntriesPath, coseMediaType, bytes.NewReader([]byte("statement")))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, coseMediaType, resp.Header.Get("Content-Type"))
+	assert.Equal(t, scittEntriesPath+"/0", resp.Header.Get("Location"))
+
+	resp, err = client.Get(server.URL + scittEntriesPath + "/0")
+	require.NoError(t, err)
+	receipt, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []byte("statement"), receipt)
+
+	resp, err = client.Get(server.URL + scittEntriesPath + "/1")
+	require.NoError(t, err)
+	problem := requireProblem(t, resp, scitt.CoAPNotFound)
+	assert.Equal(t, scitt.ProblemInstanceNotFound, problem.Instance)
+
+	resp, err = client.Post(server.URL+scittEntriesPath, "application/json", bytes.NewReader([]byte("{}")))
+	require.NoError(t, err)
+	requireProblem(t, resp, scitt.CoAPUnsupportedContentFormat)
+
+	// Statements failing the mandatory registration checks are rejected
+	resp, err = client.Post(server.URL+scittEntriesPath, coseMediaType, nil)
+	require.NoError(t, err)
+	problem = requireProblem(t, resp, scitt.CoAPBadRequest)
+	assert.Equal(t, scitt.ProblemInstanceRejectedByRegistrationPolicy, problem.Instance)
+}
@@ -0,0 +1,69 @@
+package veracity
+
+import (
+	"fmt"
+
+	"github.com/datatrails/veracity/keyio"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	defaultSealerIssuer = "https://github.com/forestrie/veracity"
+)
+
+// sealerIdentity is how the sealer is identified in the checkpoints and
+// receipts it signs. Relying parties use the kid to find the verification key.
+type sealerIdentity struct {
+	Issuer      string
+	KeyLocation string
+	KeyID       string
+}
+
+// sealerIdentityFlags returns the options read by readSealerIdentity, for commands which seal checkpoints
+func sealerIdentityFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "sealer-issuer",
+			Usage: "the issuer of the checkpoints and receipts signed by the sealer",
+			Value: defaultSealerIssuer,
+		},
+		&cli.StringFlag{
+			Name:  "sealer-key-location",
+			Usage: "where relying parties can find the sealer public key, for example the url of the --sealer-jwks file",
+		},
+		&cli.StringFlag{
+			Name:  "sealer-kid",
+			Usage: "the kid of the sealer key, defaults to the RFC 7638 thumbprint of the key",
+		},
+		&cli.StringFlag{
+			Name:  "sealer-jwks",
+			Usage: "if set, the sealer public key is written to this file as a JWKS, with the kid used for sealing",
+		},
+	}
+}
+
+func readSealerIdentity(cCtx *cli.Context) sealerIdentity {
+	return sealerIdentity{
+		Issuer:      cCtx.String("sealer-issuer"),
+		KeyLocation: cCtx.String("sealer-key-location"),
+		KeyID:       cCtx.String("sealer-kid"),
+	}
+}
+
+// writeSealerJWKS writes the public key of the signer to the --sealer-jwks
+// file, if it is set, so that relying parties can verify by kid.
+func writeSealerJWKS(cCtx *cli.Context, signer *identifiableCoseSigner) error {
+	fileName := cCtx.String("sealer-jwks")
+	if fileName == "" {
+		return nil
+	}
+	jwk, err := signer.JWK()
+	if err != nil {
+		return err
+	}
+	if err = keyio.WriteJWKS(fileName, jwk); err != nil {
+		return fmt.Errorf("failed to write sealer jwks %s: %w", fileName, err)
+	}
+	fmt.Printf("wrote sealer jwks %s, kid %s\n", fileName, jwk.Kid)
+	return nil
+}
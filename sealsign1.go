@@ -0,0 +1,136 @@
+package veracity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/datatrails/veracity/keyio"
+	"github.com/forestrie/go-merklelog/massifs"
+	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	commoncose "github.com/forestrie/go-merklelog/massifs/cose"
+	"github.com/veraison/go-cose"
+)
+
+// sealSign1 signs the checkpoint for the state. EC keys are signed by the
+// massifs.RootSigner. It only supports EC keys for the cnf claim, so other
+// keys are signed here, producing the same checkpoint and peak receipt
+// format with an OKP cnf key. The peaks are detached from the signed state.
+func sealSign1(
+	codec commoncbor.CBORCodec, signer *identifiableCoseSigner, subject string, state massifs.MMRState,
+) ([]byte, error) {
+
+	issuer := signer.identity.Issuer
+	kid := signer.KeyIdentifier()
+
+	if publicKey, ok := signer.publicKey.(*ecdsa.PublicKey); ok {
+		rootSigner := massifs.NewRootSigner(issuer, codec)
+		return rootSigner.Sign1(signer.innerSigner, kid, publicKey, subject, state, nil)
+	}
+
+	cnfClaim, err := newCNFClaim(issuer, subject, kid, signer.Algorithm(), signer.publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	receipts := make([][]byte, len(state.Peaks))
+	for i, peak := range state.Peaks {
+		if len(peak) != 32 {
+			return nil, fmt.Errorf("%w: peak must be 32 bytes, got %d", massifs.ErrNodeSize, len(peak))
+		}
+		// The peak receipts are signed with the payload detached, so that
+		// inclusion proofs can be attached by anyone with the log data.
+		receipt := cose.Sign1Message{
+			Headers: cose.Headers{
+				Protected: cose.ProtectedHeader{
+					massifs.VDSCoseReceiptsTag:      massifs.VDSMMRiver,
+					cose.HeaderLabelAlgorithm:       signer.Algorithm(),
+					cose.HeaderLabelKeyID:           []byte(kid),
+					commoncose.HeaderLabelCWTClaims: cnfClaim,
+				},
+				Unprotected: cose.UnprotectedHeader{},
+			},
+			Payload: peak,
+		}
+		if receipts[i], err = signDetached(&receipt, signer); err != nil {
+			return nil, err
+		}
+	}
+
+	payload, err := codec.MarshalCBOR(state)
+	if err != nil {
+		return nil, err
+	}
+	msg := cose.Sign1Message{
+		Headers: cose.Headers{
+			Protected: cose.ProtectedHeader{
+				commoncose.HeaderLabelCWTClaims: cnfClaim,
+			},
+			Unprotected: cose.UnprotectedHeader{
+				massifs.SealPeakReceiptsLabel: receipts,
+			},
+		},
+		Payload: payload,
+	}
+	if err = msg.Sign(rand.Reader, nil, signer); err != nil {
+		return nil, err
+	}
+
+	// As for the RootSigner, verifiers must obtain the peaks from the log
+	state.LegacySealRoot = nil
+	state.Peaks = nil
+	if msg.Payload, err = codec.MarshalCBOR(state); err != nil {
+		return nil, err
+	}
+
+	encodable, err := commoncose.NewCoseSign1Message(&msg)
+	if err != nil {
+		return nil, err
+	}
+	return encodable.MarshalCBOR()
+}
+
+// signDetached signs the message and encodes it without its payload
+func signDetached(msg *cose.Sign1Message, signer cose.Signer) ([]byte, error) {
+	if err := msg.Sign(rand.Reader, nil, signer); err != nil {
+		return nil, err
+	}
+	msg.Payload = nil
+	encodable, err := commoncose.NewCoseSign1Message(msg)
+	if err != nil {
+		return nil, err
+	}
+	return encodable.MarshalCBOR()
+}
+
+// newCNFClaim returns the CWT claims identifying the sealer key. EC keys use
+// the same representation as commoncose.NewCNFClaim.
+func newCNFClaim(
+	issuer string, subject string, kid string, alg cose.Algorithm, publicKey crypto.PublicKey,
+) (map[int64]any, error) {
+
+	var coseKey map[int64]any
+	switch pub := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		return commoncose.NewCNFClaim(issuer, subject, kid, alg, *pub), nil
+	case ed25519.PublicKey:
+		coseKey = map[int64]any{
+			commoncose.KeyIDLabel:     kid,
+			commoncose.KeyTypeLabel:   "OKP",
+			commoncose.AlgorithmLabel: alg,
+			commoncose.ECCurveLabel:   keyio.KeyTypeEd25519,
+			commoncose.ECXLabel:       []byte(pub),
+		}
+	default:
+		return nil, fmt.Errorf("%w: %T", keyio.ErrKeyTypeUnsupported, publicKey)
+	}
+	return map[int64]any{
+		cose.CWTClaimIssuer:  issuer,
+		cose.CWTClaimSubject: subject,
+		commoncose.CNFLabel: map[int64]any{
+			commoncose.CoseKeyLabel: coseKey,
+		},
+	}, nil
+}
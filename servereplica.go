@@ -0,0 +1,310 @@
+package veracity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/massifs/watcher"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	// serveReplicaPrefix is the url path the logs are served under, matching
+	// the public remote, so the data url for readers is http://host/verifiabledata
+	serveReplicaPrefix = "/verifiabledata/"
+
+	serveShutdownTimeout = 5 * time.Second
+)
+
+// replicaOpener opens the local replica of a log. Each request opens the
+// replica afresh, so that updates made by replicate-logs while serving are
+// seen, and so that requests do not share a cache.
+type replicaOpener func(ctx context.Context, logID storage.LogID) (massifs.ObjectReader, error)
+
+// replicaLister lists the logs in the local replica
+type replicaLister func() ([]storage.LogID, error)
+
+// replicaHandler serves massifs, checkpoints and a head index for each log,
+// using the same paths as the public remote:
+//
+//	merklelogs/v1/mmrs/tenant/{uuid}/0/massifs/{index:016}.log
+//	merklelogs/v1/mmrs/tenant/{uuid}/0/massifseals/{index:016}.sth
+//	merklelogs/v1/mmrs/tenant/{uuid}/0/index.json
+//
+// It also serves the latest activity of every log, which replicate-logs uses
+// to discover the logs for --latest and --follow, and to recognise the server:
+//
+//	merklelogs/v1/mmrs/tenant/index.json
+type replicaHandler struct {
+	open replicaOpener
+	list replicaLister
+	log  func(msg string, args ...any)
+}
+
+func (h *replicaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	rest, ok := strings.CutPrefix(r.URL.Path, serveReplicaPrefix+httpLogsPath)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if rest == httpIndexFileName {
+		data, err := h.activity(r.Context())
+		if err != nil {
+			h.error(w, r, err)
+			return
+		}
+		http.ServeContent(w, r, httpIndexFileName, time.Time{}, bytes.NewReader(data))
+		return
+	}
+
+	// {uuid}/0/{massifs|massifseals}/{name} or {uuid}/0/index.json
+	parts := strings.Split(rest, "/")
+	if len(parts) < 3 || parts[1] != httpLogEpochDir {
+		http.NotFound(w, r)
+		return
+	}
+	logID := ParseTenantOrLogID(parts[0])
+	if logID == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	reader, err := h.open(r.Context(), logID)
+	if err != nil {
+		h.error(w, r, err)
+		return
+	}
+
+	var data []byte
+	switch {
+	case len(parts) == 3 && parts[2] == httpIndexFileName:
+		data, err = replicaIndex(r.Context(), reader)
+	case len(parts) == 4 && parts[2] == httpMassifsDirName:
+		var massifIndex uint32
+		if massifIndex, err = parseObjectIndex(parts[3], storage.V1MMRMassifExt); err == nil {
+			data, err = reader.MassifReadN(r.Context(), massifIndex, -1)
+		}
+	case len(parts) == 4 && parts[2] == httpMassifSealsDir:
+		var massifIndex uint32
+		if massifIndex, err = parseObjectIndex(parts[3], storage.V1MMRSealSignedRootExt); err == nil {
+			data, err = reader.CheckpointRead(r.Context(), massifIndex)
+		}
+	default:
+		err = storage.ErrDoesNotExist
+	}
+	if err != nil {
+		h.error(w, r, err)
+		return
+	}
+
+	// ServeContent deals with HEAD and Range requests
+	http.ServeContent(w, r, parts[len(parts)-1], time.Time{}, bytes.NewReader(data))
+}
+
+func (h *replicaHandler) error(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, storage.ErrDoesNotExist) || errors.Is(err, storage.ErrLogEmpty) || isMassifNotFound(err) {
+		http.NotFound(w, r)
+		return
+	}
+	if h.log != nil {
+		h.log("%s %s: %v", r.Method, r.URL.Path, err)
+	}
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// activity returns the latest activity of every log in the replica, in the
+// format written by the watch command. Logs without massifs are left out.
+func (h *replicaHandler) activity(ctx context.Context) ([]byte, error) {
+	logIDs, err := h.list()
+	if err != nil {
+		return nil, err
+	}
+	activity := []watcher.LogActivity{}
+	for _, logID := range logIDs {
+		reader, err := h.open(ctx, logID)
+		if err != nil {
+			return nil, err
+		}
+		massifIndex, err := reader.HeadIndex(ctx, storage.ObjectMassifData)
+		if errors.Is(err, storage.ErrLogEmpty) || errors.Is(err, storage.ErrDoesNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		mc, err := massifs.GetMassifContext(ctx, reader, massifIndex)
+		if err != nil {
+			return nil, err
+		}
+		activity = append(activity, watcher.LogActivity{
+			LogID:       logID,
+			Massif:      int(massifIndex),
+			IDCommitted: massifs.IDTimestampToHex(mc.GetLastIDTimestamp(), uint8(mc.Start.CommitmentEpoch)),
+		})
+	}
+	return json.Marshal(activity)
+}
+
+// findReplicaLogs returns the logs which have massifs in the replica
+// directory. The retained checkpoints and prune manifests are not logs.
+func findReplicaLogs(replicaDir string, massifExt string) ([]storage.LogID, error) {
+	seen := map[string]bool{}
+	var logIDs []storage.LogID
+	err := filepath.WalkDir(replicaDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != replicaDir && (d.Name() == checkpointHistoryDirName || d.Name() == pruneManifestsDirName) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(d.Name(), massifExt) {
+			return nil
+		}
+		logID := storage.ParsePrefixedLogID("tenant/", filepath.ToSlash(path))
+		if logID == nil || seen[string(logID)] {
+			return nil
+		}
+		seen[string(logID)] = true
+		logIDs = append(logIDs, logID)
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(logIDs, func(i, j int) bool { return bytes.Compare(logIDs[i], logIDs[j]) < 0 })
+	return logIDs, nil
+}
+
+// parseObjectIndex parses the massif index from a name such as 0000000000000001.log
+func parseObjectIndex(name string, ext string) (uint32, error) {
+	base, ok := strings.CutSuffix(name, storage.V1MMRExtSep+ext)
+	if !ok {
+		return 0, storage.ErrDoesNotExist
+	}
+	massifIndex, err := strconv.ParseUint(base, 10, 32)
+	if err != nil {
+		return 0, storage.ErrDoesNotExist
+	}
+	return uint32(massifIndex), nil
+}
+
+// replicaIndex returns the head index file read by the http storage provider
+func replicaIndex(ctx context.Context, reader massifs.ObjectReader) ([]byte, error) {
+	var index httpLogIndex
+	var err error
+	if index.MassifHead, err = reader.HeadIndex(ctx, storage.ObjectMassifData); err != nil {
+		return nil, err
+	}
+	if index.CheckpointHead, err = reader.HeadIndex(ctx, storage.ObjectCheckpoint); err != nil {
+		return nil, err
+	}
+	return json.Marshal(index)
+}
+
+// NewServeReplicaCmd serves a local replica over http
+func NewServeReplicaCmd() *cli.Command {
+	return &cli.Command{
+		Name: "serve-replica",
+		Usage: `serve the massifs and checkpoints of a local replica over http, using the same paths as the public remote.
+
+Other instances can then replicate from this one with --data-url http://host:port/verifiabledata, including with --latest and --follow.
+Only GET and HEAD requests are supported, the replica is never modified.`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "replicadir",
+				Usage:   `the root directory for all tenant log replicas, as used with replicate-logs`,
+				Aliases: []string{"d"},
+				Value:   ".",
+			},
+			&cli.StringFlag{
+				Name:  "listen",
+				Usage: "the address to listen on",
+				Value: ":8080",
+			},
+		},
+		Action: func(cCtx *cli.Context) error {
+			var err error
+			cmd := &CmdCtx{}
+			ctx := cCtx.Context
+
+			if err = cfgLogging(cmd, cCtx); err != nil {
+				return err
+			}
+			if err = cfgMassifFmt(cmd, cCtx); err != nil {
+				return err
+			}
+
+			replicaDir := cCtx.String("replicadir")
+			handler := &replicaHandler{
+				open: func(ctx context.Context, logID storage.LogID) (massifs.ObjectReader, error) {
+					reader, err := NewCmdStorageProviderFS(ctx, cCtx, cmd.Clone(), replicaDir, false)
+					if err != nil {
+						return nil, err
+					}
+					if err = reader.SelectLog(ctx, logID); err != nil {
+						return nil, err
+					}
+					return reader, nil
+				},
+				list: func() ([]storage.LogID, error) {
+					return findReplicaLogs(replicaDir, massifExtension(cCtx))
+				},
+				log: cmd.Log.Infof,
+			}
+
+			listener, err := net.Listen("tcp", cCtx.String("listen"))
+			if err != nil {
+				return err
+			}
+			fmt.Printf("serving %s on http://%s%s\n", replicaDir, listener.Addr(), serveReplicaPrefix)
+			return serveUntilDone(ctx, &http.Server{Handler: handler}, listener)
+		},
+	}
+}
+
+// serveUntilDone serves until the context is done, then shuts the server down
+func serveUntilDone(ctx context.Context, server *http.Server, listener net.Listener) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Serve(listener)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-done; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
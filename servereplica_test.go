@@ -0,0 +1,150 @@
+package veracity
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/datatrails/veracity/keyio"
+	fsstorage "github.com/forestrie/go-merklelog-fs/storage"
+	"github.com/forestrie/go-merklelog/massifs"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeReplicaHTTPStore(t *testing.T) {
+	ctx := context.Background()
+	logID := storage.LogID([]byte("0123456789abcdef"))
+
+	replica := newMemoryReader()
+	for i := uint32(0); i < 3; i++ {
+		replica.massifs[i] = []byte(fmt.Sprintf("massif-%d", i))
+		replica.checkpoints[i] = []byte(fmt.Sprintf("checkpoint-%d", i))
+	}
+	handler := &replicaHandler{
+		open: func(ctx context.Context, id storage.LogID) (massifs.ObjectReader, error) {
+			if string(id) != string(logID) {
+				return nil, storage.ErrDoesNotExist
+			}
+			return replica, nil
+		},
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// The http storage provider reads the served replica as it would the remote
+	store := NewHTTPStore(server.Client(), server.URL+serveReplicaPrefix)
+	require.NoError(t, store.SelectLog(ctx, logID))
+
+	head, err := store.HeadIndex(ctx, storage.ObjectMassifData)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), head)
+
+	data, err := store.MassifReadN(ctx, 2, 6)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("massif"), data)
+
+	data, err = store.CheckpointRead(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("checkpoint-1"), data)
+
+	_, err = store.MassifReadN(ctx, 3, -1)
+	assert.ErrorIs(t, err, storage.ErrDoesNotExist)
+
+	require.NoError(t, store.SelectLog(ctx, storage.LogID([]byte("fedcba9876543210"))))
+	_, err = store.CheckpointRead(ctx, 0)
+	assert.ErrorIs(t, err, storage.ErrDoesNotExist)
+
+	resp, err := server.Client().Post(server.URL+serveReplicaPrefix, "text/plain", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestServeReplicaReplicateLogs(t *testing.T) {
+	ctx := context.Background()
+	tenant := "tenant/112758ce-a8cb-4924-8df8-fcba1e31f8b0"
+	logID := ParseTenantOrLogID(tenant)
+	require.NotNil(t, logID)
+
+	// Height 3 massifs have 4 leaves, the log has two massifs
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	replica, _, _, _ := newTestLedgerKey(t, key, 3, 6)
+	keyFile := filepath.Join(t.TempDir(), "checkpoint-key.pem")
+	require.NoError(t, keyio.WritePublicPEM(keyFile, &key.PublicKey))
+
+	handler := &replicaHandler{
+		open: func(ctx context.Context, id storage.LogID) (massifs.ObjectReader, error) {
+			if string(id) != string(logID) {
+				return nil, storage.ErrDoesNotExist
+			}
+			return replica, nil
+		},
+		list: func() ([]storage.LogID, error) {
+			return []storage.LogID{logID}, nil
+		},
+	}
+	var mu sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	dataURL := server.URL + strings.TrimSuffix(serveReplicaPrefix, "/")
+
+	// The listing has the head massif and last commit of every log
+	activity, err := NewHTTPStore(server.Client(), dataURL).LogActivity(ctx)
+	require.NoError(t, err)
+	require.Len(t, activity, 1)
+	assert.Equal(t, logID, activity[0].LogID)
+	assert.Equal(t, 1, activity[0].Massif)
+	assert.NotEmpty(t, activity[0].IDCommitted)
+
+	tests := []struct {
+		name       string
+		globalArgs []string
+		args       []string
+	}{
+		{name: "tenant", globalArgs: []string{"--tenant", tenant}, args: []string{"--massif", "1"}},
+		{name: "latest", args: []string{"--latest"}},
+		{name: "latest tenant", globalArgs: []string{"--tenant", tenant}, args: []string{"--latest"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requested = nil
+			replicaDir := t.TempDir()
+
+			// A downstream instance replicates with the usual command, the
+			// http provider is chosen because the server has a log listing
+			args := append([]string{"veracity", "--height", "3", "--data-url", dataURL}, tt.globalArgs...)
+			args = append(args, "replicate-logs", "--replicadir", replicaDir, "--checkpoint-public-pem", keyFile)
+			args = append(args, tt.args...)
+			app := AddCommands(NewApp("version", true), true)
+			require.NoError(t, app.RunContext(ctx, args))
+
+			assert.Contains(t, requested, serveReplicaPrefix+"merklelogs/v1/mmrs/"+tenant+"/0/massifs/0000000000000001.log")
+			assert.Contains(t, requested, serveReplicaPrefix+"merklelogs/v1/mmrs/"+tenant+"/0/massifseals/0000000000000001.sth")
+
+			local, err := newStorageProviderFS(ctx, &CmdCtx{MassifFmt: MassifFormatOptions{MassifHeight: 3}},
+				fsstorage.FSOptions{RootDir: replicaDir, MassifExtension: ".log"})
+			require.NoError(t, err)
+			require.NoError(t, local.SelectLog(ctx, logID))
+			head, err := local.HeadIndex(ctx, storage.ObjectMassifData)
+			require.NoError(t, err)
+			assert.Equal(t, uint32(1), head)
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package veracity
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/datatrails/veracity/scitt"
+	"github.com/forestrie/go-merklelog/massifs"
+	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	commoncose "github.com/forestrie/go-merklelog/massifs/cose"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+// memoryReader is an in memory replica of a single log
+type memoryReader struct {
+	massifs     map[uint32][]byte
+	checkpoints map[uint32][]byte
+}
+
+func newMemoryReader() *memoryReader {
+	return &memoryReader{massifs: map[uint32][]byte{}, checkpoints: map[uint32][]byte{}}
+}
+
+func (r *memoryReader) head(objects map[uint32][]byte) (uint32, error) {
+	if len(objects) == 0 {
+		return 0, storage.ErrLogEmpty
+	}
+	var head uint32
+	for i := range objects {
+		head = max(head, i)
+	}
+	return head, nil
+}
+
+func (r *memoryReader) HeadIndex(ctx context.Context, otype storage.ObjectType) (uint32, error) {
+	if otype == storage.ObjectCheckpoint {
+		return r.head(r.checkpoints)
+	}
+	return r.head(r.massifs)
+}
+
+func (r *memoryReader) MassifReadN(ctx context.Context, massifIndex uint32, n int) ([]byte, error) {
+	data, ok := r.massifs[massifIndex]
+	if !ok {
+		return nil, storage.ErrDoesNotExist
+	}
+	if n >= 0 && n < len(data) {
+		return data[:n], nil
+	}
+	return data, nil
+}
+
+func (r *memoryReader) CheckpointRead(ctx context.Context, massifIndex uint32) ([]byte, error) {
+	data, ok := r.checkpoints[massifIndex]
+	if !ok {
+		return nil, storage.ErrDoesNotExist
+	}
+	return data, nil
+}
+
+func (r *memoryReader) MassifData(massifIndex uint32) ([]byte, bool, error) {
+	data, ok := r.massifs[massifIndex]
+	return data, ok, nil
+}
+
+func (r *memoryReader) CheckpointData(massifIndex uint32) ([]byte, bool, error) {
+	data, ok := r.checkpoints[massifIndex]
+	return data, ok, nil
+}
+
+func (r *memoryReader) Put(
+	ctx context.Context, massifIndex uint32, ty storage.ObjectType, data []byte, failIfExists bool,
+) error {
+	objects := r.massifs
+	if ty == storage.ObjectCheckpoint {
+		objects = r.checkpoints
+	}
+	if _, ok := objects[massifIndex]; ok && failIfExists {
+		return fmt.Errorf("object %d exists", massifIndex)
+	}
+	objects[massifIndex] = append([]byte(nil), data...)
+	return nil
+}
+
+func testStatement(i int) *scitt.MMRStatement {
+	leafHash := sha256.Sum256([]byte{byte(i)})
+	return &scitt.MMRStatement{
+		CheckedStatement: scitt.CheckedStatement{Claims: &commoncose.CWTClaims{Issuer: "test"}},
+		IDTimestamp:      uint64(i + 1),
+		LeafHash:         leafHash[:],
+	}
+}
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return key
+}
+
+// newTestLog creates an empty in memory log of the massif height with
+// init-log, sealed by key. The signer and verifier for the key are returned
+// with the log.
+func newTestLog(
+	t *testing.T, key *ecdsa.PrivateKey, massifHeight uint8,
+) (*memoryReader, commoncbor.CBORCodec, *identifiableCoseSigner, cose.Verifier) {
+	codec, err := massifs.NewCBORCodec()
+	require.NoError(t, err)
+	signer, err := newIdentifiableCoseSigner(key, sealerIdentity{})
+	require.NoError(t, err)
+	verifier, err := cose.NewVerifier(cose.AlgorithmES256, &key.PublicKey)
+	require.NoError(t, err)
+
+	store := newMemoryReader()
+	_, err = initLog(context.Background(), store, codec, signer, MassifFormatOptions{MassifHeight: massifHeight, CommitmentEpoch: 1}, "test")
+	require.NoError(t, err)
+	return store, codec, signer, verifier
+}
+
+// newTestLedger creates an in memory ledger of the massif height, with the
+// leaves appended and every massif sealed by a new P-256 key. The verifier
+// for the key is returned with the appended statements.
+func newTestLedger(t *testing.T, massifHeight uint8, leaves int) (*memoryReader, commoncbor.CBORCodec, cose.Verifier, []*scitt.MMRStatement) {
+	return newTestLedgerKey(t, newTestKey(t), massifHeight, leaves)
+}
+
+// newTestLedgerKey creates a test ledger sealed by key
+func newTestLedgerKey(
+	t *testing.T, key *ecdsa.PrivateKey, massifHeight uint8, leaves int,
+) (*memoryReader, commoncbor.CBORCodec, cose.Verifier, []*scitt.MMRStatement) {
+	ctx := context.Background()
+	store, codec, signer, verifier := newTestLog(t, key, massifHeight)
+	verified, err := massifs.GetContextVerified(ctx, store, &codec, verifier, 0)
+	require.NoError(t, err)
+
+	appender := newLedgerAppender(codec, signer, "test", verified)
+	var statements []*scitt.MMRStatement
+	for i := range leaves {
+		statement := testStatement(i)
+		require.NoError(t, appender.Add(statement))
+		statements = append(statements, statement)
+	}
+	sealed, err := appender.Seal()
+	require.NoError(t, err)
+	require.NoError(t, commitSealed(ctx, store, sealed, false))
+	return store, codec, verifier, statements
+}
@@ -0,0 +1,104 @@
+package veracity
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	azblobs "github.com/forestrie/go-merklelog-azure/blobs"
+)
+
+const (
+	// maxRetryDelay caps the exponential backoff for transient errors
+	maxRetryDelay = 2 * time.Minute
+	// maxBackoffDoublings bounds the exponent so the shift can not overflow
+	maxBackoffDoublings = 16
+)
+
+// transientStatusText are the http status texts, as they appear in storage
+// error messages, for the server side errors which are worth re-trying.
+var transientStatusText = []string{
+	"500 Internal Server Error",
+	"502 Bad Gateway",
+	"503 Service Unavailable",
+	"504 Gateway Timeout",
+}
+
+// statusCoder is satisfied by storage errors which carry the http status
+type statusCoder interface {
+	StatusCode() int
+}
+
+// retryDelay classifies err and returns the delay before the next attempt if
+// it is transient. attempt is the zero based count of the attempts already
+// retried.
+//
+// Rate limiting (429) honors the Retry-After header, if one was provided.
+// Otherwise network errors, timeouts, server errors (500, 502, 503, 504) and
+// partially read responses are retried with exponential backoff and jitter.
+// An explicit cancellation is never retried.
+func retryDelay(err error, attempt int) (time.Duration, bool) {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return 0, false
+	}
+
+	if delay, ok := azblobs.IsRateLimiting(err); ok {
+		if delay == 0 {
+			delay = defaultRetryDelay(err, attempt)
+		}
+		return delay, true
+	}
+
+	if isTransient(err) {
+		return defaultRetryDelay(err, attempt), true
+	}
+	return 0, false
+}
+
+// isTransient returns true for errors that are likely to succeed if re-tried
+func isTransient(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	// A connection which drops part way through a read
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && (dnsErr.IsTemporary || dnsErr.IsTimeout) {
+		return true
+	}
+
+	var sc statusCoder
+	if errors.As(err, &sc) {
+		switch sc.StatusCode() {
+		case 500, 502, 503, 504:
+			return true
+		}
+	}
+
+	// NOTE: the storage client errors do not all expose the status, so we need
+	// to do string contains.
+	msg := err.Error()
+	for _, text := range transientStatusText {
+		if strings.Contains(msg, text) {
+			return true
+		}
+	}
+	return false
+}
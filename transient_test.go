@@ -0,0 +1,54 @@
+package veracity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type statusError int
+
+func (e statusError) Error() string   { return fmt.Sprintf("status %d", int(e)) }
+func (e statusError) StatusCode() int { return int(e) }
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"cancelled", fmt.Errorf("read: %w", context.Canceled), false},
+		{"deadline", fmt.Errorf("read: %w", context.DeadlineExceeded), true},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"partial read", fmt.Errorf("massif: %w", io.ErrUnexpectedEOF), true},
+		{"503 status", statusError(503), true},
+		{"404 status", statusError(404), false},
+		{"502 text", errors.New("RESPONSE 502: 502 Bad Gateway"), true},
+		{"verification", ErrSealVerifyFailed, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, got := retryDelay(tt.err, 0)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDefaultRetryDelayBacksOff(t *testing.T) {
+	first := defaultRetryDelay(nil, 0)
+	assert.GreaterOrEqual(t, first, baseDefaultRetryDelay)
+
+	third := defaultRetryDelay(nil, 2)
+	assert.GreaterOrEqual(t, third, 4*baseDefaultRetryDelay)
+
+	capped := defaultRetryDelay(nil, 1000)
+	assert.GreaterOrEqual(t, capped, maxRetryDelay)
+	assert.LessOrEqual(t, capped, maxRetryDelay+maxRetryDelay/jitterDivisor+time.Duration(jitterRangeMS)*time.Millisecond)
+}
@@ -1,17 +1,23 @@
 package veracity
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/forestrie/go-merklelog/massifs"
+	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	"github.com/forestrie/go-merklelog/massifs/storage"
 	"github.com/forestrie/go-merklelog/mmr"
 	"github.com/forestrie/go-merklelog-datatrails/appentry"
 	"github.com/forestrie/go-merklelog-datatrails/datatrails"
 	"github.com/urfave/cli/v2"
+	"github.com/veraison/go-cose"
 
 	appdata "github.com/forestrie/go-merklelog-datatrails/appdata"
 )
@@ -19,12 +25,27 @@ import (
 var (
 	ErrVerifyInclusionFailed = errors.New("the entry is not in the log")
 	ErrUncommittedEvents     = errors.New("one or more events did not have record of their inclusion in the log")
+	ErrEventNotSealed        = errors.New("the entry is beyond the size of the log sealed by the latest checkpoint")
+	ErrCheckpointVersion     = errors.New("the checkpoint does not sign the accumulator peaks")
 )
 
 const (
-	skipUncommittedFlagName = "skip-uncommitted"
+	skipUncommittedFlagName   = "skip-uncommitted"
+	againstCheckpointFlagName = "against-checkpoint"
+	verifyOutputFlagName      = "output"
 )
 
+// isMassifNotFound returns true if err indicates the massif has not been
+// created yet, which means the log has not grown to include it.
+//
+// NOTE: due to the azblob error type we need to do string contains.
+func isMassifNotFound(err error) bool {
+	if errors.Is(err, storage.ErrDoesNotExist) {
+		return true
+	}
+	return err != nil && strings.Contains(err.Error(), "BlobNotFound")
+}
+
 func proofPath(proof [][]byte) string {
 	var hexProof []string
 	for _, node := range proof {
@@ -35,7 +56,7 @@ func proofPath(proof [][]byte) string {
 
 // verifyEvent is an example function of how to verify the inclusion of a datatrails event using the mmr and massifs modules
 func verifyEvent(
-	reader massifs.ObjectReader,
+	ctx context.Context, reader massifs.ObjectReader,
 	event *appentry.AppEntry, logTenant string, mmrEntry []byte, massifHeight uint8,
 ) ([][]byte, error) {
 
@@ -46,7 +67,7 @@ func verifyEvent(
 	massifIndex := massifs.MassifIndexFromMMRIndex(massifHeight, mmrIndex)
 
 	// read the massif blob
-	massif, err := massifs.GetMassifContext(context.Background(), reader, uint32(massifIndex))
+	massif, err := massifs.GetMassifContext(ctx, reader, uint32(massifIndex))
 	if err != nil {
 		return nil, err
 	}
@@ -69,6 +90,310 @@ func verifyEvent(
 	return nil, fmt.Errorf("%w: %v", ErrVerifyInclusionFailed, err)
 }
 
+// sealedLogHead is the verified head checkpoint of a log, along with node
+// access for proving inclusion against it
+type sealedLogHead struct {
+	state massifs.MMRState
+	store *massifNodeStore
+}
+
+// readSealedLogHead reads the head checkpoint of the selected log. The
+// checkpoint signature is verified, and the head massif is verified as
+// consistent with the signed state.
+func readSealedLogHead(
+	ctx context.Context, reader massifs.ObjectReader,
+	codec *commoncbor.CBORCodec, verifier cose.Verifier, massifHeight uint8,
+) (*sealedLogHead, error) {
+
+	headIndex, err := reader.HeadIndex(ctx, storage.ObjectCheckpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get head checkpoint index: %w", err)
+	}
+
+	verified, err := getContextVerified(ctx, reader, codec, verifier, headIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify head checkpoint: %w", err)
+	}
+	if verified.MMRState.Version == int(massifs.MMRStateVersion0) {
+		return nil, ErrCheckpointVersion
+	}
+
+	store := newMassifNodeStore(ctx, reader, massifHeight)
+	store.contexts[headIndex] = &verified.MassifContext
+
+	return &sealedLogHead{state: verified.MMRState, store: store}, nil
+}
+
+// verifyEventSealed verifies the inclusion of mmrEntry against the peaks
+// signed by the log head checkpoint. The proof may span many massifs.
+func verifyEventSealed(head *sealedLogHead, mmrIndex uint64, mmrEntry []byte) ([][]byte, error) {
+
+	mmrSize := head.state.MMRSize
+	if mmrIndex >= mmrSize {
+		return nil, fmt.Errorf("%w: mmrIndex %d, sealed size %d", ErrEventNotSealed, mmrIndex, mmrSize)
+	}
+
+	proof, err := mmr.InclusionProof(head.store, mmrSize-1, mmrIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	root := mmr.IncludedRoot(sha256.New(), mmrIndex, mmrEntry, proof)
+	peakIndex := mmr.PeakIndex(mmr.LeafCount(mmrSize), len(proof))
+	if peakIndex >= len(head.state.Peaks) || !bytes.Equal(root, head.state.Peaks[peakIndex]) {
+		return nil, fmt.Errorf("%w: mmrIndex %d does not reproduce the signed peak %d", ErrVerifyInclusionFailed, mmrIndex, peakIndex)
+	}
+	return proof, nil
+}
+
+// verifiableEvent is the access to an event needed to verify its inclusion.
+// It is implemented by appentry.AppEntry.
+type verifiableEvent interface {
+	AppID() string
+	MMRIndex() uint64
+	LogTenant() (string, error)
+	MMREntry(mc *massifs.MassifContext) ([]byte, error)
+	VerifyInclusion(mc *massifs.MassifContext) (bool, error)
+	Proof(mc *massifs.MassifContext) ([][]byte, error)
+}
+
+// splitUnconfirmedEvents removes the events which have no merklelog commit
+// from the app data, returning the remaining app data and the identities of
+// the removed events. The app data is either a single event or a list of
+// events. If every event is removed the returned app data is nil. App data
+// which isn't in either form is returned unchanged.
+func splitUnconfirmedEvents(appData []byte) ([]byte, []string, error) {
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(appData, &fields); err != nil {
+		return appData, nil, nil
+	}
+	eventIdentity := func(event []byte) string {
+		var v struct {
+			Identity string `json:"identity"`
+		}
+		_ = json.Unmarshal(event, &v)
+		return v.Identity
+	}
+
+	listed, ok := fields["events"]
+	if !ok {
+		if _, err := extractIDTimestamp(appData); err != nil {
+			return nil, []string{eventIdentity(appData)}, nil
+		}
+		return appData, nil, nil
+	}
+
+	var events []json.RawMessage
+	if err := json.Unmarshal(listed, &events); err != nil {
+		return appData, nil, nil
+	}
+	var unconfirmed []string
+	confirmed := []json.RawMessage{}
+	for _, event := range events {
+		if _, err := extractIDTimestamp(event); err != nil {
+			unconfirmed = append(unconfirmed, eventIdentity(event))
+			continue
+		}
+		confirmed = append(confirmed, event)
+	}
+	if len(unconfirmed) == 0 {
+		return appData, nil, nil
+	}
+	if len(confirmed) == 0 {
+		return nil, unconfirmed, nil
+	}
+
+	var err error
+	if fields["events"], err = json.Marshal(confirmed); err != nil {
+		return nil, nil, err
+	}
+	appData, err = json.Marshal(fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	return appData, unconfirmed, nil
+}
+
+// verifyIncludedEvents verifies the inclusion of each event, adding the
+// outcome to the report. If verifier is set, each event is verified against
+// the peaks signed by the head checkpoint of its log, otherwise against the
+// massif containing the event. Verification failures and events which are
+// not committed are reported, all other errors are terminal.
+//
+//nolint:gocognit
+func verifyIncludedEvents(
+	ctx context.Context, reader readerSelector, codec *commoncbor.CBORCodec, verifier cose.Verifier,
+	massifHeight uint8, tenantLogPath string, events []verifiableEvent, report *verifyIncludedReport,
+) error {
+
+	// When verifying against the checkpoint, the head checkpoint of each log
+	// is read and verified once.
+	sealedHeads := map[string]*sealedLogHead{}
+
+	previousMassifIndex := uint32(0)
+	var massifContext *massifs.MassifContext = nil
+
+	for _, event := range events {
+
+		// get the massif index for the event event
+		massifIndex := uint32(massifs.MassifIndexFromMMRIndex(massifHeight, event.MMRIndex()))
+
+		rec := newVerifyIncludedRecord(event, massifIndex)
+
+		// find the log tenant path if not provided
+		if tenantLogPath == "" {
+
+			var err error
+			tenantLogPath, err = event.LogTenant()
+			if err != nil {
+				return err
+			}
+		}
+
+		logId := datatrails.TenantID2LogID(tenantLogPath)
+
+		if err := reader.SelectLog(ctx, logId); err != nil {
+			return fmt.Errorf("failed to select log %s: %w", tenantLogPath, err)
+		}
+
+		if verifier != nil {
+			head, ok := sealedHeads[string(logId)]
+			if !ok {
+				var err error
+				head, err = readSealedLogHead(ctx, reader, codec, verifier, massifHeight)
+				if err != nil {
+					return err
+				}
+				sealedHeads[string(logId)] = head
+				report.log("verifying against checkpoint for %s, sealed size %d", tenantLogPath, head.state.MMRSize)
+			}
+
+			massif, err := head.store.Massif(massifIndex)
+			if isMassifNotFound(err) {
+				if err = report.NotCommitted(rec, "not committed"); err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			// The event is beyond the current head of the log
+			if event.MMRIndex() >= massif.RangeCount() {
+				if err = report.NotCommitted(rec, "not committed"); err != nil {
+					return err
+				}
+				continue
+			}
+
+			mmrEntry, err := event.MMREntry(massif)
+			if err != nil {
+				if err = report.Failed(rec, nil, err); err != nil {
+					return err
+				}
+				continue
+			}
+
+			proof, err := verifyEventSealed(head, event.MMRIndex(), mmrEntry)
+
+			// Events added since the latest checkpoint are committed
+			// to the log but not yet sealed. Until they are sealed
+			// there is no signed record of their inclusion.
+			if errors.Is(err, ErrEventNotSealed) {
+				if err = report.NotCommitted(rec, "not sealed"); err != nil {
+					return err
+				}
+				continue
+			}
+			if errors.Is(err, ErrVerifyInclusionFailed) {
+				if err = report.Failed(rec, mmrEntry, err); err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			if err = report.Verified(rec, mmrEntry, proof); err != nil {
+				return err
+			}
+			continue
+		}
+		// check if we need this event is part of a different massif than the previous event
+		//
+		// if it is, we get the new massif
+		if massifContext == nil || massifIndex != previousMassifIndex {
+			massif, err := massifs.GetMassifContext(ctx, reader, massifIndex)
+
+			// The massif for the event does not exist yet, the log
+			// has not grown to include the event.
+			if isMassifNotFound(err) {
+				if err = report.NotCommitted(rec, "not committed"); err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			massifContext = &massif
+			previousMassifIndex = massifIndex
+		}
+
+		// The event is beyond the current head of the log
+		if event.MMRIndex() >= massifContext.RangeCount() {
+			if err := report.NotCommitted(rec, "not committed"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// A leaf hash which can't be produced for the event is reported as
+		// a failure of that event, as for the verification failures below
+		mmrEntry, err := event.MMREntry(massifContext)
+		if err != nil {
+			if err = report.Failed(rec, nil, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		verified, err := event.VerifyInclusion(massifContext)
+
+		// We keep going if the error is a verification failure, as
+		// this supports reporting "gaps". All other errors are
+		// immediately terminal
+		if errors.Is(err, mmr.ErrVerifyInclusionFailed) || !verified {
+			if err == nil {
+				err = ErrVerifyInclusionFailed
+			}
+			if err = report.Failed(rec, mmrEntry, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// all other errors immediately terminal
+		if err != nil {
+			return err
+		}
+
+		proof, err := event.Proof(massifContext)
+		if err != nil {
+			return err
+		}
+
+		if err = report.Verified(rec, mmrEntry, proof); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // NewVerifyIncludedCmd verifies inclusion of a DataTrails event in the tenants Merkle Log
 //
 //nolint:gocognit
@@ -84,9 +409,28 @@ See the README for example use.
 
 Note: for publicly attested events, or shared protected events, you must use --tenant. Otherwise, the tenant is inferred from the event data.
 `,
-		Flags: []cli.Flag{
-			&cli.BoolFlag{Name: skipUncommittedFlagName, Value: false},
-		},
+		Flags: append([]cli.Flag{
+			&cli.BoolFlag{
+				Name: skipUncommittedFlagName, Value: false,
+				Usage: "skip events which are not yet included in the log, rather than failing",
+			},
+			&cli.BoolFlag{
+				Name:  againstCheckpointFlagName,
+				Usage: "verify against the peaks signed by the latest checkpoint, rather than the massif containing the event. requires the checkpoint public key",
+			},
+			&cli.StringFlag{
+				Name: verifyOutputFlagName,
+				Usage: fmt.Sprintf(
+					"print a structured record for each event, and a summary, to stdout. one of [%s, %s]",
+					verifyOutputJSON, verifyOutputNDJSON),
+				Action: func(ctx *cli.Context, v string) error {
+					if v != verifyOutputJSON && v != verifyOutputNDJSON {
+						return fmt.Errorf("unsupported output '%s'. Use one of: %s, %s", v, verifyOutputJSON, verifyOutputNDJSON)
+					}
+					return nil
+				},
+			},
+		}, checkpointKeyFlags()...),
 		Action: func(cCtx *cli.Context) error {
 			cmd := &CmdCtx{}
 
@@ -128,98 +472,62 @@ Note: for publicly attested events, or shared protected events, you must use --t
 				return err
 			}
 
-			verifiableLogEntries, err := appdata.AppDataToVerifiableLogEntries(appData, tenantIdentity)
+			appData, unconfirmed, err := splitUnconfirmedEvents(appData)
 			if err != nil {
 				return err
 			}
+			var verifiableLogEntries []appentry.AppEntry
+			if appData != nil {
+				verifiableLogEntries, err = appdata.AppDataToVerifiableLogEntries(appData, tenantIdentity)
+				if err != nil {
+					return err
+				}
+			}
 
 			reader, err := newMassifReader(cmd, cCtx)
 			if err != nil {
 				return err
 			}
 
-			var countNotCommitted int
-			var countVerifyFailed int
-
-			previousMassifIndex := uint32(0)
-			var massifContext *massifs.MassifContext = nil
-
-			for _, event := range verifiableLogEntries {
-
-				leafIndex := mmr.LeafIndex(event.MMRIndex())
-
-				// get the massif index for the event event
-				massifIndex := uint32(massifs.MassifIndexFromMMRIndex(cmd.MassifFmt.MassifHeight, event.MMRIndex()))
-
-				// find the log tenant path if not provided
-				if tenantLogPath == "" {
-
-					var err error
-					tenantLogPath, err = event.LogTenant()
-					if err != nil {
-						return err
-					}
-				}
-
-				logId := datatrails.TenantID2LogID(tenantLogPath)
-
-				if err := reader.SelectLog(cCtx.Context, logId); err != nil {
-					return fmt.Errorf("failed to select log %s: %w", tenantLogPath, err)
-				}
-
-				// check if we need this event is part of a different massif than the previous event
-				//
-				// if it is, we get the new massif
-				if massifContext == nil || massifIndex != previousMassifIndex {
-					massif, err := massifs.GetMassifContext(context.Background(), reader, massifIndex)
-					if err != nil {
-						return err
-					}
-
-					massifContext = &massif
+			// When verifying against the checkpoint, a verifier is required
+			// for the head checkpoint of each log.
+			var verifier cose.Verifier
+			againstCheckpoint := cCtx.Bool(againstCheckpointFlagName)
+			if againstCheckpoint {
+				if err = CfgKeys(cmd, cCtx); err != nil {
+					return err
 				}
-
-				verified, err := event.VerifyInclusion(massifContext)
-
-				// We keep going if the error is a verification failure, as
-				// this supports reporting "gaps". All other errors are
-				// immediately terminal
-				if errors.Is(err, mmr.ErrVerifyInclusionFailed) || !verified {
-					countVerifyFailed += 1
-					log("XX|%d %d\n", event.MMRIndex(), leafIndex)
-					continue
+				if len(cmd.CheckpointKeys.Keys) == 0 {
+					return errors.New("checkpoint public key is required")
 				}
-
-				// all other errors immediately terminal
+				verifier, err = checkpointVerifier(cmd)
 				if err != nil {
 					return err
 				}
+			}
 
-				proof, err := event.Proof(massifContext)
-				if err != nil {
+			report := newVerifyIncludedReport(cCtx.String(verifyOutputFlagName), os.Stdout, log)
+
+			for _, identity := range unconfirmed {
+				if err = report.Unconfirmed(identity); err != nil {
 					return err
 				}
-
-				log("OK|%d %d|%s", event.MMRIndex(), leafIndex, proofPath(proof))
-
-				previousMassifIndex = massifIndex
 			}
 
-			if countVerifyFailed != 0 {
-				if len(verifiableLogEntries) == 1 {
-					return fmt.Errorf("%w. for tenant %s", ErrVerifyInclusionFailed, tenantIdentity)
-				}
-				return fmt.Errorf("%w. for tenant %s", ErrVerifyInclusionFailed, tenantIdentity)
+			events := make([]verifiableEvent, 0, len(verifiableLogEntries))
+			for i := range verifiableLogEntries {
+				events = append(events, &verifiableLogEntries[i])
 			}
-
-			if countNotCommitted > 0 {
-				if len(verifiableLogEntries) == 1 {
-					return fmt.Errorf("%w. not committed: %d", ErrUncommittedEvents, countNotCommitted)
-				}
-				return fmt.Errorf("%w. %d events of %d were not committed", ErrUncommittedEvents, countNotCommitted, len(verifiableLogEntries))
+			err = verifyIncludedEvents(
+				cCtx.Context, reader, &cmd.CBORCodec, verifier, cmd.MassifFmt.MassifHeight, tenantLogPath, events, report)
+			if err != nil {
+				return err
 			}
 
-			return nil
+			if err = report.Finish(cCtx.Bool(skipUncommittedFlagName)); err != nil {
+				return err
+			}
+			return report.Result(cCtx.Bool(skipUncommittedFlagName), tenantIdentity)
 		},
 	}
 }
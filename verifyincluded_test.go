@@ -0,0 +1,214 @@
+package veracity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/datatrails/veracity/scitt"
+	"github.com/forestrie/go-merklelog/massifs"
+	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+// testEvent is a verifiableEvent whose leaf hash is known, rather than
+// derived from event data
+type testEvent struct {
+	identity string
+	mmrIndex uint64
+	leafHash []byte
+	entryErr error
+}
+
+func (e *testEvent) AppID() string              { return e.identity }
+func (e *testEvent) MMRIndex() uint64           { return e.mmrIndex }
+func (e *testEvent) LogTenant() (string, error) { return "tenant/test", nil }
+
+// MMREntry fails for events beyond the end of the massif, as the entries
+// of events do when they read their idtimestamp from the log
+func (e *testEvent) MMREntry(mc *massifs.MassifContext) ([]byte, error) {
+	if e.mmrIndex >= mc.RangeCount() {
+		return nil, massifs.ErrIndexNotInMassif
+	}
+	return e.leafHash, e.entryErr
+}
+
+func (e *testEvent) VerifyInclusion(mc *massifs.MassifContext) (bool, error) {
+	proof, err := e.Proof(mc)
+	if err != nil {
+		return false, err
+	}
+	return mmr.VerifyInclusion(mc, sha256.New(), mc.RangeCount(), e.leafHash, e.mmrIndex, proof)
+}
+
+func (e *testEvent) Proof(mc *massifs.MassifContext) ([][]byte, error) {
+	return mmr.InclusionProof(mc, mc.RangeCount()-1, e.mmrIndex)
+}
+
+// testLogSelector serves a single in memory log for any log id
+type testLogSelector struct {
+	*memoryReader
+}
+
+func (testLogSelector) SelectLog(ctx context.Context, logId storage.LogID) error { return nil }
+
+func TestSplitUnconfirmedEvents(t *testing.T) {
+	confirmed := `{"identity": "events/1", "merklelog_entry": {"commit": {"index": "0", "idtimestamp": "018fa97ef269039b00"}}}`
+	unconfirmed := `{"identity": "events/2", "merklelog_entry": {"commit": {"index": "0", "idtimestamp": ""}}}`
+	pending := `{"identity": "events/3"}`
+
+	appData, identities, err := splitUnconfirmedEvents([]byte(confirmed))
+	require.NoError(t, err)
+	assert.Equal(t, confirmed, string(appData))
+	assert.Empty(t, identities)
+
+	appData, identities, err = splitUnconfirmedEvents([]byte(pending))
+	require.NoError(t, err)
+	assert.Nil(t, appData)
+	assert.Equal(t, []string{"events/3"}, identities)
+
+	appData, identities, err = splitUnconfirmedEvents(
+		[]byte(`{"events": [` + confirmed + `, ` + unconfirmed + `, ` + pending + `], "next_page_token": "x"}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"events/2", "events/3"}, identities)
+	var list struct {
+		Events        []json.RawMessage `json:"events"`
+		NextPageToken string            `json:"next_page_token"`
+	}
+	require.NoError(t, json.Unmarshal(appData, &list))
+	require.Len(t, list.Events, 1)
+	assert.JSONEq(t, confirmed, string(list.Events[0]))
+	assert.Equal(t, "x", list.NextPageToken)
+
+	appData, identities, err = splitUnconfirmedEvents([]byte(`{"events": [` + pending + `]}`))
+	require.NoError(t, err)
+	assert.Nil(t, appData)
+	assert.Equal(t, []string{"events/3"}, identities)
+}
+
+// newVerifyIncludedLedger creates a ledger with a height 4 massif, which has
+// room for 8 leaves. Three leaves are sealed by the checkpoint, and a fourth
+// is committed to the massif after it.
+func newVerifyIncludedLedger(t *testing.T) (*memoryReader, commoncbor.CBORCodec, cose.Verifier, []*scitt.MMRStatement) {
+	ctx := context.Background()
+	store, codec, signer, verifier := newTestLog(t, newTestKey(t), 4)
+	var checkpoint []byte
+	var statements []*scitt.MMRStatement
+	for i := range 4 {
+		verified, err := massifs.GetContextVerified(ctx, store, &codec, verifier, 0)
+		require.NoError(t, err)
+		appender := newLedgerAppender(codec, signer, "test", verified)
+		statement := testStatement(i)
+		require.NoError(t, appender.Add(statement))
+		statements = append(statements, statement)
+		sealed, err := appender.Seal()
+		require.NoError(t, err)
+		require.NoError(t, commitSealed(ctx, store, sealed, false))
+		if i == 2 {
+			checkpoint = store.checkpoints[0]
+		}
+	}
+	store.checkpoints[0] = checkpoint
+	return store, codec, verifier, statements
+}
+
+func TestVerifyIncludedEvents(t *testing.T) {
+	ctx := context.Background()
+	store, codec, verifier, statements := newVerifyIncludedLedger(t)
+
+	committed := &testEvent{identity: "committed", mmrIndex: statements[0].MMRIndexLeaf, leafHash: statements[0].LeafHash}
+	unsealed := &testEvent{identity: "unsealed", mmrIndex: statements[3].MMRIndexLeaf, leafHash: statements[3].LeafHash}
+	// The next leaf would be in the same massif, the leaf after that massif
+	// would be in one which does not exist
+	pastHead := &testEvent{
+		identity: "past head", mmrIndex: mmr.FirstMMRSize(statements[3].MMRIndexLeaf), leafHash: statements[3].LeafHash}
+	pastMassif := &testEvent{identity: "past massif", mmrIndex: mmr.FirstMMRSize(15) + 1, leafHash: statements[3].LeafHash}
+	events := []verifiableEvent{committed, unsealed, pastHead, pastMassif}
+
+	tests := []struct {
+		name              string
+		againstCheckpoint bool
+		skipUncommitted   bool
+		wantUnsealed      string
+		wantNotCommitted  int
+	}{
+		{name: "massif", wantUnsealed: verifyStatusVerified, wantNotCommitted: 3},
+		{name: "massif skip uncommitted", skipUncommitted: true, wantUnsealed: verifyStatusVerified, wantNotCommitted: 3},
+		{name: "checkpoint", againstCheckpoint: true, wantUnsealed: verifyStatusNotCommitted, wantNotCommitted: 4},
+		{name: "checkpoint skip uncommitted", againstCheckpoint: true, skipUncommitted: true,
+			wantUnsealed: verifyStatusNotCommitted, wantNotCommitted: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var eventVerifier cose.Verifier
+			if tt.againstCheckpoint {
+				eventVerifier = verifier
+			}
+			report := newVerifyIncludedReport(verifyOutputJSON, io.Discard, func(string, ...any) {})
+			require.NoError(t, report.Unconfirmed("unconfirmed"))
+			err := verifyIncludedEvents(
+				ctx, testLogSelector{store}, &codec, eventVerifier, 4, "tenant/test", events, report)
+			require.NoError(t, err)
+
+			status := map[string]string{}
+			for _, rec := range report.records {
+				status[rec.Identity] = rec.Status
+				if rec.Identity == "past head" {
+					assert.Equal(t, "not committed", rec.Reason)
+				}
+			}
+			assert.Equal(t, map[string]string{
+				"unconfirmed": verifyStatusNotCommitted,
+				"committed":   verifyStatusVerified,
+				"unsealed":    tt.wantUnsealed,
+				"past head":   verifyStatusNotCommitted,
+				"past massif": verifyStatusNotCommitted,
+			}, status)
+			assert.Equal(t, tt.wantNotCommitted, report.summary.NotCommitted)
+			assert.Zero(t, report.summary.Failed)
+
+			err = report.Result(tt.skipUncommitted, "tenant/test")
+			if tt.skipUncommitted {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrUncommittedEvents)
+		})
+	}
+}
+
+func TestVerifyIncludedEventsEntryFailure(t *testing.T) {
+	ctx := context.Background()
+	store, codec, verifier, statements := newVerifyIncludedLedger(t)
+	errEntry := errors.New("bad event data")
+
+	// An event whose leaf hash can't be produced fails, and the events after
+	// it are still verified
+	events := []verifiableEvent{
+		&testEvent{identity: "bad entry", mmrIndex: statements[1].MMRIndexLeaf, entryErr: errEntry},
+		&testEvent{identity: "past massif", mmrIndex: mmr.FirstMMRSize(15) + 1, leafHash: statements[3].LeafHash},
+		&testEvent{identity: "committed", mmrIndex: statements[0].MMRIndexLeaf, leafHash: statements[0].LeafHash},
+	}
+
+	for _, eventVerifier := range []cose.Verifier{nil, verifier} {
+		report := newVerifyIncludedReport(verifyOutputJSON, io.Discard, func(string, ...any) {})
+		err := verifyIncludedEvents(
+			ctx, testLogSelector{store}, &codec, eventVerifier, 4, "tenant/test", events, report)
+		require.NoError(t, err)
+
+		require.Len(t, report.records, 3)
+		assert.Equal(t, verifyStatusFailed, report.records[0].Status)
+		assert.Equal(t, errEntry.Error(), report.records[0].Reason)
+		assert.Empty(t, report.records[0].LeafHash)
+		assert.Equal(t, verifyStatusNotCommitted, report.records[1].Status)
+		assert.Equal(t, verifyStatusVerified, report.records[2].Status)
+		assert.ErrorIs(t, report.Result(true, "tenant/test"), ErrVerifyInclusionFailed)
+	}
+}
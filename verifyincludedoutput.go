@@ -0,0 +1,167 @@
+package veracity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/forestrie/go-merklelog/mmr"
+)
+
+const (
+	verifyOutputJSON   = "json"
+	verifyOutputNDJSON = "ndjson"
+
+	verifyStatusVerified     = "verified"
+	verifyStatusFailed       = "failed"
+	verifyStatusNotCommitted = "not-committed"
+)
+
+// VerifyIncludedRecord is the structured result of verifying a single event
+type VerifyIncludedRecord struct {
+	Identity    string   `json:"identity"`
+	MMRIndex    uint64   `json:"mmrindex"`
+	LeafIndex   uint64   `json:"leafindex"`
+	MassifIndex uint32   `json:"massifindex"`
+	LeafHash    string   `json:"leaf_hash,omitempty"`
+	Proof       []string `json:"proof,omitempty"`
+	Status      string   `json:"status"`
+	Reason      string   `json:"reason,omitempty"`
+}
+
+// VerifyIncludedSummary totals the results of a verify-included run
+type VerifyIncludedSummary struct {
+	Total        int  `json:"total"`
+	Verified     int  `json:"verified"`
+	Failed       int  `json:"failed"`
+	NotCommitted int  `json:"not_committed"`
+	Skipped      bool `json:"skipped_uncommitted"`
+}
+
+// verifyIncludedReport accumulates the per event results. The results are
+// always logged in the OK|XX|-- line format. When a structured output format
+// is selected they are also written to out, ndjson records as they are
+// reported and json records all together on Finish.
+type verifyIncludedReport struct {
+	format  string
+	out     io.Writer
+	log     func(m string, args ...any)
+	records []VerifyIncludedRecord
+	summary VerifyIncludedSummary
+}
+
+func newVerifyIncludedReport(format string, out io.Writer, log func(m string, args ...any)) *verifyIncludedReport {
+	return &verifyIncludedReport{format: format, out: out, log: log}
+}
+
+// newVerifyIncludedRecord starts the record for an event, the outcome is set by the report methods
+func newVerifyIncludedRecord(event verifiableEvent, massifIndex uint32) VerifyIncludedRecord {
+	return VerifyIncludedRecord{
+		Identity:    event.AppID(),
+		MMRIndex:    event.MMRIndex(),
+		LeafIndex:   mmr.LeafIndex(event.MMRIndex()),
+		MassifIndex: massifIndex,
+	}
+}
+
+func (r *verifyIncludedReport) Verified(rec VerifyIncludedRecord, leafHash []byte, proof [][]byte) error {
+	r.summary.Verified += 1
+	rec.Status = verifyStatusVerified
+	rec.LeafHash = fmt.Sprintf("%x", leafHash)
+	for _, node := range proof {
+		rec.Proof = append(rec.Proof, fmt.Sprintf("%x", node))
+	}
+	r.log("OK|%d %d|%s", rec.MMRIndex, rec.LeafIndex, proofPath(proof))
+	return r.add(rec)
+}
+
+func (r *verifyIncludedReport) Failed(rec VerifyIncludedRecord, leafHash []byte, reason error) error {
+	r.summary.Failed += 1
+	rec.Status = verifyStatusFailed
+	rec.LeafHash = fmt.Sprintf("%x", leafHash)
+	rec.Reason = reason.Error()
+	r.log("XX|%d %d|%s", rec.MMRIndex, rec.LeafIndex, rec.Reason)
+	return r.add(rec)
+}
+
+func (r *verifyIncludedReport) NotCommitted(rec VerifyIncludedRecord, reason string) error {
+	r.summary.NotCommitted += 1
+	rec.Status = verifyStatusNotCommitted
+	rec.Reason = reason
+	r.log("--|%d %d|%s", rec.MMRIndex, rec.LeafIndex, rec.Reason)
+	return r.add(rec)
+}
+
+// Unconfirmed reports an event which has no merklelog commit, so can't be
+// located in the log, as not committed
+func (r *verifyIncludedReport) Unconfirmed(identity string) error {
+	return r.NotCommitted(VerifyIncludedRecord{Identity: identity}, "no merklelog confirmation")
+}
+
+func (r *verifyIncludedReport) add(rec VerifyIncludedRecord) error {
+	r.summary.Total += 1
+	switch r.format {
+	case verifyOutputNDJSON:
+		return r.writeLine(rec)
+	case verifyOutputJSON:
+		r.records = append(r.records, rec)
+	}
+	return nil
+}
+
+// Finish writes the summary, and for json output all of the records
+func (r *verifyIncludedReport) Finish(skippedUncommitted bool) error {
+	r.summary.Skipped = skippedUncommitted && r.summary.NotCommitted > 0
+	switch r.format {
+	case verifyOutputNDJSON:
+		return r.writeLine(struct {
+			Summary VerifyIncludedSummary `json:"summary"`
+		}{r.summary})
+	case verifyOutputJSON:
+		records := r.records
+		if records == nil {
+			records = []VerifyIncludedRecord{}
+		}
+		data, err := json.MarshalIndent(struct {
+			Events  []VerifyIncludedRecord `json:"events"`
+			Summary VerifyIncludedSummary  `json:"summary"`
+		}{records, r.summary}, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(r.out, string(data))
+		return err
+	}
+	return nil
+}
+
+// Result returns an error if any event failed verification or, unless they
+// are skipped, if any event was not committed.
+func (r *verifyIncludedReport) Result(skipUncommitted bool, tenantIdentity string) error {
+	if r.summary.Failed != 0 {
+		return fmt.Errorf("%w. for tenant %s", ErrVerifyInclusionFailed, tenantIdentity)
+	}
+
+	countNotCommitted := r.summary.NotCommitted
+	if countNotCommitted > 0 && skipUncommitted {
+		r.log("skipped %d events of %d which were not committed", countNotCommitted, r.summary.Total)
+		return nil
+	}
+
+	if countNotCommitted > 0 {
+		if r.summary.Total == 1 {
+			return fmt.Errorf("%w. not committed: %d", ErrUncommittedEvents, countNotCommitted)
+		}
+		return fmt.Errorf("%w. %d events of %d were not committed", ErrUncommittedEvents, countNotCommitted, r.summary.Total)
+	}
+	return nil
+}
+
+func (r *verifyIncludedReport) writeLine(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(r.out, string(data))
+	return err
+}
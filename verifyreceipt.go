@@ -0,0 +1,177 @@
+package veracity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/datatrails/veracity/mmriver"
+	"github.com/forestrie/go-merklelog/massifs"
+	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	commoncose "github.com/forestrie/go-merklelog/massifs/cose"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/urfave/cli/v2"
+	"github.com/veraison/go-cose"
+)
+
+// Unprotected header labels for the conveniences append includes on its
+// receipts. The unprotected headers are not signed, they carry the values
+// needed to re-create the leaf hash from the signed statement.
+const (
+	receiptTagOriginSubject = int64(-257)
+	receiptTagOriginIssuer  = receiptTagOriginSubject - 1
+	receiptTagLeafHash      = receiptTagOriginSubject - 2
+	receiptTagIDTimestamp   = receiptTagOriginSubject - 3
+	receiptTagExtraBytes    = receiptTagOriginSubject - 4
+)
+
+var (
+	ErrVerifyReceiptFailed   = errors.New("the receipt did not verify")
+	ErrReceiptProofsMissing  = errors.New("the receipt does not contain an inclusion proof")
+	ErrReceiptLeafUnresolved = errors.New("provide exactly one of --leaf-hash or --signed-statement")
+)
+
+// receiptUnprotectedHeader decodes the unprotected header of MMRIVER receipts
+// produced by the receipt and append commands. The labels must match
+// VDSCoseReceiptProofsTag and the receiptTag constants above.
+type receiptUnprotectedHeader struct {
+	VerifiableProofs massifs.MMRiverVerifiableProofs `cbor:"396,keyasint"`
+	OriginSubject    string                          `cbor:"-257,keyasint,omitempty"`
+	OriginIssuer     string                          `cbor:"-258,keyasint,omitempty"`
+	LeafHash         []byte                          `cbor:"-259,keyasint,omitempty"`
+	IDTimestamp      uint64                          `cbor:"-260,keyasint,omitempty"`
+	ExtraBytes       []byte                          `cbor:"-261,keyasint,omitempty"`
+}
+
+// NewVerifyReceiptCmd verifies a COSE receipt of inclusion without access to the log
+func NewVerifyReceiptCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "verify-receipt",
+		Usage: "verify a COSE Receipt of inclusion offline, using only the receipt, the proven leaf and the log signing key",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name: "receipt", Aliases: []string{"r"},
+				Usage:    "the cbor encoded COSE receipt file, as produced by the receipt or append commands",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "leaf-hash",
+				Usage: "the hex encoded leaf hash the receipt proves inclusion of",
+			},
+			&cli.StringFlag{
+				Name:  "signed-statement",
+				Usage: "the signed statement the receipt was issued for. The idtimestamp and extra bytes are read from the receipt",
+			},
+		}, checkpointKeyFlags()...),
+		Action: func(cCtx *cli.Context) error {
+			var err error
+			cmd := &CmdCtx{}
+
+			if err = cfgLogging(cmd, cCtx); err != nil {
+				return err
+			}
+			if err = CfgKeys(cmd, cCtx); err != nil {
+				return err
+			}
+			if len(cmd.CheckpointKeys.Keys) == 0 {
+				return errors.New("checkpoint public key is required")
+			}
+			verifier, err := checkpointVerifier(cmd)
+			if err != nil {
+				return err
+			}
+
+			data, err := os.ReadFile(cCtx.String("receipt"))
+			if err != nil {
+				return fmt.Errorf("failed to read receipt file %s: %w", cCtx.String("receipt"), err)
+			}
+			receipt, header, err := decodeReceipt(data)
+			if err != nil {
+				return err
+			}
+
+			leafHash, err := receiptLeafHash(cCtx, header)
+			if err != nil {
+				return err
+			}
+
+			root, err := verifyReceipt(receipt, header, leafHash, verifier)
+			if err != nil {
+				return err
+			}
+
+			proof := header.VerifiableProofs.InclusionProofs[0]
+			fmt.Printf("OK|%d %d|%x\n", proof.Index, mmr.LeafIndex(proof.Index), root)
+			return nil
+		},
+	}
+}
+
+// decodeReceipt decodes the COSE receipt and its unprotected header
+func decodeReceipt(data []byte) (*commoncose.CoseSign1Message, receiptUnprotectedHeader, error) {
+	receipt, err := commoncose.NewCoseSign1MessageFromCBOR(
+		data, commoncose.WithDecOptions(commoncbor.DecOptions))
+	if err != nil {
+		return nil, receiptUnprotectedHeader{}, fmt.Errorf("failed to decode receipt: %w", err)
+	}
+
+	var header receiptUnprotectedHeader
+	if err = cbor.Unmarshal(receipt.Headers.RawUnprotected, &header); err != nil {
+		return nil, receiptUnprotectedHeader{}, fmt.Errorf("failed to decode receipt proofs: %w", err)
+	}
+	if len(header.VerifiableProofs.InclusionProofs) == 0 {
+		return nil, receiptUnprotectedHeader{}, ErrReceiptProofsMissing
+	}
+	return receipt, header, nil
+}
+
+// receiptLeafHash returns the leaf hash from --leaf-hash, or re-creates it from --signed-statement
+func receiptLeafHash(cCtx *cli.Context, header receiptUnprotectedHeader) ([]byte, error) {
+	if cCtx.IsSet("leaf-hash") == cCtx.IsSet("signed-statement") {
+		return nil, ErrReceiptLeafUnresolved
+	}
+
+	if cCtx.IsSet("leaf-hash") {
+		leafHash, err := hex.DecodeString(cCtx.String("leaf-hash"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode leaf hash: %w", err)
+		}
+		return leafHash, nil
+	}
+
+	statement, err := os.ReadFile(cCtx.String("signed-statement"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signed statement %s: %w", cCtx.String("signed-statement"), err)
+	}
+	if header.IDTimestamp == 0 {
+		return nil, fmt.Errorf("%w: the receipt does not carry the idtimestamp for the statement", ErrReceiptLeafUnresolved)
+	}
+	return mmriver.MMREntryVersion1(header.ExtraBytes, header.IDTimestamp, statement)
+}
+
+// verifyReceipt recomputes the root from the leaf hash and the receipt's
+// inclusion proof, and verifies the receipt signature over that root. The
+// verified root is returned.
+func verifyReceipt(
+	receipt *commoncose.CoseSign1Message, header receiptUnprotectedHeader,
+	leafHash []byte, verifier cose.Verifier,
+) ([]byte, error) {
+
+	proof := header.VerifiableProofs.InclusionProofs[0]
+	root := mmr.IncludedRoot(sha256.New(), proof.Index, leafHash, proof.InclusionPath)
+
+	// The receipt is signed with a detached payload, the payload is the peak
+	// the proof produces.
+	receipt.Payload = root
+	verifier, err := messageVerifier(verifier, receipt.Sign1Message)
+	if err != nil {
+		return nil, fmt.Errorf("%w: mmrIndex %d: %v", ErrVerifyReceiptFailed, proof.Index, err)
+	}
+	if err := receipt.Verify(nil, verifier); err != nil {
+		return nil, fmt.Errorf("%w: mmrIndex %d: %v", ErrVerifyReceiptFailed, proof.Index, err)
+	}
+	return root, nil
+}
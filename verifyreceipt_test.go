@@ -0,0 +1,145 @@
+package veracity
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/datatrails/veracity/keyio"
+	"github.com/datatrails/veracity/mmriver"
+	"github.com/datatrails/veracity/scitt"
+	"github.com/forestrie/go-merklelog/massifs"
+	commoncose "github.com/forestrie/go-merklelog/massifs/cose"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+// receiptFixture is a sealed ledger of signed statements, with a receipt for each
+type receiptFixture struct {
+	key        *ecdsa.PrivateKey
+	verifier   cose.Verifier
+	statements []*scitt.MMRStatement
+	receipts   [][]byte
+}
+
+func newReceiptFixture(t *testing.T, count int) receiptFixture {
+	ctx := context.Background()
+	key := newTestKey(t)
+	store, codec, signer, verifier := newTestLog(t, key, 3)
+	verified, err := massifs.GetContextVerified(ctx, store, &codec, verifier, 0)
+	require.NoError(t, err)
+
+	// The leaf hashes are created from the statement content as append does
+	fixture := receiptFixture{key: key, verifier: verifier}
+	appender := newLedgerAppender(codec, signer, "test", verified)
+	for i := range count {
+		statement := &scitt.MMRStatement{
+			CheckedStatement: scitt.CheckedStatement{Claims: &commoncose.CWTClaims{Issuer: "test", Subject: "subject"}},
+			Content:          []byte(fmt.Sprintf("statement-%d", i)),
+			ExtraBytes:       mmriver.TrimExtraBytes([]byte("subject")),
+			IDTimestamp:      uint64(i + 1),
+		}
+		statement.LeafHash, err = mmriver.MMREntryVersion1(statement.ExtraBytes, statement.IDTimestamp, statement.Content)
+		require.NoError(t, err)
+		require.NoError(t, appender.Add(statement))
+		fixture.statements = append(fixture.statements, statement)
+	}
+	_, err = appender.Seal()
+	require.NoError(t, err)
+	for _, statement := range fixture.statements {
+		leafMassif, ok := appender.Sealed(statement.MMRIndexLeaf)
+		require.True(t, ok)
+		fixture.receipts = append(fixture.receipts, mustStatementReceipt(t, codec, leafMassif, statement))
+	}
+	return fixture
+}
+
+func TestVerifyReceipt(t *testing.T) {
+	fixture := newReceiptFixture(t, 5)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherVerifier, err := cose.NewVerifier(cose.AlgorithmES256, &otherKey.PublicKey)
+	require.NoError(t, err)
+
+	for i, statement := range fixture.statements {
+		receipt, header, err := decodeReceipt(fixture.receipts[i])
+		require.NoError(t, err)
+		_, err = verifyReceipt(receipt, header, statement.LeafHash, fixture.verifier)
+		assert.NoError(t, err, "leaf %d", statement.MMRIndexLeaf)
+	}
+
+	// The first leaf of five has a non empty inclusion path
+	statement := fixture.statements[0]
+
+	t.Run("tampered path", func(t *testing.T) {
+		receipt, header, err := decodeReceipt(fixture.receipts[0])
+		require.NoError(t, err)
+		path := header.VerifiableProofs.InclusionProofs[0].InclusionPath
+		require.NotEmpty(t, path)
+		path[0][0] ^= 1
+		_, err = verifyReceipt(receipt, header, statement.LeafHash, fixture.verifier)
+		assert.ErrorIs(t, err, ErrVerifyReceiptFailed)
+	})
+
+	t.Run("wrong leaf", func(t *testing.T) {
+		receipt, header, err := decodeReceipt(fixture.receipts[0])
+		require.NoError(t, err)
+		_, err = verifyReceipt(receipt, header, fixture.statements[1].LeafHash, fixture.verifier)
+		assert.ErrorIs(t, err, ErrVerifyReceiptFailed)
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		receipt, header, err := decodeReceipt(fixture.receipts[0])
+		require.NoError(t, err)
+		_, err = verifyReceipt(receipt, header, statement.LeafHash, otherVerifier)
+		assert.ErrorIs(t, err, ErrVerifyReceiptFailed)
+	})
+}
+
+func TestVerifyReceiptCmd(t *testing.T) {
+	fixture := newReceiptFixture(t, 5)
+	statement := fixture.statements[2]
+
+	dir := t.TempDir()
+	receiptFile := filepath.Join(dir, "receipt.cbor")
+	require.NoError(t, os.WriteFile(receiptFile, fixture.receipts[2], 0644))
+	statementFile := filepath.Join(dir, "statement.cbor")
+	require.NoError(t, os.WriteFile(statementFile, statement.Content, 0644))
+	otherStatementFile := filepath.Join(dir, "other-statement.cbor")
+	require.NoError(t, os.WriteFile(otherStatementFile, fixture.statements[3].Content, 0644))
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, keyio.WritePublicPEM(keyFile, fixture.key.Public()))
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr error
+	}{
+		{name: "leaf hash", args: []string{"--leaf-hash", hex.EncodeToString(statement.LeafHash)}},
+		{name: "leaf rebuilt from the signed statement", args: []string{"--signed-statement", statementFile}},
+		{name: "a different signed statement", args: []string{"--signed-statement", otherStatementFile}, wantErr: ErrVerifyReceiptFailed},
+		{name: "no leaf", wantErr: ErrReceiptLeafUnresolved},
+		{name: "both leaf options", args: []string{
+			"--leaf-hash", hex.EncodeToString(statement.LeafHash), "--signed-statement", statementFile}, wantErr: ErrReceiptLeafUnresolved},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := AddCommands(NewApp("version", true), true)
+			args := append([]string{
+				"veracity", "verify-receipt", "--receipt", receiptFile, "--checkpoint-public-pem", keyFile}, tt.args...)
+			err := app.Run(args)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -4,8 +4,6 @@ package veracity
 // efficiently.
 
 import (
-	"context"
-	"errors"
 	"fmt"
 	"strings"
 
@@ -42,7 +40,8 @@ const (
 )
 
 var (
-	ErrNoChanges = errors.New("no changes found")
+	// ErrNoChanges is returned by the watcher when there is no activity to report
+	ErrNoChanges = azwatcher.ErrNoChanges
 )
 
 type WatchConfig struct {
@@ -115,7 +114,7 @@ func NewLogWatcherCmd() *cli.Command {
 
 			var err error
 			cmd := &CmdCtx{}
-			ctx := context.Background()
+			ctx := cCtx.Context
 
 			if err = cfgLogging(cmd, cCtx); err != nil {
 				return err
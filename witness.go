@@ -0,0 +1,331 @@
+package veracity
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/datatrails/veracity/keyio"
+	"github.com/forestrie/go-merklelog/massifs"
+	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/urfave/cli/v2"
+	"github.com/veraison/go-cose"
+)
+
+const (
+	defaultWitnessStateDir     = ".veracity-witness"
+	witnessAcceptedFileName    = "accepted.cbor"
+	witnessCosignaturesDirName = "cosignatures"
+)
+
+var (
+	ErrWitnessRefused   = errors.New("the witness refused to cosign the checkpoint")
+	ErrWitnessKeyNeeded = errors.New("a witness signing key is required, use --witness-key or --witness-key-pem")
+	ErrWitnessRollback  = errors.New("the checkpoint is older than the checkpoint already accepted")
+)
+
+// witnessState is the directory in which the witness keeps the last accepted
+// checkpoint for a log, the cosignatures it has made and the evidence for any
+// checkpoints it refused.
+type witnessState struct {
+	logID storage.LogID
+	dir   string
+}
+
+func newWitnessState(stateDir string, logID storage.LogID) *witnessState {
+	return &witnessState{logID: logID, dir: filepath.Join(stateDir, logIDString(logID))}
+}
+
+// Accepted returns the last accepted checkpoint, or false if there is none
+func (w *witnessState) Accepted() (checkpointRecord, bool, error) {
+	data, err := os.ReadFile(filepath.Join(w.dir, witnessAcceptedFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpointRecord{}, false, nil
+	}
+	if err != nil {
+		return checkpointRecord{}, false, err
+	}
+	var rec checkpointRecord
+	if err = cbor.Unmarshal(data, &rec); err != nil {
+		return checkpointRecord{}, false, fmt.Errorf("failed to decode the accepted checkpoint: %w", err)
+	}
+	return rec, true, nil
+}
+
+// Accept replaces the accepted checkpoint
+func (w *witnessState) Accept(rec checkpointRecord) error {
+	data, err := cbor.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(w.dir, os.FileMode(0755)); err != nil {
+		return err
+	}
+	fileName := filepath.Join(w.dir, witnessAcceptedFileName)
+	tmpFileName := fileName + ".tmp"
+	if err = os.WriteFile(tmpFileName, data, os.FileMode(0644)); err != nil {
+		return err
+	}
+	return os.Rename(tmpFileName, fileName)
+}
+
+// WriteCosignature keeps the cosignature and returns the file name
+func (w *witnessState) WriteCosignature(state massifs.MMRState, cosignature []byte) (string, error) {
+	dir := filepath.Join(w.dir, witnessCosignaturesDirName)
+	if err := os.MkdirAll(dir, os.FileMode(0755)); err != nil {
+		return "", err
+	}
+	fileName := filepath.Join(dir, fmt.Sprintf("%016d-%016d.cbor", state.MMRSize, state.Timestamp))
+	return fileName, os.WriteFile(fileName, cosignature, os.FileMode(0644))
+}
+
+// EvidenceFileName returns a new file name for the evidence of a refused checkpoint
+func (w *witnessState) EvidenceFileName(now time.Time) (string, error) {
+	if err := os.MkdirAll(w.dir, os.FileMode(0755)); err != nil {
+		return "", err
+	}
+	return filepath.Join(w.dir, fmt.Sprintf("evidence-%016d.json", now.UnixMilli())), nil
+}
+
+// NewWitnessCmd verifies each new checkpoint is consistent with the last one
+// accepted, and cosigns it if it is.
+func NewWitnessCmd() *cli.Command {
+	return &cli.Command{
+		Name: "witness",
+		Usage: `verify the latest checkpoint for each log is consistent with the last checkpoint the witness accepted, and cosign it.
+
+The first checkpoint seen for a log is accepted on trust. After that, a checkpoint is only cosigned if it is proven consistent with the accepted checkpoint using the log.
+If consistency fails, the checkpoint is not signed and the evidence is written to the witness state directory.
+The cosignature is a COSE Sign1 message over the checkpoint's MMRState, including the peaks.`,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:  "witness-key",
+				Usage: "the witness signing key, in cose .cbor",
+			},
+			&cli.StringFlag{
+				Name:  "witness-key-pem",
+				Usage: "the witness signing key, in PEM format. used in preference to --witness-key",
+			},
+			&cli.StringFlag{
+				Name:  "witness-kid",
+				Usage: "the key identifier to include in the protected header of each cosignature",
+			},
+			&cli.StringFlag{
+				Name:  "state-dir",
+				Usage: "the directory in which the accepted checkpoints, cosignatures and evidence are kept",
+				Value: defaultWitnessStateDir,
+			},
+		}, checkpointKeyFlags()...),
+		Action: func(cCtx *cli.Context) error {
+			var err error
+			cmd := &CmdCtx{}
+			ctx := cCtx.Context
+
+			if err = cfgLogging(cmd, cCtx); err != nil {
+				return err
+			}
+			if err = CfgKeys(cmd, cCtx); err != nil {
+				return err
+			}
+			if len(cmd.CheckpointKeys.Keys) == 0 {
+				return errors.New("checkpoint public key is required")
+			}
+			verifier, err := checkpointVerifier(cmd)
+			if err != nil {
+				return err
+			}
+			signer, err := readWitnessSigner(cCtx)
+			if err != nil {
+				return err
+			}
+			if err = cfgMassifFmt(cmd, cCtx); err != nil {
+				return err
+			}
+
+			logIDs := CtxGetLogOptions(cCtx)
+			if len(logIDs) == 0 {
+				return fmt.Errorf("a tenant or logid is required for this command")
+			}
+
+			reader, err := newMassifReader(cmd, cCtx)
+			if err != nil {
+				return err
+			}
+
+			source := cmd.RemoteURL
+			if source == "" {
+				source = cCtx.String("data-local")
+			}
+
+			var refused int
+			for _, logID := range logIDs {
+				if err = reader.SelectLog(ctx, logID); err != nil {
+					return fmt.Errorf("failed to select log %s: %w", logID, err)
+				}
+				massifIndex, err := reader.HeadIndex(ctx, storage.ObjectCheckpoint)
+				if err != nil {
+					return err
+				}
+				verified, err := getContextVerified(ctx, reader, &cmd.CBORCodec, verifier, massifIndex)
+				if err != nil {
+					return fmt.Errorf("%s: %w", logIDString(logID), err)
+				}
+				checkpoint, _, err := reader.CheckpointData(massifIndex)
+				if err != nil {
+					return err
+				}
+				view := checkpointView{
+					Source:     source,
+					Checkpoint: checkpoint,
+					State:      verified.MMRState,
+					store:      newMassifNodeStore(ctx, reader, cmd.MassifFmt.MassifHeight),
+				}
+
+				state := newWitnessState(cCtx.String("state-dir"), logID)
+				fileName, err := witnessCheckpoint(cmd, verifier, signer, cCtx.String("witness-kid"), state, massifIndex, view)
+				if errors.Is(err, ErrWitnessRefused) {
+					refused++
+					cmd.Log.Infof("%s: %v", logIDString(logID), err)
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("%s: %w", logIDString(logID), err)
+				}
+				if fileName == "" {
+					fmt.Printf("%s mmrsize %d already witnessed\n", logIDString(logID), view.State.MMRSize)
+					continue
+				}
+				fmt.Printf("%s mmrsize %d cosigned %s\n", logIDString(logID), view.State.MMRSize, fileName)
+			}
+			if refused > 0 {
+				return fmt.Errorf("%w: %d of %d logs", ErrWitnessRefused, refused, len(logIDs))
+			}
+			return nil
+		},
+	}
+}
+
+// readWitnessSigner reads the witness signing key, the PEM key is preferred if both are set
+func readWitnessSigner(cCtx *cli.Context) (cose.Signer, error) {
+	var decodedKey keyio.DecodedPrivate
+	var err error
+	switch {
+	case cCtx.String("witness-key-pem") != "":
+		decodedKey, err = keyio.ReadPrivatePEM(cCtx.String("witness-key-pem"))
+	case cCtx.String("witness-key") != "":
+		decodedKey, err = keyio.ReadPrivateCOSE(cCtx.String("witness-key"))
+	default:
+		return nil, ErrWitnessKeyNeeded
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the witness key: %w", err)
+	}
+	return cose.NewSigner(decodedKey.Alg, decodedKey.Private)
+}
+
+// witnessCheckpoint checks the checkpoint in view is consistent with the last
+// accepted checkpoint. If it is, the checkpoint is cosigned and accepted, and
+// the name of the cosignature file is returned. If it is the checkpoint
+// already accepted, the name is empty. Checkpoints which are not consistent
+// are refused, and the evidence is written to the witness state directory.
+// Checkpoints whose consistency can not be proven are also refused.
+func witnessCheckpoint(
+	cmd *CmdCtx, verifier cose.Verifier, signer cose.Signer, kid string,
+	state *witnessState, massifIndex uint32, view checkpointView,
+) (string, error) {
+
+	// No later checkpoint can be proven consistent with a version 0
+	// checkpoint, so it is never accepted.
+	if view.State.Version == int(massifs.MMRStateVersion0) {
+		return "", fmt.Errorf("%w: %w: version 0 checkpoints have no signed peaks",
+			ErrWitnessRefused, ErrViewUnprovable)
+	}
+
+	rec, ok, err := state.Accepted()
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		accepted, err := verifyCheckpointRecord(cmd.CBORCodec, verifier, rec)
+		if err != nil {
+			return "", fmt.Errorf("the accepted checkpoint: %w", err)
+		}
+		if view.State.MMRSize < accepted.MMRSize {
+			return "", fmt.Errorf("%w: %w: size %d, accepted %d",
+				ErrWitnessRefused, ErrWitnessRollback, view.State.MMRSize, accepted.MMRSize)
+		}
+
+		views := []checkpointView{
+			{Source: state.dir, Checkpoint: rec.Checkpoint, State: accepted},
+			view,
+		}
+		conflict, err := compareViewPair(views, 0, 1)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrWitnessRefused, err)
+		}
+		if conflict != nil {
+			fileName, err := state.EvidenceFileName(time.Now())
+			if err != nil {
+				return "", err
+			}
+			evidence := newSplitViewEvidence(state.logID, views, []SplitViewConflict{*conflict})
+			if err = evidence.WriteFile(fileName); err != nil {
+				return "", err
+			}
+			return "", fmt.Errorf("%w: %s, evidence written to %s", ErrWitnessRefused, conflict.Reason, fileName)
+		}
+		if accepted.MMRSize == view.State.MMRSize {
+			return "", nil
+		}
+	}
+
+	cosignature, err := cosignState(cmd.CBORCodec, signer, kid, view.State)
+	if err != nil {
+		return "", err
+	}
+	fileName, err := state.WriteCosignature(view.State, cosignature)
+	if err != nil {
+		return "", err
+	}
+	err = state.Accept(checkpointRecord{
+		MassifIndex: massifIndex,
+		Retained:    time.Now().UnixMilli(),
+		Checkpoint:  view.Checkpoint,
+		Peaks:       view.State.Peaks,
+	})
+	if err != nil {
+		return "", err
+	}
+	return fileName, nil
+}
+
+// cosignState signs the state, including its peaks, so that the cosignature
+// can be verified without the log or the log's checkpoint.
+func cosignState(
+	codec commoncbor.CBORCodec, signer cose.Signer, kid string, state massifs.MMRState,
+) ([]byte, error) {
+	payload, err := codec.MarshalCBOR(state)
+	if err != nil {
+		return nil, err
+	}
+	msg := cose.Sign1Message{
+		Headers: cose.Headers{
+			Protected: cose.ProtectedHeader{
+				cose.HeaderLabelAlgorithm: signer.Algorithm(),
+			},
+		},
+		Payload: payload,
+	}
+	if kid != "" {
+		msg.Headers.Protected[cose.HeaderLabelKeyID] = []byte(kid)
+	}
+	if err = msg.Sign(rand.Reader, nil, signer); err != nil {
+		return nil, err
+	}
+	return msg.MarshalCBOR()
+}
@@ -0,0 +1,85 @@
+package veracity
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func TestCosignState(t *testing.T) {
+	codec, err := massifs.NewCBORCodec()
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+	verifier, err := cose.NewVerifier(cose.AlgorithmES256, &key.PublicKey)
+	require.NoError(t, err)
+
+	state := massifs.MMRState{
+		Version:   int(massifs.MMRStateVersionCurrent),
+		MMRSize:   7,
+		Peaks:     [][]byte{make([]byte, 32)},
+		Timestamp: 1,
+	}
+
+	data, err := cosignState(codec, signer, "witness-1", state)
+	require.NoError(t, err)
+
+	var msg cose.Sign1Message
+	require.NoError(t, msg.UnmarshalCBOR(data))
+	assert.NoError(t, msg.Verify(nil, verifier))
+	assert.Equal(t, []byte("witness-1"), msg.Headers.Protected[cose.HeaderLabelKeyID])
+
+	var got massifs.MMRState
+	require.NoError(t, codec.UnmarshalInto(msg.Payload, &got))
+	assert.Equal(t, state.MMRSize, got.MMRSize)
+	assert.Equal(t, state.Peaks, got.Peaks)
+}
+
+func TestWitnessStateAccept(t *testing.T) {
+	state := newWitnessState(t.TempDir(), []byte("0123456789abcdef"))
+
+	_, ok, err := state.Accepted()
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	rec := checkpointRecord{MassifIndex: 2, Retained: 3, Checkpoint: []byte{1}, Peaks: [][]byte{{4}}}
+	require.NoError(t, state.Accept(rec))
+
+	got, ok, err := state.Accepted()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, rec, got)
+}
+
+func TestWitnessCheckpointVersion0(t *testing.T) {
+	codec, err := massifs.NewCBORCodec()
+	require.NoError(t, err)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+	verifier, err := cose.NewVerifier(cose.AlgorithmES256, &key.PublicKey)
+	require.NoError(t, err)
+
+	cmd := &CmdCtx{CBORCodec: codec}
+	state := newWitnessState(t.TempDir(), []byte("0123456789abcdef"))
+	view := checkpointView{Source: "log", State: massifs.MMRState{Version: int(massifs.MMRStateVersion0), MMRSize: 7}}
+
+	// A version 0 checkpoint is never accepted, consistency with it can not
+	// be proven
+	_, err = witnessCheckpoint(cmd, verifier, signer, "witness-1", state, 1, view)
+	assert.ErrorIs(t, err, ErrWitnessRefused)
+	assert.ErrorIs(t, err, ErrViewUnprovable)
+	_, ok, err := state.Accepted()
+	require.NoError(t, err)
+	assert.False(t, ok)
+}